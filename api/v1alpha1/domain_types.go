@@ -42,16 +42,160 @@ type DomainSpec struct {
 	//+kubebuilder:validation:Required
 	DKim DKim `json:"dkim,omitempty"`
 
+	// DMARC configures the verification of the DMARC record of the domain.
+	//+optional
+	DMARC DMARC `json:"dmarc,omitempty"`
+
+	// DNS configures how the DNS records of the domain are verified.
+	DNS DomainDNSSpec `json:"dns,omitempty"`
+
 	Ingress DomainIngressSpec `json:"ingress,omitempty"`
+
+	// Routing selects how the stats endpoint is exposed, with an Ingress
+	// or with a Gateway API HTTPRoute. Both route to spec.ingress.service.
+	//+kubebuilder:validation:Enum=Ingress;HTTPRoute
+	//+kubebuilder:default=Ingress
+	//+optional
+	Routing string `json:"routing,omitempty"`
+
+	// HTTPRoute configures the stats HTTPRoute of the HTTPRoute routing.
+	//+optional
+	HTTPRoute *DomainHTTPRouteSpec `json:"httpRoute,omitempty"`
+}
+
+// Routing modes of the stats endpoint.
+const (
+	RoutingIngress   = "Ingress"
+	RoutingHTTPRoute = "HTTPRoute"
+)
+
+type DomainHTTPRouteSpec struct {
+	// ParentRefs are the Gateways the stats HTTPRoute attaches to.
+	//+kubebuilder:validation:MinItems=1
+	ParentRefs []HTTPRouteParentRef `json:"parentRefs"`
+}
+
+type HTTPRouteParentRef struct {
+	// Group defaults to gateway.networking.k8s.io.
+	//+optional
+	Group string `json:"group,omitempty"`
+
+	// Kind defaults to Gateway.
+	//+optional
+	Kind string `json:"kind,omitempty"`
+
+	// Namespace defaults to the namespace of the Domain.
+	//+optional
+	Namespace string `json:"namespace,omitempty"`
+
+	//+kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// SectionName is the listener of the Gateway to attach to.
+	//+optional
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+type DomainDNSSpec struct {
+	// Resolvers overrides the resolvers used to verify the records of the
+	// domain. Each entry is an IPv4 or IPv6 address or a host name, with an
+	// optional port (default 53), e.g. 10.0.0.53, [fd00::53]:5353 or
+	// dns.internal:53, queried over UDP with TCP fallback. The tcp://,
+	// tls:// and https:// schemes select DNS over TCP, DNS over TLS (default
+	// port 853) and DNS over HTTPS, e.g. tls://1.1.1.1 or
+	// https://dns.example/dns-query. When empty the operator-wide resolvers
+	// are used. Other resolvers must be allowed by the operator, see its
+	// --dns-allowed-resolvers flag.
+	//+kubebuilder:validation:MaxItems=16
+	Resolvers []string `json:"resolvers,omitempty"`
+
+	// Mode selects the servers the records are verified on: recursive
+	// queries the resolvers, authoritative discovers the nameservers of the
+	// zone and queries each of them directly, bypassing the resolver
+	// caches. Nameservers without a public IP address are not queried.
+	// When empty the operator-wide mode is used.
+	//+kubebuilder:validation:Enum=recursive;authoritative
+	Mode string `json:"mode,omitempty"`
+
+	// Quorum decides when a check passes from the answers of the
+	// resolvers. When unset the operator-wide policy is used.
+	//+optional
+	Quorum *DNSQuorumPolicy `json:"quorum,omitempty"`
+}
+
+// DNSQuorumPolicy decides when a DNS check passes. Resolvers whose lookup
+// failed are counted apart from the ones answering with a wrong or missing
+// record.
+type DNSQuorumPolicy struct {
+	// Type of the policy: majority passes when more than half of the
+	// resolvers validate the record, all when every resolver does, any when
+	// at least one does, atLeast when at least minOK do and weighted when
+	// the validating resolvers hold more than half of the total weight.
+	//+kubebuilder:validation:Enum=majority;all;any;atLeast;weighted
+	//+kubebuilder:default=majority
+	Type string `json:"type,omitempty"`
+
+	// MinOK is the number of resolvers that must validate the record with
+	// the atLeast policy.
+	//+kubebuilder:validation:Minimum=1
+	//+optional
+	MinOK int `json:"minOK,omitempty"`
+
+	// Weights are the weights of the resolvers with the weighted policy, by
+	// resolver address or, in authoritative mode, nameserver host.
+	// Resolvers without weight weigh 1.
+	//+optional
+	Weights map[string]int `json:"weights,omitempty"`
+
+	// IgnoreErrors excludes the resolvers whose lookup failed from the
+	// quorum, so that an unreachable resolver does not fail the check.
+	//+optional
+	IgnoreErrors bool `json:"ignoreErrors,omitempty"`
 }
 
 type DomainIngressSpec struct {
-	ClassName string `json:"className"`
+	// ClassName is the IngressClass of the stats ingress, it must exist.
+	// Defaults to the default IngressClass of the cluster.
+	//+optional
+	ClassName string `json:"className,omitempty"`
 
 	//+kubebuilder:validation:Required
 	Service DomainIngressServiceSpec `json:"service"`
 
 	Annotations map[string]string `json:"annotations"`
+
+	// TLS configures the certificate of the stats host.
+	//+optional
+	TLS *DomainTLSSpec `json:"tls,omitempty"`
+}
+
+type DomainTLSSpec struct {
+	// IssuerRef is the cert-manager issuer of the certificate of the stats
+	// host. The operator creates the Certificate once the stats CNAME is
+	// verified. When empty the certificate is not managed by the operator.
+	//+optional
+	IssuerRef *TLSIssuerRef `json:"issuerRef,omitempty"`
+
+	// SecretName is the secret holding the certificate of the stats host,
+	// either an existing secret or the one written by cert-manager.
+	// Defaults to <stats host>-tls.
+	//+optional
+	SecretName string `json:"secretName,omitempty"`
+}
+
+type TLSIssuerRef struct {
+	//+kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Kind is the kind of the issuer, Issuer or ClusterIssuer.
+	//+kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	//+kubebuilder:default=Issuer
+	//+optional
+	Kind string `json:"kind,omitempty"`
+
+	// Group is the API group of the issuer, defaults to cert-manager.io.
+	//+optional
+	Group string `json:"group,omitempty"`
 }
 
 type DomainIngressServiceSpec struct {
@@ -62,23 +206,248 @@ type DomainIngressServiceSpec struct {
 	Port int32 `json:"port"`
 }
 
+const (
+	DKimKeyTypeRSA     = "rsa"
+	DKimKeyTypeEd25519 = "ed25519"
+)
+
 type DKim struct {
-	//+kubebuilder:validation:Required
+	// Selector and PublicKey describe a single RSA selector. They are kept
+	// for backward compatibility, use Selectors to configure more keys.
+	// When PublicKey is empty the key is generated by the operator.
 	Selector string `json:"selector,omitempty"`
 
+	PublicKey string `json:"publicKey,omitempty"`
+
+	// Selectors lists the DKIM keys published for the domain. Multiple
+	// selectors can be used to sign with RSA and Ed25519 keys at the same
+	// time or to keep an old key alive during a rotation.
+	Selectors []DKimSelector `json:"selectors,omitempty"`
+
+	// Rotation enables an operator managed selector whose key is rotated
+	// on a schedule.
+	Rotation *DKimRotation `json:"rotation,omitempty"`
+}
+
+type DKimRotation struct {
+	// SelectorPrefix is used to name the generated selectors.
+	//+kubebuilder:default=k8nnon
+	SelectorPrefix string `json:"selectorPrefix,omitempty"`
+
+	//+kubebuilder:validation:Enum=rsa;ed25519
+	//+kubebuilder:default=rsa
+	KeyType string `json:"keyType,omitempty"`
+
+	// Interval between two rotations, e.g. 4380h for six months.
+	//+kubebuilder:validation:Required
+	Interval metav1.Duration `json:"interval"`
+
+	// GracePeriod is how long the previous selector is kept after the
+	// switch to the new one.
+	//+kubebuilder:default="168h"
+	GracePeriod metav1.Duration `json:"gracePeriod,omitempty"`
+}
+
+type DKimSelector struct {
 	//+kubebuilder:validation:Required
+	Selector string `json:"selector"`
+
+	//+kubebuilder:validation:Enum=rsa;ed25519
+	//+kubebuilder:default=rsa
+	KeyType string `json:"keyType,omitempty"`
+
+	// PublicKey is the base64 encoded public key. When empty the operator
+	// generates the key pair and stores the private key in a Secret.
 	PublicKey string `json:"publicKey,omitempty"`
 }
 
+// AllSelectors returns the legacy selector, if set, followed by Selectors.
+func (d DKim) AllSelectors() []DKimSelector {
+	selectors := make([]DKimSelector, 0, len(d.Selectors)+1)
+	if d.Selector != "" {
+		selectors = append(selectors, DKimSelector{
+			Selector:  d.Selector,
+			KeyType:   DKimKeyTypeRSA,
+			PublicKey: d.PublicKey,
+		})
+	}
+
+	for _, s := range d.Selectors {
+		if s.KeyType == "" {
+			s.KeyType = DKimKeyTypeRSA
+		}
+		selectors = append(selectors, s)
+	}
+
+	return selectors
+}
+
+type DMARC struct {
+	// Policy is the minimum policy the published DMARC record must enforce.
+	// When empty any valid DMARC record is accepted.
+	//+kubebuilder:validation:Enum=none;quarantine;reject
+	Policy string `json:"policy,omitempty"`
+}
+
+// AnnotationRecheck forces the next reconcile of a Domain to query the
+// resolvers instead of answering from the DNS cache. The operator removes it
+// once the check is done.
+const AnnotationRecheck = "core.k8s.kannon.email/recheck"
+
+// Condition types reported in DomainStatus.Conditions.
+const (
+	// ConditionReady is true when every DNS record is verified and the
+	// stats ingress, and its certificate when issued by the operator, are
+	// in place.
+	ConditionReady = "Ready"
+
+	ConditionDKIMVerified     = "DKIMVerified"
+	ConditionSPFVerified      = "SPFVerified"
+	ConditionDMARCVerified    = "DMARCVerified"
+	ConditionStatsDNSVerified = "StatsDNSVerified"
+	ConditionIngressReady     = "IngressReady"
+
+	// ConditionCertificateReady is only reported when the certificate of
+	// the stats host is issued through cert-manager.
+	ConditionCertificateReady = "CertificateReady"
+)
+
 // DomainStatus defines the observed state of Domain
 type DomainStatus struct {
 	DNS DNSStatus `json:"dns"`
+
+	DKim DKimStatus `json:"dkim,omitempty"`
+
+	// RequiredRecords lists the DNS records that must be published for the
+	// domain to be verified.
+	RequiredRecords []RequiredRecord `json:"requiredRecords,omitempty"`
+
+	// Certificate is the state of the cert-manager Certificate of the stats
+	// host, only set when the spec configures an issuer.
+	//+optional
+	Certificate *CertificateStatus `json:"certificate,omitempty"`
+
+	// NotifiedConditions is the state, ok or failing, of each condition as
+	// last delivered to the notification endpoints. Transitions that were
+	// not delivered are notified again.
+	//+optional
+	NotifiedConditions map[string]string `json:"notifiedConditions,omitempty"`
+
+	// Conditions describe the current state of the domain.
+	//+listType=map
+	//+listMapKey=type
+	//+optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+type CertificateStatus struct {
+	// Name is the name of the Certificate.
+	Name string `json:"name"`
+
+	SecretName string `json:"secretName"`
+
+	Ready bool `json:"ready"`
+
+	// Reason and Message explain why the certificate is not ready.
+	//+optional
+	Reason string `json:"reason,omitempty"`
+	//+optional
+	Message string `json:"message,omitempty"`
+
+	// NotAfter is the expiration time of the issued certificate.
+	//+optional
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+}
+
+type RequiredRecord struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+
+	// Check is the DNS check verifying the record.
+	Check string `json:"check"`
+
+	Verified bool `json:"verified"`
+}
+
+type DKimStatus struct {
+	// ManagedKeys lists the DKIM keys generated by the operator.
+	ManagedKeys []DKimManagedKey `json:"managedKeys,omitempty"`
+
+	Rotation *DKimRotationStatus `json:"rotation,omitempty"`
+}
+
+type DKimRotationPhase string
+
+const (
+	// DKimRotationPublishing means a new key has been minted and the
+	// operator is waiting for its record to propagate.
+	DKimRotationPublishing DKimRotationPhase = "Publishing"
+
+	// DKimRotationRetiring means the active selector has been switched and
+	// the previous one is kept until the end of the grace period.
+	DKimRotationRetiring DKimRotationPhase = "Retiring"
+
+	// DKimRotationStable means only the active selector is in use.
+	DKimRotationStable DKimRotationPhase = "Stable"
+)
+
+type DKimRotationStatus struct {
+	Phase DKimRotationPhase `json:"phase"`
+
+	// ActiveSelector is the selector mail must be signed with.
+	ActiveSelector string `json:"activeSelector,omitempty"`
+
+	// PendingSelector is the new selector waiting for propagation.
+	PendingSelector string `json:"pendingSelector,omitempty"`
+
+	// RetiringSelector is the previous selector, still published until
+	// RetireTime.
+	RetiringSelector string `json:"retiringSelector,omitempty"`
+
+	LastRotationTime *metav1.Time `json:"lastRotationTime,omitempty"`
+	RetireTime       *metav1.Time `json:"retireTime,omitempty"`
+
+	// RetiredSelectors are the rotated selectors no longer in use, past
+	// their grace period or dropped before being used, whose Secrets are
+	// deleted. The Secrets of the rotated selectors are only deleted once
+	// listed here, so that losing the status never deletes a key that may
+	// still be signing mails.
+	//+optional
+	RetiredSelectors []string `json:"retiredSelectors,omitempty"`
+}
+
+type DKimManagedKey struct {
+	Selector  string `json:"selector"`
+	KeyType   string `json:"keyType"`
+	PublicKey string `json:"publicKey"`
+
+	// SecretName is the name of the Secret holding the private key.
+	SecretName string `json:"secretName"`
+
+	// RecordName and Record describe the TXT record to publish.
+	RecordName string `json:"recordName"`
+	Record     string `json:"record"`
 }
 
 type DNSStatus struct {
 	Stats DNSStatusStats `json:"stats"`
 	DKIM  DNSStatusStats `json:"dkim"`
 	SFP   DNSStatusStats `json:"spf"`
+	DMARC DNSStatusStats `json:"dmarc"`
+
+	DKIMSelectors []DNSStatusDKIMSelector `json:"dkimSelectors,omitempty"`
+
+	// Nameservers lists the authoritative nameservers queried in
+	// authoritative mode.
+	Nameservers []string `json:"nameservers,omitempty"`
+}
+
+type DNSStatusDKIMSelector struct {
+	Selector string `json:"selector"`
+	KeyType  string `json:"keyType"`
+
+	DNSStatusStats `json:",inline"`
 }
 
 type DNSStatusStats struct {
@@ -86,6 +455,67 @@ type DNSStatusStats struct {
 	CntOK  int  `json:"cnt_ok"`
 	CntErr int  `json:"cnt_err"`
 	CntKO  int  `json:"cnt_ko"`
+
+	// Reason explains why the check is failing.
+	Reason string `json:"reason,omitempty"`
+
+	// Inconsistent is set in authoritative mode when the nameservers
+	// disagree on the record or some of them are lame.
+	Inconsistent bool `json:"inconsistent,omitempty"`
+
+	// DNSSEC is the weakest DNSSEC state of the answers of the resolvers:
+	// secure, insecure or bogus. The check fails on bogus answers. Empty
+	// when DNSSEC validation is off.
+	//+kubebuilder:validation:Enum=secure;insecure;bogus
+	//+optional
+	DNSSEC string `json:"dnssec,omitempty"`
+
+	// FirstSeenOK is when the check first passed, reset when it fails.
+	FirstSeenOK *metav1.Time `json:"firstSeenOK,omitempty"`
+
+	// Resolvers is the outcome of the check on each resolver, or on each
+	// nameserver in authoritative mode.
+	Resolvers []DNSResolverStatus `json:"resolvers,omitempty"`
+}
+
+// DNSResolverStatus is the outcome of a check on a single resolver.
+type DNSResolverStatus struct {
+	Resolver string `json:"resolver"`
+	OK       bool   `json:"ok"`
+
+	// Lame is set when the nameserver is not authoritative for the zone.
+	Lame bool `json:"lame,omitempty"`
+	// Unhealthy is set when the resolver was not queried because it failed
+	// repeatedly. Unhealthy resolvers are left out of the quorum.
+	Unhealthy bool `json:"unhealthy,omitempty"`
+	// DNSSEC is the DNSSEC state of the answers of the resolver.
+	//+kubebuilder:validation:Enum=secure;insecure;bogus
+	//+optional
+	DNSSEC string `json:"dnssec,omitempty"`
+
+	// Value is the record observed by the resolver.
+	Value string `json:"value,omitempty"`
+
+	// Reason explains why the observed record does not pass the check.
+	Reason string `json:"reason,omitempty"`
+
+	// Error is set when the lookup failed.
+	Error string `json:"error,omitempty"`
+
+	// Latency is the time the resolver took to answer the check, rounded
+	// to 100ms so that the status does not change on every check.
+	//+optional
+	Latency *metav1.Duration `json:"latency,omitempty"`
+
+	// TTL is the lowest TTL, in seconds, of the answers the check relied
+	// on, rounded down to the minute when longer than one. For missing
+	// records it is the negative caching TTL of the zone.
+	//+optional
+	TTL *int32 `json:"ttl,omitempty"`
+
+	// FirstSeenOK is when the resolver first observed a valid record,
+	// reset when it stops doing so.
+	FirstSeenOK *metav1.Time `json:"firstSeenOK,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -93,8 +523,10 @@ type DNSStatusStats struct {
 
 // Domain is the Schema for the domains API
 // +kubebuilder:printcolumn:name="Domain",type=string,JSONPath=`.spec.domainName`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
 // +kubebuilder:printcolumn:name="DNS Check DKIM",type=boolean,JSONPath=`.status.dns.dkim.ok`
 // +kubebuilder:printcolumn:name="DNS Check SPF",type=boolean,JSONPath=`.status.dns.spf.ok`
+// +kubebuilder:printcolumn:name="DNS Check DMARC",type=boolean,JSONPath=`.status.dns.dmarc.ok`
 // +kubebuilder:printcolumn:name="DNS Check Stats",type=boolean,JSONPath=`.status.dns.stats.ok`
 type Domain struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -104,6 +536,70 @@ type Domain struct {
 	Status DomainStatus `json:"status,omitempty"`
 }
 
+// DKimSelectors returns the DKIM selectors of the domain, including the
+// active and retiring rotated selectors, filling the public key of operator
+// managed selectors from the status.
+func (d *Domain) DKimSelectors() []DKimSelector {
+	selectors := d.Spec.DKim.AllSelectors()
+
+	if rotation := d.Status.DKim.Rotation; rotation != nil {
+		for _, name := range []string{rotation.ActiveSelector, rotation.RetiringSelector} {
+			if name != "" {
+				selectors = append(selectors, d.rotatedSelector(name))
+			}
+		}
+	}
+
+	for i, s := range selectors {
+		if s.PublicKey != "" {
+			continue
+		}
+
+		for _, key := range d.Status.DKim.ManagedKeys {
+			if key.Selector == s.Selector && key.KeyType == s.KeyType {
+				selectors[i].PublicKey = key.PublicKey
+			}
+		}
+	}
+
+	return selectors
+}
+
+// rotatedSelector returns the rotated selector called name, keeping the key
+// type it was generated with.
+func (d *Domain) rotatedSelector(name string) DKimSelector {
+	for _, key := range d.Status.DKim.ManagedKeys {
+		if key.Selector == name {
+			return DKimSelector{Selector: name, KeyType: key.KeyType}
+		}
+	}
+
+	keyType := DKimKeyTypeRSA
+	if d.Spec.DKim.Rotation != nil && d.Spec.DKim.Rotation.KeyType != "" {
+		keyType = d.Spec.DKim.Rotation.KeyType
+	}
+
+	return DKimSelector{Selector: name, KeyType: keyType}
+}
+
+// RotatedSelectors returns the selectors generated by the key rotation,
+// including the one retiring after the rotation has been disabled.
+func (d *Domain) RotatedSelectors() []DKimSelector {
+	rotation := d.Status.DKim.Rotation
+	if rotation == nil {
+		return nil
+	}
+
+	var selectors []DKimSelector
+	for _, name := range []string{rotation.ActiveSelector, rotation.PendingSelector, rotation.RetiringSelector} {
+		if name != "" {
+			selectors = append(selectors, d.rotatedSelector(name))
+		}
+	}
+
+	return selectors
+}
+
 //+kubebuilder:object:root=true
 
 // DomainList contains a list of Domain
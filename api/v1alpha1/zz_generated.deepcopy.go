@@ -22,12 +22,42 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateStatus) DeepCopyInto(out *CertificateStatus) {
+	*out = *in
+	if in.NotAfter != nil {
+		in, out := &in.NotAfter, &out.NotAfter
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateStatus.
+func (in *CertificateStatus) DeepCopy() *CertificateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DKim) DeepCopyInto(out *DKim) {
 	*out = *in
+	if in.Selectors != nil {
+		in, out := &in.Selectors, &out.Selectors
+		*out = make([]DKimSelector, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rotation != nil {
+		in, out := &in.Rotation, &out.Rotation
+		*out = new(DKimRotation)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DKim.
@@ -40,12 +70,191 @@ func (in *DKim) DeepCopy() *DKim {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DKimManagedKey) DeepCopyInto(out *DKimManagedKey) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DKimManagedKey.
+func (in *DKimManagedKey) DeepCopy() *DKimManagedKey {
+	if in == nil {
+		return nil
+	}
+	out := new(DKimManagedKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DKimRotation) DeepCopyInto(out *DKimRotation) {
+	*out = *in
+	out.Interval = in.Interval
+	out.GracePeriod = in.GracePeriod
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DKimRotation.
+func (in *DKimRotation) DeepCopy() *DKimRotation {
+	if in == nil {
+		return nil
+	}
+	out := new(DKimRotation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DKimRotationStatus) DeepCopyInto(out *DKimRotationStatus) {
+	*out = *in
+	if in.LastRotationTime != nil {
+		in, out := &in.LastRotationTime, &out.LastRotationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.RetireTime != nil {
+		in, out := &in.RetireTime, &out.RetireTime
+		*out = (*in).DeepCopy()
+	}
+	if in.RetiredSelectors != nil {
+		in, out := &in.RetiredSelectors, &out.RetiredSelectors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DKimRotationStatus.
+func (in *DKimRotationStatus) DeepCopy() *DKimRotationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DKimRotationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DKimSelector) DeepCopyInto(out *DKimSelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DKimSelector.
+func (in *DKimSelector) DeepCopy() *DKimSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(DKimSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DKimStatus) DeepCopyInto(out *DKimStatus) {
+	*out = *in
+	if in.ManagedKeys != nil {
+		in, out := &in.ManagedKeys, &out.ManagedKeys
+		*out = make([]DKimManagedKey, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rotation != nil {
+		in, out := &in.Rotation, &out.Rotation
+		*out = new(DKimRotationStatus)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DKimStatus.
+func (in *DKimStatus) DeepCopy() *DKimStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DKimStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DMARC) DeepCopyInto(out *DMARC) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DMARC.
+func (in *DMARC) DeepCopy() *DMARC {
+	if in == nil {
+		return nil
+	}
+	out := new(DMARC)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSQuorumPolicy) DeepCopyInto(out *DNSQuorumPolicy) {
+	*out = *in
+	if in.Weights != nil {
+		in, out := &in.Weights, &out.Weights
+		*out = make(map[string]int, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSQuorumPolicy.
+func (in *DNSQuorumPolicy) DeepCopy() *DNSQuorumPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSQuorumPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSResolverStatus) DeepCopyInto(out *DNSResolverStatus) {
+	*out = *in
+	if in.Latency != nil {
+		in, out := &in.Latency, &out.Latency
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FirstSeenOK != nil {
+		in, out := &in.FirstSeenOK, &out.FirstSeenOK
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSResolverStatus.
+func (in *DNSResolverStatus) DeepCopy() *DNSResolverStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSResolverStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DNSStatus) DeepCopyInto(out *DNSStatus) {
 	*out = *in
-	out.Stats = in.Stats
-	out.DKIM = in.DKIM
-	out.SFP = in.SFP
+	in.Stats.DeepCopyInto(&out.Stats)
+	in.DKIM.DeepCopyInto(&out.DKIM)
+	in.SFP.DeepCopyInto(&out.SFP)
+	in.DMARC.DeepCopyInto(&out.DMARC)
+	if in.DKIMSelectors != nil {
+		in, out := &in.DKIMSelectors, &out.DKIMSelectors
+		*out = make([]DNSStatusDKIMSelector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Nameservers != nil {
+		in, out := &in.Nameservers, &out.Nameservers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSStatus.
@@ -58,9 +267,36 @@ func (in *DNSStatus) DeepCopy() *DNSStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSStatusDKIMSelector) DeepCopyInto(out *DNSStatusDKIMSelector) {
+	*out = *in
+	in.DNSStatusStats.DeepCopyInto(&out.DNSStatusStats)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSStatusDKIMSelector.
+func (in *DNSStatusDKIMSelector) DeepCopy() *DNSStatusDKIMSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSStatusDKIMSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DNSStatusStats) DeepCopyInto(out *DNSStatusStats) {
 	*out = *in
+	if in.FirstSeenOK != nil {
+		in, out := &in.FirstSeenOK, &out.FirstSeenOK
+		*out = (*in).DeepCopy()
+	}
+	if in.Resolvers != nil {
+		in, out := &in.Resolvers, &out.Resolvers
+		*out = make([]DNSResolverStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSStatusStats.
@@ -79,7 +315,7 @@ func (in *Domain) DeepCopyInto(out *Domain) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Domain.
@@ -100,6 +336,51 @@ func (in *Domain) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DomainDNSSpec) DeepCopyInto(out *DomainDNSSpec) {
+	*out = *in
+	if in.Resolvers != nil {
+		in, out := &in.Resolvers, &out.Resolvers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Quorum != nil {
+		in, out := &in.Quorum, &out.Quorum
+		*out = new(DNSQuorumPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DomainDNSSpec.
+func (in *DomainDNSSpec) DeepCopy() *DomainDNSSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DomainDNSSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DomainHTTPRouteSpec) DeepCopyInto(out *DomainHTTPRouteSpec) {
+	*out = *in
+	if in.ParentRefs != nil {
+		in, out := &in.ParentRefs, &out.ParentRefs
+		*out = make([]HTTPRouteParentRef, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DomainHTTPRouteSpec.
+func (in *DomainHTTPRouteSpec) DeepCopy() *DomainHTTPRouteSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DomainHTTPRouteSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DomainIngressServiceSpec) DeepCopyInto(out *DomainIngressServiceSpec) {
 	*out = *in
@@ -126,6 +407,11 @@ func (in *DomainIngressSpec) DeepCopyInto(out *DomainIngressSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(DomainTLSSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DomainIngressSpec.
@@ -173,8 +459,15 @@ func (in *DomainList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DomainSpec) DeepCopyInto(out *DomainSpec) {
 	*out = *in
-	out.DKim = in.DKim
+	in.DKim.DeepCopyInto(&out.DKim)
+	out.DMARC = in.DMARC
+	in.DNS.DeepCopyInto(&out.DNS)
 	in.Ingress.DeepCopyInto(&out.Ingress)
+	if in.HTTPRoute != nil {
+		in, out := &in.HTTPRoute, &out.HTTPRoute
+		*out = new(DomainHTTPRouteSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DomainSpec.
@@ -190,7 +483,32 @@ func (in *DomainSpec) DeepCopy() *DomainSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DomainStatus) DeepCopyInto(out *DomainStatus) {
 	*out = *in
-	out.DNS = in.DNS
+	in.DNS.DeepCopyInto(&out.DNS)
+	in.DKim.DeepCopyInto(&out.DKim)
+	if in.RequiredRecords != nil {
+		in, out := &in.RequiredRecords, &out.RequiredRecords
+		*out = make([]RequiredRecord, len(*in))
+		copy(*out, *in)
+	}
+	if in.Certificate != nil {
+		in, out := &in.Certificate, &out.Certificate
+		*out = new(CertificateStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NotifiedConditions != nil {
+		in, out := &in.NotifiedConditions, &out.NotifiedConditions
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DomainStatus.
@@ -202,3 +520,68 @@ func (in *DomainStatus) DeepCopy() *DomainStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DomainTLSSpec) DeepCopyInto(out *DomainTLSSpec) {
+	*out = *in
+	if in.IssuerRef != nil {
+		in, out := &in.IssuerRef, &out.IssuerRef
+		*out = new(TLSIssuerRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DomainTLSSpec.
+func (in *DomainTLSSpec) DeepCopy() *DomainTLSSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DomainTLSSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPRouteParentRef) DeepCopyInto(out *HTTPRouteParentRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPRouteParentRef.
+func (in *HTTPRouteParentRef) DeepCopy() *HTTPRouteParentRef {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPRouteParentRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RequiredRecord) DeepCopyInto(out *RequiredRecord) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RequiredRecord.
+func (in *RequiredRecord) DeepCopy() *RequiredRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(RequiredRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TLSIssuerRef) DeepCopyInto(out *TLSIssuerRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TLSIssuerRef.
+func (in *TLSIssuerRef) DeepCopy() *TLSIssuerRef {
+	if in == nil {
+		return nil
+	}
+	out := new(TLSIssuerRef)
+	in.DeepCopyInto(out)
+	return out
+}
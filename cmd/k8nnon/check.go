@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+	"github.com/kannon-email/k8nnon/internal/dns/checker"
+	"github.com/kannon-email/k8nnon/internal/dns/records"
+	"github.com/kannon-email/k8nnon/internal/dns/resolver"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+var errChecksFailed = errors.New("some DNS checks failed")
+
+// checkReport is the outcome of one check of a domain.
+type checkReport struct {
+	Domain  string                   `json:"domain"`
+	Check   string                   `json:"check"`
+	OK      bool                     `json:"ok"`
+	CntOK   int                      `json:"cntOK"`
+	CntKO   int                      `json:"cntKO"`
+	CntErr  int                      `json:"cntErr"`
+	Reason  string                   `json:"reason,omitempty"`
+	Results []checker.ResolverResult `json:"results"`
+
+	Inconsistent bool                 `json:"inconsistent,omitempty"`
+	DNSSEC       resolver.DNSSECState `json:"dnssec,omitempty"`
+}
+
+func runCheck(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	file := fs.String("f", "", "read Domains from a YAML file (- for stdin) instead of flags")
+	output := fs.String("o", outputTable, "output format, one of table, json")
+	resolvers := fs.String("resolvers", strings.Join(checker.ServerAddresses, ","), "comma separated list of resolvers to query, plain addresses or tcp://, tls:// and https:// URLs")
+	mode := fs.String("mode", checker.ModeRecursive, "check mode, recursive to query the resolvers or authoritative to query the nameservers of the domain")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout of all the checks")
+	dnssec := fs.String("dnssec", resolver.DNSSECOff, "DNSSEC validation, one of off, ad, validate")
+	trustAnchors := fs.String("trust-anchors", "", "file of DS records used as DNSSEC trust anchors, defaults to the root KSK")
+	policy := checker.Policy{}
+	policy.BindFlags(fs, "")
+
+	domain := &corev1alpha1.Domain{}
+	fs.StringVar(&domain.Spec.DomainName, "domain", "", "domain to check")
+	fs.StringVar(&domain.Spec.BaseDomain, "base-domain", "", "base domain of the Kannon server")
+	fs.StringVar(&domain.Spec.StatsPrefix, "stats-prefix", "stats", "prefix of the stats domain")
+	fs.StringVar(&domain.Spec.DKim.Selector, "dkim-selector", "", "DKIM selector")
+	fs.StringVar(&domain.Spec.DKim.PublicKey, "dkim-public-key", "", "DKIM public key of the selector")
+	fs.StringVar(&domain.Spec.DMARC.Policy, "dmarc-policy", "", "minimum DMARC policy, one of none, quarantine, reject")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: k8nnon check [flags] [domain...]\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *output != outputTable && *output != outputJSON {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	var domains []corev1alpha1.Domain
+	if *file != "" {
+		var err error
+		domains, err = readDomainsFile(*file, fs.Args())
+		if err != nil {
+			return err
+		}
+		if len(domains) == 0 {
+			return fmt.Errorf("no Domain found in %s", *file)
+		}
+	} else {
+		if domain.Spec.DomainName == "" || domain.Spec.BaseDomain == "" {
+			return errors.New("either -f or both -domain and -base-domain are required")
+		}
+		domains = append(domains, *domain)
+	}
+
+	options := resolver.DefaultQueryOptions
+	options.DNSSEC.Mode = *dnssec
+	if *trustAnchors != "" {
+		anchors, err := resolver.LoadTrustAnchors(*trustAnchors)
+		if err != nil {
+			return err
+		}
+		options.DNSSEC.TrustAnchors = anchors
+	}
+	if err := options.DNSSEC.Validate(); err != nil {
+		return err
+	}
+
+	pool, err := resolver.NewPool(resolver.SplitAddresses(*resolvers)...)
+	if err != nil {
+		return err
+	}
+	pool.SetQueryOptions(options)
+
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	if *mode != checker.ModeRecursive && *mode != checker.ModeAuthoritative {
+		return fmt.Errorf("unknown mode %q", *mode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var reports []checkReport
+	for i := range domains {
+		c, err := domainChecker(pool, *mode, policy, &domains[i])
+		if err != nil {
+			return fmt.Errorf("domain %s: %w", domains[i].Spec.DomainName, err)
+		}
+
+		reports = append(reports, checkDomain(ctx, c, &domains[i])...)
+	}
+
+	if *output == outputJSON {
+		err = printCheckJSON(os.Stdout, reports)
+	} else {
+		err = printCheckTable(os.Stdout, reports)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, report := range reports {
+		if !report.OK {
+			return errChecksFailed
+		}
+	}
+
+	return nil
+}
+
+// domainChecker returns the checker of a domain. Like the operator, the DNS
+// settings of a Domain override the flags.
+func domainChecker(pool *resolver.Pool, mode string, policy checker.Policy, domain *corev1alpha1.Domain) (*checker.DNSChecker, error) {
+	if quorum := domain.Spec.DNS.Quorum; quorum != nil {
+		policy = checker.PolicyFromSpec(*quorum)
+		if err := policy.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	resolvers, err := pool.Resolvers(domain.Spec.DNS.Resolvers...)
+	if err != nil {
+		return nil, err
+	}
+
+	if domain.Spec.DNS.Mode != "" {
+		mode = domain.Spec.DNS.Mode
+	}
+
+	if mode == checker.ModeAuthoritative {
+		return checker.NewAuthoritativeDNSChecker(pool.Nameserver, resolvers...).WithPolicy(policy), nil
+	}
+
+	return checker.NewDNSChecker(resolvers...).WithPolicy(policy), nil
+}
+
+func checkDomain(ctx context.Context, c *checker.DNSChecker, domain *corev1alpha1.Domain) []checkReport {
+	var reports []checkReport
+
+	add := func(check string, stats checker.DNSCheckStats) {
+		reports = append(reports, checkReport{
+			Domain:  domain.Spec.DomainName,
+			Check:   check,
+			OK:      stats.Result(),
+			CntOK:   stats.CntOK,
+			CntKO:   stats.CntKO,
+			CntErr:  stats.CntErr,
+			Reason:  stats.Reason,
+			Results: stats.Results,
+
+			Inconsistent: stats.Inconsistent,
+			DNSSEC:       stats.DNSSEC,
+		})
+	}
+
+	for _, selector := range domain.DKimSelectors() {
+		add(records.CheckDKIM+"/"+selector.Selector, c.CheckDKimSelector(ctx, domain, selector))
+	}
+	add(records.CheckSPF, c.CheckDomainSPF(ctx, domain))
+	add(records.CheckDMARC, c.CheckDomainDMARC(ctx, domain))
+	add(records.CheckStats, c.CheckDomainStatsDNS(ctx, domain))
+
+	return reports
+}
+
+func printCheckJSON(w io.Writer, reports []checkReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
+
+func printCheckTable(w io.Writer, reports []checkReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "DOMAIN\tCHECK\tRESOLVER\tRESULT\tLATENCY\tTTL\tVALUE\tREASON")
+	for _, report := range reports {
+		for _, res := range report.Results {
+			ttl := "-"
+			if res.TTL != nil {
+				ttl = res.TTL.String()
+			}
+
+			reason := res.Reason
+			if res.Error != "" {
+				reason = res.Error
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", report.Domain, report.Check, res.Resolver, resultString(res),
+				res.Latency.Round(time.Millisecond), ttl, res.Value, reason)
+		}
+	}
+
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "DOMAIN\tCHECK\tRESULT\tOK\tKO\tERR\tDNSSEC\tREASON")
+	for _, report := range reports {
+		result := "FAIL"
+		if report.OK {
+			result = "OK"
+		}
+		if report.Inconsistent {
+			result += " (inconsistent)"
+		}
+
+		dnssec := "-"
+		if report.DNSSEC != "" {
+			dnssec = string(report.DNSSEC)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\n", report.Domain, report.Check, result, report.CntOK, report.CntKO, report.CntErr, dnssec, report.Reason)
+	}
+
+	return tw.Flush()
+}
+
+func resultString(res checker.ResolverResult) string {
+	switch {
+	case res.OK:
+		return "OK"
+	case res.Unhealthy:
+		return "UNHEALTHY"
+	case res.Lame:
+		return "LAME"
+	case res.Error != "":
+		return "ERROR"
+	default:
+		return "FAIL"
+	}
+}
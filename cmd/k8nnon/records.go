@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+	"github.com/kannon-email/k8nnon/internal/dns/records"
+)
+
+func runRecords(args []string) error {
+	fs := flag.NewFlagSet("records", flag.ExitOnError)
+	file := fs.String("f", "", "read Domains from a YAML file (- for stdin) instead of the cluster")
+	namespace := fs.String("n", "default", "namespace of the Domains")
+	allNamespaces := fs.Bool("A", false, "list Domains in all namespaces")
+	output := fs.String("o", records.FormatBIND, "output format, one of "+strings.Join(records.Formats, ", "))
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: k8nnon records [flags] [domain...]\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var domains []corev1alpha1.Domain
+	var err error
+	if *file != "" {
+		domains, err = readDomainsFile(*file, fs.Args())
+	} else {
+		ns := *namespace
+		if *allNamespaces {
+			ns = ""
+		}
+		domains, err = readDomainsCluster(context.Background(), ns, fs.Args())
+	}
+	if err != nil {
+		return err
+	}
+
+	zones := make([]records.Zone, 0, len(domains))
+	for i := range domains {
+		zones = append(zones, records.ZoneFor(&domains[i]))
+	}
+
+	return records.Export(os.Stdout, *output, zones)
+}
+
+// readDomainsCluster reads Domains from the cluster of the current
+// kubeconfig. When names is empty all the Domains in namespace are returned.
+func readDomainsCluster(ctx context.Context, namespace string, names []string) ([]corev1alpha1.Domain, error) {
+	c, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		list := &corev1alpha1.DomainList{}
+		if err := c.List(ctx, list, client.InNamespace(namespace)); err != nil {
+			return nil, err
+		}
+		return list.Items, nil
+	}
+
+	if namespace == "" {
+		return nil, errors.New("domain names cannot be used with -A")
+	}
+
+	var domains []corev1alpha1.Domain
+	for _, name := range names {
+		domain := corev1alpha1.Domain{}
+		if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, &domain); err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain)
+	}
+
+	return domains, nil
+}
+
+// readDomainsFile reads the Domains of a multi-document YAML file. When
+// names is not empty only the matching Domains are returned.
+func readDomainsFile(path string, names []string) ([]corev1alpha1.Domain, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	var domains []corev1alpha1.Domain
+	dec := utilyaml.NewYAMLOrJSONDecoder(bufio.NewReader(r), 4096)
+	for {
+		domain := corev1alpha1.Domain{}
+		err := dec.Decode(&domain)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if domain.Kind != "Domain" || domain.Spec.DomainName == "" {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[domain.Name] {
+			continue
+		}
+
+		domains = append(domains, domain)
+	}
+
+	return domains, nil
+}
+
+func newClient() (client.Client, error) {
+	scheme := runtime.NewScheme()
+	if err := corev1alpha1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	config, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.New(config, client.Options{Scheme: scheme})
+}
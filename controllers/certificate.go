@@ -0,0 +1,275 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+)
+
+// certificateGVK is the cert-manager Certificate, handled as unstructured
+// objects so that cert-manager is only needed by the domains issuing a
+// certificate.
+var certificateGVK = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+
+// Event reasons of the certificate actions.
+const (
+	EventCertificateCreated = "CertificateCreated"
+	EventCertificateUpdated = "CertificateUpdated"
+	EventCertificateDeleted = "CertificateDeleted"
+)
+
+func newCertificate() *unstructured.Unstructured {
+	cert := &unstructured.Unstructured{}
+	cert.SetGroupVersionKind(certificateGVK)
+	return cert
+}
+
+func statsHost(domain *corev1alpha1.Domain) string {
+	return fmt.Sprintf("%s.%s", domain.Spec.StatsPrefix, domain.Spec.DomainName)
+}
+
+func certificateName(domain *corev1alpha1.Domain) string {
+	return fmt.Sprintf("%s-stats", domain.Name)
+}
+
+// tlsSecretName returns the secret of the certificate of the stats host.
+func tlsSecretName(domain *corev1alpha1.Domain) string {
+	if tls := domain.Spec.Ingress.TLS; tls != nil && tls.SecretName != "" {
+		return tls.SecretName
+	}
+
+	return fmt.Sprintf("%s-tls", statsHost(domain))
+}
+
+func issuesCertificate(domain *corev1alpha1.Domain) bool {
+	return domain.Spec.Ingress.TLS != nil && domain.Spec.Ingress.TLS.IssuerRef != nil
+}
+
+// reconcileCertificate creates the Certificate of the stats host once the
+// stats CNAME is verified, so that the ACME challenges can succeed, and
+// reports its readiness in the domain status. The Certificate is kept when
+// the CNAME check fails afterwards, issuing it again could hit the rate
+// limits of the issuer. Only the fields set by the operator are updated, and
+// a Certificate of the same name not controlled by the domain is left alone.
+func (r *DomainReconciler) reconcileCertificate(ctx context.Context, domain *corev1alpha1.Domain, l logr.Logger) error {
+	// Only look for a Certificate to delete when the domain had one, so
+	// that the domains without TLS settings do not need cert-manager.
+	if !issuesCertificate(domain) && domain.Status.Certificate == nil {
+		return nil
+	}
+
+	name := certificateName(domain)
+
+	cert := newCertificate()
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: domain.Namespace}, cert)
+	found := err == nil
+
+	if !issuesCertificate(domain) {
+		domain.Status.Certificate = nil
+		if err != nil {
+			return client.IgnoreNotFound(ignoreNoMatch(err))
+		}
+		return r.deleteCertificate(ctx, cert, domain)
+	}
+
+	status := &corev1alpha1.CertificateStatus{Name: name, SecretName: tlsSecretName(domain)}
+	domain.Status.Certificate = status
+
+	switch {
+	case meta.IsNoMatchError(err):
+		status.Reason = ReasonCertManagerMissing
+		status.Message = "the cert-manager Certificate CRD is not installed"
+		return nil
+	case err != nil && !apierrors.IsNotFound(err):
+		return err
+	}
+
+	desired := certificateSpec(domain)
+
+	if !found {
+		if !domain.Status.DNS.Stats.OK {
+			status.Reason = ReasonWaitingForDNS
+			status.Message = "the certificate is requested once the stats CNAME is verified"
+			return nil
+		}
+
+		cert.SetName(name)
+		cert.SetNamespace(domain.Namespace)
+		cert.Object["spec"] = desired
+		if err := ctrl.SetControllerReference(domain, cert, r.Scheme); err != nil {
+			return err
+		}
+
+		l.Info("creating certificate", "certificate", name)
+		if err := r.Create(ctx, cert); err != nil {
+			return err
+		}
+
+		r.Recorder.Eventf(domain, corev1.EventTypeNormal, EventCertificateCreated, "created certificate %s for %s", name, statsHost(domain))
+	} else if !v1.IsControlledBy(cert, domain) {
+		status.Reason = ReasonCertificateNotOwned
+		status.Message = fmt.Sprintf("certificate %s exists and is not controlled by the domain", name)
+		return nil
+	} else if changed, err := setManagedFields(cert, desired); err != nil {
+		return err
+	} else if changed {
+		l.Info("updating certificate", "certificate", name)
+		if err := r.Update(ctx, cert); err != nil {
+			return err
+		}
+
+		r.Recorder.Eventf(domain, corev1.EventTypeNormal, EventCertificateUpdated, "updated certificate %s", name)
+	}
+
+	setCertificateReadiness(status, cert)
+	return nil
+}
+
+// setCertificateError reports a failure to reconcile the Certificate.
+func setCertificateError(domain *corev1alpha1.Domain, err error) {
+	if !issuesCertificate(domain) {
+		return
+	}
+
+	domain.Status.Certificate = &corev1alpha1.CertificateStatus{
+		Name:       certificateName(domain),
+		SecretName: tlsSecretName(domain),
+		Reason:     ReasonCertificateFailed,
+		Message:    err.Error(),
+	}
+}
+
+// deleteCertificate deletes the Certificate created by the operator when
+// the spec no longer configures an issuer.
+func (r *DomainReconciler) deleteCertificate(ctx context.Context, cert *unstructured.Unstructured, domain *corev1alpha1.Domain) error {
+	if !v1.IsControlledBy(cert, domain) || cert.GetDeletionTimestamp() != nil {
+		return nil
+	}
+
+	if err := r.Delete(ctx, cert); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	r.Recorder.Eventf(domain, corev1.EventTypeNormal, EventCertificateDeleted, "deleted certificate %s, no issuer is configured", cert.GetName())
+	return nil
+}
+
+// certificateSpec returns the spec of the Certificate, with the types of
+// decoded JSON so that it compares with the spec read from the cluster.
+func certificateSpec(domain *corev1alpha1.Domain) map[string]interface{} {
+	issuer := domain.Spec.Ingress.TLS.IssuerRef
+
+	kind := issuer.Kind
+	if kind == "" {
+		kind = "Issuer"
+	}
+	group := issuer.Group
+	if group == "" {
+		group = certificateGVK.Group
+	}
+
+	return map[string]interface{}{
+		"secretName": tlsSecretName(domain),
+		"dnsNames":   []interface{}{statsHost(domain)},
+		"issuerRef": map[string]interface{}{
+			"name":  issuer.Name,
+			"kind":  kind,
+			"group": group,
+		},
+	}
+}
+
+// setManagedFields sets the spec fields of desired on obj, keeping the other
+// fields of its spec which may be set by users or defaulted by the API
+// server, and reports whether any of them changed.
+func setManagedFields(obj *unstructured.Unstructured, desired map[string]interface{}) (bool, error) {
+	changed := false
+	for field, value := range desired {
+		current, found, err := unstructured.NestedFieldNoCopy(obj.Object, "spec", field)
+		if err != nil {
+			return false, err
+		}
+		if found && equality.Semantic.DeepEqual(current, value) {
+			continue
+		}
+
+		if err := unstructured.SetNestedField(obj.Object, value, "spec", field); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// setCertificateReadiness copies the Ready condition of the Certificate.
+func setCertificateReadiness(status *corev1alpha1.CertificateStatus, cert *unstructured.Unstructured) {
+	status.Reason = ReasonCertificatePending
+	status.Message = "waiting for cert-manager to issue the certificate"
+
+	if notAfter, ok, _ := unstructured.NestedString(cert.Object, "status", "notAfter"); ok {
+		if t, err := time.Parse(time.RFC3339, notAfter); err == nil {
+			status.NotAfter = &v1.Time{Time: t}
+		}
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(cert.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != "Ready" {
+			continue
+		}
+
+		if condition["status"] == string(v1.ConditionTrue) {
+			status.Ready = true
+			status.Reason = ReasonCertificateIssued
+			status.Message = fmt.Sprintf("certificate %s is issued", status.Name)
+		} else if message, _ := condition["message"].(string); message != "" {
+			status.Message = message
+		}
+	}
+}
+
+// hasKind reports whether the API server serves a kind, an optional
+// dependency such as cert-manager may not be installed.
+func hasKind(mapper meta.RESTMapper, gvk schema.GroupVersionKind) bool {
+	_, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	return err == nil
+}
+
+func ignoreNoMatch(err error) error {
+	if meta.IsNoMatchError(err) {
+		return nil
+	}
+	return err
+}
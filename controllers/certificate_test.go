@@ -0,0 +1,197 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+)
+
+// noCertManagerClient fails like the API server when cert-manager is not
+// installed, the fake client serves any kind.
+type noCertManagerClient struct {
+	client.Client
+}
+
+func (c noCertManagerClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if obj.GetObjectKind().GroupVersionKind() == certificateGVK {
+		return &meta.NoKindMatchError{GroupKind: certificateGVK.GroupKind(), SearchedVersions: []string{certificateGVK.Version}}
+	}
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+func newCertificateReconciler(t *testing.T, certManager bool) *DomainReconciler {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, corev1alpha1.AddToScheme(scheme))
+
+	var c client.Client = fake.NewClientBuilder().WithScheme(scheme).Build()
+	if !certManager {
+		c = noCertManagerClient{c}
+	}
+
+	return &DomainReconciler{
+		Client:   c,
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(10),
+	}
+}
+
+func certificateDomain() *corev1alpha1.Domain {
+	return &corev1alpha1.Domain{
+		ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "example", UID: "uid"},
+		Spec: corev1alpha1.DomainSpec{
+			DomainName:  "example.com",
+			StatsPrefix: "stats",
+			Ingress: corev1alpha1.DomainIngressSpec{
+				TLS: &corev1alpha1.DomainTLSSpec{
+					IssuerRef: &corev1alpha1.TLSIssuerRef{Name: "letsencrypt", Kind: "ClusterIssuer"},
+				},
+			},
+		},
+	}
+}
+
+func TestReconcileCertificate(t *testing.T) {
+	ctx := context.Background()
+	r := newCertificateReconciler(t, true)
+	domain := certificateDomain()
+	key := types.NamespacedName{Namespace: "default", Name: "example-stats"}
+
+	// The certificate waits for the stats CNAME.
+	assert.Nil(t, r.reconcileCertificate(ctx, domain, logr.Discard()))
+	assert.Equal(t, ReasonWaitingForDNS, domain.Status.Certificate.Reason)
+	assert.True(t, apierrors.IsNotFound(r.Get(ctx, key, newCertificate())))
+
+	domain.Status.DNS.Stats.OK = true
+	assert.Nil(t, r.reconcileCertificate(ctx, domain, logr.Discard()))
+	assert.Equal(t, ReasonCertificatePending, domain.Status.Certificate.Reason)
+
+	cert := newCertificate()
+	assert.Nil(t, r.Get(ctx, key, cert))
+	assert.Equal(t, map[string]interface{}{
+		"secretName": "stats.example.com-tls",
+		"dnsNames":   []interface{}{"stats.example.com"},
+		"issuerRef":  map[string]interface{}{"name": "letsencrypt", "kind": "ClusterIssuer", "group": "cert-manager.io"},
+	}, cert.Object["spec"])
+	assert.True(t, v1.IsControlledBy(cert, domain))
+
+	cert.Object["status"] = map[string]interface{}{
+		"notAfter":   "2026-01-01T00:00:00Z",
+		"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "True"}},
+	}
+	assert.Nil(t, r.Update(ctx, cert))
+
+	// The certificate is kept when the CNAME check fails.
+	domain.Status.DNS.Stats.OK = false
+	assert.Nil(t, r.reconcileCertificate(ctx, domain, logr.Discard()))
+	assert.True(t, domain.Status.Certificate.Ready)
+	assert.Equal(t, 2026, domain.Status.Certificate.NotAfter.Year())
+
+	condition, issued := certificateCondition(domain)
+	assert.True(t, issued)
+	assert.Equal(t, v1.ConditionTrue, condition.Status)
+
+	domain.Spec.Ingress.TLS = nil
+	assert.Nil(t, r.reconcileCertificate(ctx, domain, logr.Discard()))
+	assert.Nil(t, domain.Status.Certificate)
+	assert.True(t, apierrors.IsNotFound(r.Get(ctx, key, &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cert-manager.io/v1", "kind": "Certificate",
+	}})))
+}
+
+func TestReconcileCertificateWithoutCertManager(t *testing.T) {
+	ctx := context.Background()
+	r := newCertificateReconciler(t, false)
+	domain := certificateDomain()
+	domain.Status.DNS.Stats.OK = true
+
+	assert.Nil(t, r.reconcileCertificate(ctx, domain, logr.Discard()))
+	assert.Equal(t, ReasonCertManagerMissing, domain.Status.Certificate.Reason)
+
+	ok := corev1alpha1.DNSStatusStats{OK: true, CntOK: 3}
+	domain.Status.DNS = corev1alpha1.DNSStatus{Stats: ok, DKIM: ok, SFP: ok, DMARC: ok}
+	setDomainConditions(domain, nil)
+
+	ready := meta.FindStatusCondition(domain.Status.Conditions, corev1alpha1.ConditionReady)
+	assert.Equal(t, v1.ConditionFalse, ready.Status)
+	assert.Equal(t, ReasonCertificateNotReady, ready.Reason)
+
+	domain.Spec.Ingress.TLS = nil
+	assert.Nil(t, r.reconcileCertificate(ctx, domain, logr.Discard()))
+	assert.Nil(t, domain.Status.Certificate)
+}
+
+func TestReconcileCertificateKeepsFields(t *testing.T) {
+	ctx := context.Background()
+	r := newCertificateReconciler(t, true)
+	domain := certificateDomain()
+	domain.Status.DNS.Stats.OK = true
+	key := types.NamespacedName{Namespace: "default", Name: "example-stats"}
+
+	assert.Nil(t, r.reconcileCertificate(ctx, domain, logr.Discard()))
+
+	cert := newCertificate()
+	assert.Nil(t, r.Get(ctx, key, cert))
+	assert.Nil(t, unstructured.SetNestedField(cert.Object, "720h", "spec", "renewBefore"))
+	assert.Nil(t, r.Update(ctx, cert))
+
+	domain.Spec.Ingress.TLS.IssuerRef.Name = "staging"
+	assert.Nil(t, r.reconcileCertificate(ctx, domain, logr.Discard()))
+
+	cert = newCertificate()
+	assert.Nil(t, r.Get(ctx, key, cert))
+	issuer, _, _ := unstructured.NestedString(cert.Object, "spec", "issuerRef", "name")
+	assert.Equal(t, "staging", issuer)
+	renewBefore, _, _ := unstructured.NestedString(cert.Object, "spec", "renewBefore")
+	assert.Equal(t, "720h", renewBefore)
+}
+
+func TestReconcileCertificateNotOwned(t *testing.T) {
+	ctx := context.Background()
+	r := newCertificateReconciler(t, true)
+	domain := certificateDomain()
+	domain.Status.DNS.Stats.OK = true
+	key := types.NamespacedName{Namespace: "default", Name: "example-stats"}
+
+	foreign := newCertificate()
+	foreign.SetName(key.Name)
+	foreign.SetNamespace(key.Namespace)
+	foreign.Object["spec"] = map[string]interface{}{"secretName": "other-tls"}
+	assert.Nil(t, r.Create(ctx, foreign))
+
+	assert.Nil(t, r.reconcileCertificate(ctx, domain, logr.Discard()))
+	assert.Equal(t, ReasonCertificateNotOwned, domain.Status.Certificate.Reason)
+	assert.False(t, domain.Status.Certificate.Ready)
+
+	cert := newCertificate()
+	assert.Nil(t, r.Get(ctx, key, cert))
+	assert.Equal(t, map[string]interface{}{"secretName": "other-tls"}, cert.Object["spec"])
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+	"github.com/kannon-email/k8nnon/internal/dns/resolver"
+)
+
+// Condition reasons reported on Domain conditions.
+const (
+	ReasonRecordVerified    = "RecordVerified"
+	ReasonRecordNotVerified = "RecordNotVerified"
+	ReasonLookupFailed      = "LookupFailed"
+	ReasonInconsistent      = "InconsistentNameservers"
+	ReasonDNSSECBogus       = "DNSSECBogus"
+
+	ReasonIngressReconciled   = "IngressReconciled"
+	ReasonWaitingForDNS       = "WaitingForStatsDNS"
+	ReasonIngressFailed       = "IngressReconcileFailed"
+	ReasonInvalidIngressClass = "InvalidIngressClass"
+	ReasonInvalidRouting      = "InvalidRouting"
+	ReasonGatewayAPIMissing   = "GatewayAPINotInstalled"
+
+	ReasonCertificateIssued   = "CertificateIssued"
+	ReasonCertificatePending  = "CertificatePending"
+	ReasonCertificateFailed   = "CertificateReconcileFailed"
+	ReasonCertManagerMissing  = "CertManagerNotInstalled"
+	ReasonCertificateNotOwned = "CertificateNotOwned"
+
+	ReasonDomainReady         = "DomainReady"
+	ReasonChecksFailing       = "ChecksFailing"
+	ReasonIngressPending      = "IngressNotReady"
+	ReasonCertificateNotReady = "CertificateNotReady"
+	ReasonInvalidResolvers    = "InvalidResolvers"
+	ReasonInvalidQuorum       = "InvalidQuorum"
+	ReasonInvalidDKimSecret   = "InvalidDKIMSecret"
+)
+
+// setDomainConditions updates the status conditions of the domain from the
+// DNS check results and the outcome of the ingress reconciliation.
+func setDomainConditions(domain *corev1alpha1.Domain, ingressErr error) {
+	dns := domain.Status.DNS
+	checks := []struct {
+		conditionType string
+		stats         corev1alpha1.DNSStatusStats
+	}{
+		{corev1alpha1.ConditionDKIMVerified, dns.DKIM},
+		{corev1alpha1.ConditionSPFVerified, dns.SFP},
+		{corev1alpha1.ConditionDMARCVerified, dns.DMARC},
+		{corev1alpha1.ConditionStatsDNSVerified, dns.Stats},
+	}
+
+	var failing []string
+	for _, c := range checks {
+		condition := dnsCheckCondition(c.conditionType, c.stats)
+		setCondition(domain, condition)
+
+		if condition.Status != v1.ConditionTrue {
+			failing = append(failing, c.conditionType)
+		}
+	}
+
+	ingress := ingressCondition(domain, ingressErr)
+	setCondition(domain, ingress)
+
+	certificate, issued := certificateCondition(domain)
+	if issued {
+		setCondition(domain, certificate)
+	} else {
+		meta.RemoveStatusCondition(&domain.Status.Conditions, corev1alpha1.ConditionCertificateReady)
+	}
+
+	ready := v1.Condition{
+		Type:    corev1alpha1.ConditionReady,
+		Status:  v1.ConditionTrue,
+		Reason:  ReasonDomainReady,
+		Message: "all DNS records are verified and the stats ingress is ready",
+	}
+
+	if len(failing) > 0 {
+		ready.Status = v1.ConditionFalse
+		ready.Reason = ReasonChecksFailing
+		ready.Message = fmt.Sprintf("failing checks: %s", strings.Join(failing, ", "))
+	} else if ingress.Status != v1.ConditionTrue {
+		ready.Status = v1.ConditionFalse
+		ready.Reason = ReasonIngressPending
+		ready.Message = ingress.Message
+	} else if issued && certificate.Status != v1.ConditionTrue {
+		ready.Status = v1.ConditionFalse
+		ready.Reason = ReasonCertificateNotReady
+		ready.Message = certificate.Message
+	}
+
+	setCondition(domain, ready)
+}
+
+// setInvalidDNSSpecCondition marks the domain as not ready because the DNS
+// settings of its spec, or the DKIM Secrets they refer to, are invalid,
+// leaving the other conditions as they are since no check could be run.
+func setInvalidDNSSpecCondition(domain *corev1alpha1.Domain, reason string, err error) {
+	setCondition(domain, v1.Condition{
+		Type:    corev1alpha1.ConditionReady,
+		Status:  v1.ConditionFalse,
+		Reason:  reason,
+		Message: err.Error(),
+	})
+}
+
+func dnsCheckCondition(conditionType string, stats corev1alpha1.DNSStatusStats) v1.Condition {
+	total := stats.CntOK + stats.CntKO + stats.CntErr
+
+	if stats.OK {
+		return v1.Condition{
+			Type:    conditionType,
+			Status:  v1.ConditionTrue,
+			Reason:  ReasonRecordVerified,
+			Message: fmt.Sprintf("record verified by %d of %d resolvers", stats.CntOK, total),
+		}
+	}
+
+	reason := ReasonRecordNotVerified
+	if stats.Inconsistent {
+		reason = ReasonInconsistent
+	} else if stats.DNSSEC == string(resolver.DNSSECBogus) {
+		reason = ReasonDNSSECBogus
+	} else if stats.CntErr*2 > total {
+		reason = ReasonLookupFailed
+	}
+
+	message := stats.Reason
+	if message == "" {
+		message = fmt.Sprintf("record verified by %d of %d resolvers", stats.CntOK, total)
+	}
+
+	return v1.Condition{
+		Type:    conditionType,
+		Status:  v1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	}
+}
+
+func ingressCondition(domain *corev1alpha1.Domain, ingressErr error) v1.Condition {
+	var routingErr *invalidRoutingError
+
+	switch {
+	case errors.As(ingressErr, &routingErr):
+		return v1.Condition{
+			Type:    corev1alpha1.ConditionIngressReady,
+			Status:  v1.ConditionFalse,
+			Reason:  routingErr.reason,
+			Message: routingErr.Error(),
+		}
+	case ingressErr != nil:
+		return v1.Condition{
+			Type:    corev1alpha1.ConditionIngressReady,
+			Status:  v1.ConditionFalse,
+			Reason:  ReasonIngressFailed,
+			Message: ingressErr.Error(),
+		}
+	case !domain.Status.DNS.Stats.OK:
+		return v1.Condition{
+			Type:    corev1alpha1.ConditionIngressReady,
+			Status:  v1.ConditionFalse,
+			Reason:  ReasonWaitingForDNS,
+			Message: "the stats ingress is created once the stats CNAME is verified",
+		}
+	default:
+		return v1.Condition{
+			Type:    corev1alpha1.ConditionIngressReady,
+			Status:  v1.ConditionTrue,
+			Reason:  ReasonIngressReconciled,
+			Message: fmt.Sprintf("%s %s is up to date", routingKind(domain), statsIngressName(domain)),
+		}
+	}
+}
+
+// certificateCondition returns the CertificateReady condition, it reports
+// false when the domain does not issue a certificate.
+func certificateCondition(domain *corev1alpha1.Domain) (v1.Condition, bool) {
+	status := domain.Status.Certificate
+	if !issuesCertificate(domain) || status == nil {
+		return v1.Condition{}, false
+	}
+
+	condition := v1.Condition{
+		Type:    corev1alpha1.ConditionCertificateReady,
+		Status:  v1.ConditionFalse,
+		Reason:  status.Reason,
+		Message: status.Message,
+	}
+	if status.Ready {
+		condition.Status = v1.ConditionTrue
+	}
+
+	return condition, true
+}
+
+func routingKind(domain *corev1alpha1.Domain) string {
+	if usesHTTPRoute(domain) {
+		return "HTTPRoute"
+	}
+	return "ingress"
+}
+
+func setCondition(domain *corev1alpha1.Domain, condition v1.Condition) {
+	condition.ObservedGeneration = domain.Generation
+	meta.SetStatusCondition(&domain.Status.Conditions, condition)
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+)
+
+func TestSetDomainConditionsReady(t *testing.T) {
+	ok := corev1alpha1.DNSStatusStats{OK: true, CntOK: 3}
+	domain := &corev1alpha1.Domain{
+		Status: corev1alpha1.DomainStatus{
+			DNS: corev1alpha1.DNSStatus{Stats: ok, DKIM: ok, SFP: ok, DMARC: ok},
+		},
+	}
+
+	setDomainConditions(domain, nil)
+
+	assert.True(t, meta.IsStatusConditionTrue(domain.Status.Conditions, corev1alpha1.ConditionReady))
+	assert.True(t, meta.IsStatusConditionTrue(domain.Status.Conditions, corev1alpha1.ConditionIngressReady))
+	assert.Len(t, domain.Status.Conditions, 6)
+}
+
+func TestSetDomainConditionsFailing(t *testing.T) {
+	ok := corev1alpha1.DNSStatusStats{OK: true, CntOK: 3}
+	domain := &corev1alpha1.Domain{
+		Status: corev1alpha1.DomainStatus{
+			DNS: corev1alpha1.DNSStatus{
+				Stats: ok,
+				DKIM:  ok,
+				SFP:   corev1alpha1.DNSStatusStats{CntKO: 3, Reason: "no SPF record found"},
+				DMARC: corev1alpha1.DNSStatusStats{CntKO: 1, CntErr: 2, Reason: "timeout"},
+			},
+		},
+	}
+
+	setDomainConditions(domain, nil)
+
+	spf := meta.FindStatusCondition(domain.Status.Conditions, corev1alpha1.ConditionSPFVerified)
+	assert.Equal(t, v1.ConditionFalse, spf.Status)
+	assert.Equal(t, ReasonRecordNotVerified, spf.Reason)
+	assert.Equal(t, "no SPF record found", spf.Message)
+
+	dmarc := meta.FindStatusCondition(domain.Status.Conditions, corev1alpha1.ConditionDMARCVerified)
+	assert.Equal(t, ReasonLookupFailed, dmarc.Reason)
+
+	ready := meta.FindStatusCondition(domain.Status.Conditions, corev1alpha1.ConditionReady)
+	assert.Equal(t, v1.ConditionFalse, ready.Status)
+	assert.Equal(t, ReasonChecksFailing, ready.Reason)
+	assert.Equal(t, "failing checks: SPFVerified, DMARCVerified", ready.Message)
+}
+
+func TestSetDomainConditionsIngressError(t *testing.T) {
+	ok := corev1alpha1.DNSStatusStats{OK: true, CntOK: 3}
+	domain := &corev1alpha1.Domain{
+		Status: corev1alpha1.DomainStatus{
+			DNS: corev1alpha1.DNSStatus{Stats: ok, DKIM: ok, SFP: ok, DMARC: ok},
+		},
+	}
+
+	setDomainConditions(domain, errors.New("forbidden"))
+
+	ready := meta.FindStatusCondition(domain.Status.Conditions, corev1alpha1.ConditionReady)
+	assert.Equal(t, v1.ConditionFalse, ready.Status)
+	assert.Equal(t, ReasonIngressPending, ready.Reason)
+	assert.Equal(t, "forbidden", ready.Message)
+}
+
+func TestSetInvalidDNSSpecCondition(t *testing.T) {
+	domain := &corev1alpha1.Domain{}
+
+	setInvalidDNSSpecCondition(domain, ReasonInvalidResolvers, errors.New("invalid resolver address"))
+
+	ready := meta.FindStatusCondition(domain.Status.Conditions, corev1alpha1.ConditionReady)
+	assert.Equal(t, v1.ConditionFalse, ready.Status)
+	assert.Equal(t, ReasonInvalidResolvers, ready.Reason)
+	assert.Equal(t, "invalid resolver address", ready.Message)
+}
+
+func TestDNSCheckConditionDNSSECBogus(t *testing.T) {
+	stats := corev1alpha1.DNSStatusStats{CntKO: 3, DNSSEC: "bogus", Reason: "DNSSEC validation failed for the records of example.com"}
+
+	condition := dnsCheckCondition(corev1alpha1.ConditionSPFVerified, stats)
+	assert.Equal(t, v1.ConditionFalse, condition.Status)
+	assert.Equal(t, ReasonDNSSECBogus, condition.Reason)
+}
+
+func TestDNSCheckConditionInconsistent(t *testing.T) {
+	stats := corev1alpha1.DNSStatusStats{CntOK: 1, CntKO: 1, Inconsistent: true, Reason: "no DMARC record found"}
+
+	condition := dnsCheckCondition(corev1alpha1.ConditionDMARCVerified, stats)
+	assert.Equal(t, v1.ConditionFalse, condition.Status)
+	assert.Equal(t, ReasonInconsistent, condition.Reason)
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+	"github.com/kannon-email/k8nnon/internal/dkim"
+)
+
+const (
+	DomainLabel       = "k8s.kannon.email/domain"
+	DKimSelectorLabel = "k8s.kannon.email/dkim-selector"
+	// DKimRotationLabel marks the Secrets of the selectors minted by the
+	// key rotation.
+	DKimRotationLabel = "k8s.kannon.email/dkim-rotation"
+
+	DKimSecretPrivateKey = "privateKey"
+	DKimSecretPublicKey  = "publicKey"
+	DKimSecretKeyType    = "keyType"
+	DKimSecretSelector   = "selector"
+)
+
+// invalidDKimSecretError reports a DKIM Secret the operator refuses to
+// overwrite, as it may hold a key that is still published.
+type invalidDKimSecretError struct {
+	secret string
+	msg    string
+}
+
+func (e *invalidDKimSecretError) Error() string {
+	return fmt.Sprintf("dkim secret %s: %s", e.secret, e.msg)
+}
+
+func isInvalidDKimSecret(err error) bool {
+	var secretErr *invalidDKimSecretError
+	return goerrors.As(err, &secretErr)
+}
+
+// reconcileDKimKeys makes sure every DKIM selector without a public key in
+// the spec has an operator generated key pair stored in a Secret, and
+// publishes the public keys in the domain status.
+func (r *DomainReconciler) reconcileDKimKeys(ctx context.Context, domain *corev1alpha1.Domain, l logr.Logger) error {
+	var managedKeys []corev1alpha1.DKimManagedKey
+	secrets := map[string]bool{}
+
+	selectors := append(domain.Spec.DKim.AllSelectors(), domain.RotatedSelectors()...)
+
+	for _, selector := range selectors {
+		// Secrets are kept as long as the selector exists, so that setting
+		// the public key in the spec does not drop the private key.
+		secrets[dkimSecretName(domain, selector.Selector)] = true
+
+		if selector.PublicKey != "" {
+			continue
+		}
+
+		key, err := r.reconcileDKimKey(ctx, domain, selector, l)
+		if err != nil {
+			return err
+		}
+
+		managedKeys = append(managedKeys, key)
+	}
+
+	domain.Status.DKim.ManagedKeys = managedKeys
+
+	return r.cleanupDKimSecrets(ctx, domain, secrets, l)
+}
+
+func (r *DomainReconciler) reconcileDKimKey(ctx context.Context, domain *corev1alpha1.Domain, selector corev1alpha1.DKimSelector, l logr.Logger) (corev1alpha1.DKimManagedKey, error) {
+	name := dkimSecretName(domain, selector.Selector)
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: domain.Namespace}, secret)
+	if err != nil && !errors.IsNotFound(err) {
+		return corev1alpha1.DKimManagedKey{}, err
+	}
+
+	var publicKey string
+	if err == nil {
+		// An existing key may be published and signing mails, it is never
+		// replaced: a different key needs a new selector or the Secret to
+		// be deleted.
+		publicKey, err = existingDKimKey(domain, selector, secret)
+	} else {
+		publicKey, err = r.createDKimKey(ctx, domain, selector, name, l)
+	}
+	if err != nil {
+		return corev1alpha1.DKimManagedKey{}, err
+	}
+
+	return corev1alpha1.DKimManagedKey{
+		Selector:   selector.Selector,
+		KeyType:    selector.KeyType,
+		PublicKey:  publicKey,
+		SecretName: name,
+		RecordName: dkim.RecordName(selector.Selector, domain.Spec.DomainName),
+		Record:     dkim.Record(selector.KeyType, publicKey),
+	}, nil
+}
+
+// existingDKimKey returns the public key of a DKIM Secret of the domain.
+func existingDKimKey(domain *corev1alpha1.Domain, selector corev1alpha1.DKimSelector, secret *corev1.Secret) (string, error) {
+	if !v1.IsControlledBy(secret, domain) {
+		return "", &invalidDKimSecretError{secret: secret.Name, msg: "not controlled by the domain"}
+	}
+
+	if keyType := string(secret.Data[DKimSecretKeyType]); keyType != selector.KeyType {
+		return "", &invalidDKimSecretError{
+			secret: secret.Name,
+			msg:    fmt.Sprintf("holds a %s key but the selector wants %s, use a new selector or delete the secret", keyType, selector.KeyType),
+		}
+	}
+
+	publicKey, err := dkim.PublicKey(selector.KeyType, secret.Data[DKimSecretPrivateKey])
+	if err != nil {
+		return "", &invalidDKimSecretError{secret: secret.Name, msg: err.Error()}
+	}
+
+	return publicKey, nil
+}
+
+// createDKimKey generates the key pair of a selector and stores it in a new
+// Secret controlled by the domain.
+func (r *DomainReconciler) createDKimKey(ctx context.Context, domain *corev1alpha1.Domain, selector corev1alpha1.DKimSelector, name string, l logr.Logger) (string, error) {
+	privateKey, publicKey, err := dkim.GenerateKey(selector.KeyType)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := r.buildDKimSecret(domain, selector, name)
+	if err != nil {
+		return "", err
+	}
+
+	secret.Data = map[string][]byte{
+		DKimSecretPrivateKey: privateKey,
+		DKimSecretPublicKey:  []byte(publicKey),
+		DKimSecretKeyType:    []byte(selector.KeyType),
+		DKimSecretSelector:   []byte(selector.Selector),
+	}
+
+	if err := r.Create(ctx, secret); err != nil {
+		if errors.IsAlreadyExists(err) {
+			// Only the Secrets with the domain label are cached.
+			return "", &invalidDKimSecretError{secret: name, msg: fmt.Sprintf("exists without the %s label", DomainLabel)}
+		}
+		return "", err
+	}
+
+	l.Info("generated dkim key", "selector", selector.Selector, "keyType", selector.KeyType, "secret", name)
+	return publicKey, nil
+}
+
+func (r *DomainReconciler) buildDKimSecret(domain *corev1alpha1.Domain, selector corev1alpha1.DKimSelector, name string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      name,
+			Namespace: domain.Namespace,
+			Labels: map[string]string{
+				DomainLabel:       domain.Name,
+				DKimSelectorLabel: selector.Selector,
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+	}
+	for _, rotated := range domain.RotatedSelectors() {
+		if rotated.Selector == selector.Selector {
+			secret.Labels[DKimRotationLabel] = "true"
+		}
+	}
+
+	if err := ctrl.SetControllerReference(domain, secret, r.Scheme); err != nil {
+		return secret, err
+	}
+
+	return secret, nil
+}
+
+// cleanupDKimSecrets deletes the DKIM secrets owned by the domain whose
+// selector has been removed from the spec, or retired by the rotation.
+func (r *DomainReconciler) cleanupDKimSecrets(ctx context.Context, domain *corev1alpha1.Domain, keep map[string]bool, l logr.Logger) error {
+	secrets := &corev1.SecretList{}
+	err := r.List(ctx, secrets,
+		client.InNamespace(domain.Namespace),
+		client.MatchingLabels{DomainLabel: domain.Name},
+		client.HasLabels{DKimSelectorLabel},
+	)
+	if err != nil {
+		return err
+	}
+
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if keep[secret.Name] || !v1.IsControlledBy(secret, domain) {
+			continue
+		}
+
+		// The selectors of the rotation are only known from the status,
+		// their keys may still be signing mails until they are retired.
+		selector := secret.Labels[DKimSelectorLabel]
+		if isDKimRotationSecret(domain, secret) && !isRetiredDKimSelector(domain, selector) {
+			l.Info("keeping dkim secret of a rotated selector not retired", "secret", secret.Name)
+			continue
+		}
+
+		l.Info("deleting unused dkim secret", "secret", secret.Name)
+		if err := r.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+
+	clearRetiredDKimSelectors(domain)
+	return nil
+}
+
+// isDKimRotationSecret reports whether a Secret holds the key of a selector
+// minted by the rotation, Secrets created before they were labelled are
+// recognized by the selector prefix.
+func isDKimRotationSecret(domain *corev1alpha1.Domain, secret *corev1.Secret) bool {
+	if secret.Labels[DKimRotationLabel] == "true" {
+		return true
+	}
+
+	return strings.HasPrefix(secret.Labels[DKimSelectorLabel], dkimRotationPrefix(domain.Spec.DKim.Rotation)+"-")
+}
+
+func dkimSecretName(domain *corev1alpha1.Domain, selector string) string {
+	return fmt.Sprintf("%s-dkim-%s", domain.Name, selector)
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+)
+
+func newDKimDomain() *corev1alpha1.Domain {
+	return &corev1alpha1.Domain{
+		ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "example", UID: "uid"},
+		Spec: corev1alpha1.DomainSpec{
+			DomainName: "example.com",
+			DKim: corev1alpha1.DKim{Selectors: []corev1alpha1.DKimSelector{
+				{Selector: "mail", KeyType: corev1alpha1.DKimKeyTypeEd25519},
+			}},
+		},
+	}
+}
+
+func TestReconcileDKimKeysCreateAndReuse(t *testing.T) {
+	domain := newDKimDomain()
+	r := newIngressReconciler(t)
+	ctx := context.Background()
+
+	assert.Nil(t, r.reconcileDKimKeys(ctx, domain, logr.Discard()))
+	assert.Len(t, domain.Status.DKim.ManagedKeys, 1)
+	created := domain.Status.DKim.ManagedKeys[0]
+	assert.Equal(t, "example-dkim-mail", created.SecretName)
+	assert.NotEmpty(t, created.PublicKey)
+
+	secret := &corev1.Secret{}
+	assert.Nil(t, r.Get(ctx, types.NamespacedName{Namespace: "default", Name: created.SecretName}, secret))
+	assert.True(t, v1.IsControlledBy(secret, domain))
+
+	assert.Nil(t, r.reconcileDKimKeys(ctx, domain, logr.Discard()))
+	assert.Equal(t, created, domain.Status.DKim.ManagedKeys[0], "the stored key should be reused")
+}
+
+func TestReconcileDKimKeysKeyTypeMismatch(t *testing.T) {
+	domain := newDKimDomain()
+	r := newIngressReconciler(t)
+	ctx := context.Background()
+
+	assert.Nil(t, r.reconcileDKimKeys(ctx, domain, logr.Discard()))
+	key := types.NamespacedName{Namespace: "default", Name: "example-dkim-mail"}
+	before := &corev1.Secret{}
+	assert.Nil(t, r.Get(ctx, key, before))
+
+	domain.Spec.DKim.Selectors[0].KeyType = corev1alpha1.DKimKeyTypeRSA
+	err := r.reconcileDKimKeys(ctx, domain, logr.Discard())
+	assert.True(t, isInvalidDKimSecret(err), "got %v", err)
+
+	after := &corev1.Secret{}
+	assert.Nil(t, r.Get(ctx, key, after))
+	assert.Equal(t, before.Data, after.Data, "the published key should not be replaced")
+}
+
+func TestReconcileDKimKeysForeignSecret(t *testing.T) {
+	domain := newDKimDomain()
+	foreign := &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "example-dkim-mail"},
+		Data:       map[string][]byte{"privateKey": []byte("not ours")},
+	}
+	r := newIngressReconciler(t, foreign)
+	ctx := context.Background()
+
+	err := r.reconcileDKimKeys(ctx, domain, logr.Discard())
+	assert.True(t, isInvalidDKimSecret(err), "got %v", err)
+
+	secret := &corev1.Secret{}
+	assert.Nil(t, r.Get(ctx, types.NamespacedName{Namespace: "default", Name: "example-dkim-mail"}, secret))
+	assert.Equal(t, foreign.Data, secret.Data)
+	assert.Empty(t, secret.OwnerReferences)
+}
+
+// labelledSecretsClient only finds the Secrets with the domain label, like
+// the cache of the manager.
+type labelledSecretsClient struct {
+	client.Client
+}
+
+func (c labelledSecretsClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if err := c.Client.Get(ctx, key, obj, opts...); err != nil {
+		return err
+	}
+	if _, ok := obj.(*corev1.Secret); ok && obj.GetLabels()[DomainLabel] == "" {
+		return apierrors.NewNotFound(corev1.Resource("secrets"), key.Name)
+	}
+	return nil
+}
+
+func TestReconcileDKimKeysUncachedSecret(t *testing.T) {
+	domain := newDKimDomain()
+	foreign := &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "example-dkim-mail"},
+		Data:       map[string][]byte{"privateKey": []byte("not ours")},
+	}
+	r := newIngressReconciler(t, foreign)
+	r.Client = labelledSecretsClient{r.Client}
+	ctx := context.Background()
+
+	err := r.reconcileDKimKeys(ctx, domain, logr.Discard())
+	assert.True(t, isInvalidDKimSecret(err), "got %v", err)
+}
+
+func TestCleanupDKimSecretsRotation(t *testing.T) {
+	domain := newDKimDomain()
+	domain.Spec.DKim.Rotation = &corev1alpha1.DKimRotation{Interval: v1.Duration{Duration: 24 * time.Hour}}
+	domain.Status.DKim.Rotation = &corev1alpha1.DKimRotationStatus{
+		Phase:          corev1alpha1.DKimRotationStable,
+		ActiveSelector: "k8nnon-1",
+	}
+	r := newIngressReconciler(t)
+	ctx := context.Background()
+
+	assert.Nil(t, r.reconcileDKimKeys(ctx, domain, logr.Discard()))
+	key := types.NamespacedName{Namespace: "default", Name: "example-dkim-k8nnon-1"}
+	secret := &corev1.Secret{}
+	assert.Nil(t, r.Get(ctx, key, secret))
+	assert.Equal(t, "true", secret.Labels[DKimRotationLabel])
+
+	// A lost status does not delete the key of the active selector.
+	domain.Status.DKim.Rotation = nil
+	assert.Nil(t, r.reconcileDKimKeys(ctx, domain, logr.Discard()))
+	assert.Nil(t, r.Get(ctx, key, secret))
+
+	// Neither does a status not marking it as retired.
+	domain.Status.DKim.Rotation = &corev1alpha1.DKimRotationStatus{
+		Phase:          corev1alpha1.DKimRotationStable,
+		ActiveSelector: "k8nnon-2",
+	}
+	assert.Nil(t, r.reconcileDKimKeys(ctx, domain, logr.Discard()))
+	assert.Nil(t, r.Get(ctx, key, secret))
+
+	domain.Status.DKim.Rotation.RetiredSelectors = []string{"k8nnon-1"}
+	assert.Nil(t, r.reconcileDKimKeys(ctx, domain, logr.Discard()))
+	assert.True(t, apierrors.IsNotFound(r.Get(ctx, key, secret)))
+	assert.Empty(t, domain.Status.DKim.Rotation.RetiredSelectors)
+	assert.Nil(t, r.Get(ctx, types.NamespacedName{Namespace: "default", Name: "example-dkim-k8nnon-2"}, secret))
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+	"github.com/kannon-email/k8nnon/internal/dns/checker"
+)
+
+const (
+	defaultDKimRotationPrefix      = "k8nnon"
+	defaultDKimRotationGracePeriod = 7 * 24 * time.Hour
+)
+
+// startDKimRotation moves the key rotation through its time based phases:
+// it mints a new pending selector when a rotation is due and drops the
+// retiring selector at the end of the grace period.
+func startDKimRotation(domain *corev1alpha1.Domain, now time.Time) {
+	rotation := domain.Spec.DKim.Rotation
+	if rotation == nil {
+		stopDKimRotation(domain, now)
+		return
+	}
+
+	status := domain.Status.DKim.Rotation
+	if status == nil {
+		status = &corev1alpha1.DKimRotationStatus{Phase: corev1alpha1.DKimRotationStable}
+		domain.Status.DKim.Rotation = status
+	}
+
+	retireDKimSelector(status, dkimRotationGracePeriod(rotation), now)
+
+	if status.Phase == corev1alpha1.DKimRotationStable && dkimRotationDue(domain, now) {
+		status.PendingSelector = dkimRotationSelectorName(rotation, now)
+		status.Phase = corev1alpha1.DKimRotationPublishing
+	}
+}
+
+// stopDKimRotation winds down the rotation once it is disabled: the active
+// selector may still be signing mails, so it is retired through the grace
+// period like a rotated one, after the selector already retiring.
+func stopDKimRotation(domain *corev1alpha1.Domain, now time.Time) {
+	status := domain.Status.DKim.Rotation
+	if status == nil {
+		return
+	}
+
+	if status.PendingSelector != "" {
+		status.RetiredSelectors = append(status.RetiredSelectors, status.PendingSelector)
+		status.PendingSelector = ""
+	}
+	retireDKimSelector(status, defaultDKimRotationGracePeriod, now)
+
+	if status.Phase != corev1alpha1.DKimRotationRetiring && status.ActiveSelector != "" {
+		retireTime := v1.NewTime(now.Add(defaultDKimRotationGracePeriod))
+		status.RetiringSelector = status.ActiveSelector
+		status.ActiveSelector = ""
+		status.RetireTime = &retireTime
+		status.Phase = corev1alpha1.DKimRotationRetiring
+	}
+
+	if status.ActiveSelector == "" && status.RetiringSelector == "" && len(status.RetiredSelectors) == 0 {
+		domain.Status.DKim.Rotation = nil
+	}
+}
+
+// retireDKimSelector retires the retiring selector at the end of the grace
+// period, its Secret is then deleted. A retiring selector without a retire time is given a new grace
+// period rather than being dropped while it may still be in use.
+func retireDKimSelector(status *corev1alpha1.DKimRotationStatus, grace time.Duration, now time.Time) {
+	if status.Phase != corev1alpha1.DKimRotationRetiring {
+		return
+	}
+
+	if status.RetireTime == nil {
+		retireTime := v1.NewTime(now.Add(grace))
+		status.RetireTime = &retireTime
+	}
+
+	if !now.Before(status.RetireTime.Time) {
+		status.RetiredSelectors = append(status.RetiredSelectors, status.RetiringSelector)
+		status.RetiringSelector = ""
+		status.RetireTime = nil
+		status.Phase = corev1alpha1.DKimRotationStable
+	}
+}
+
+// completeDKimRotation switches the active selector to the pending one once
+// its record has propagated on a quorum of resolvers.
+func completeDKimRotation(ctx context.Context, dnsChecker *checker.DNSChecker, domain *corev1alpha1.Domain, now time.Time, l logr.Logger) {
+	status := domain.Status.DKim.Rotation
+	if status == nil || status.Phase != corev1alpha1.DKimRotationPublishing {
+		return
+	}
+
+	selector, ok := managedDKimSelector(domain, status.PendingSelector)
+	if !ok {
+		return
+	}
+
+	stats := dnsChecker.CheckDKimSelector(ctx, domain, selector)
+	if !stats.Result() {
+		l.Info("waiting for dkim selector propagation", "selector", selector.Selector, "reason", stats.Reason)
+		return
+	}
+
+	l.Info("switching active dkim selector", "selector", selector.Selector, "previous", status.ActiveSelector)
+	promoteDKimRotation(domain, now)
+}
+
+func promoteDKimRotation(domain *corev1alpha1.Domain, now time.Time) {
+	status := domain.Status.DKim.Rotation
+	previous := status.ActiveSelector
+
+	lastRotation := v1.NewTime(now)
+	status.ActiveSelector = status.PendingSelector
+	status.PendingSelector = ""
+	status.LastRotationTime = &lastRotation
+
+	if previous == "" {
+		status.Phase = corev1alpha1.DKimRotationStable
+		return
+	}
+
+	retireTime := v1.NewTime(now.Add(dkimRotationGracePeriod(domain.Spec.DKim.Rotation)))
+	status.RetiringSelector = previous
+	status.RetireTime = &retireTime
+	status.Phase = corev1alpha1.DKimRotationRetiring
+}
+
+func dkimRotationGracePeriod(rotation *corev1alpha1.DKimRotation) time.Duration {
+	if rotation.GracePeriod.Duration == 0 {
+		return defaultDKimRotationGracePeriod
+	}
+
+	return rotation.GracePeriod.Duration
+}
+
+func dkimRotationDue(domain *corev1alpha1.Domain, now time.Time) bool {
+	status := domain.Status.DKim.Rotation
+	if status.ActiveSelector == "" || status.LastRotationTime == nil {
+		return true
+	}
+
+	return !now.Before(status.LastRotationTime.Add(domain.Spec.DKim.Rotation.Interval.Duration))
+}
+
+// dkimRotationRequeue returns how long to wait before the next rotation
+// step, if a rotation is configured.
+func dkimRotationRequeue(domain *corev1alpha1.Domain, now time.Time) (time.Duration, bool) {
+	status := domain.Status.DKim.Rotation
+	if status == nil {
+		return 0, false
+	}
+
+	switch {
+	case status.Phase == corev1alpha1.DKimRotationPublishing:
+		return 1 * time.Minute, true
+	case status.Phase == corev1alpha1.DKimRotationRetiring:
+		if status.RetireTime == nil {
+			return 1 * time.Minute, true
+		}
+		return status.RetireTime.Sub(now), true
+	case domain.Spec.DKim.Rotation == nil:
+		return 0, false
+	default:
+		if status.LastRotationTime == nil {
+			return 1 * time.Minute, true
+		}
+		return status.LastRotationTime.Add(domain.Spec.DKim.Rotation.Interval.Duration).Sub(now), true
+	}
+}
+
+func dkimRotationSelectorName(rotation *corev1alpha1.DKimRotation, now time.Time) string {
+	return fmt.Sprintf("%s-%d", dkimRotationPrefix(rotation), now.Unix())
+}
+
+func dkimRotationPrefix(rotation *corev1alpha1.DKimRotation) string {
+	if rotation == nil || rotation.SelectorPrefix == "" {
+		return defaultDKimRotationPrefix
+	}
+
+	return rotation.SelectorPrefix
+}
+
+// isRetiredDKimSelector reports whether the status marks a rotated selector
+// as retired.
+func isRetiredDKimSelector(domain *corev1alpha1.Domain, name string) bool {
+	if status := domain.Status.DKim.Rotation; status != nil {
+		for _, retired := range status.RetiredSelectors {
+			if retired == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// clearRetiredDKimSelectors forgets the retired selectors once their
+// Secrets are deleted.
+func clearRetiredDKimSelectors(domain *corev1alpha1.Domain) {
+	status := domain.Status.DKim.Rotation
+	if status == nil {
+		return
+	}
+
+	status.RetiredSelectors = nil
+	if domain.Spec.DKim.Rotation == nil && status.ActiveSelector == "" && status.RetiringSelector == "" {
+		domain.Status.DKim.Rotation = nil
+	}
+}
+
+func managedDKimSelector(domain *corev1alpha1.Domain, name string) (corev1alpha1.DKimSelector, bool) {
+	for _, key := range domain.Status.DKim.ManagedKeys {
+		if key.Selector == name {
+			return corev1alpha1.DKimSelector{
+				Selector:  key.Selector,
+				KeyType:   key.KeyType,
+				PublicKey: key.PublicKey,
+			}, true
+		}
+	}
+
+	return corev1alpha1.DKimSelector{}, false
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+)
+
+func TestDKimRotationLifecycle(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	domain := &corev1alpha1.Domain{
+		Spec: corev1alpha1.DomainSpec{
+			DKim: corev1alpha1.DKim{
+				Rotation: &corev1alpha1.DKimRotation{
+					SelectorPrefix: "k",
+					Interval:       v1.Duration{Duration: 24 * time.Hour},
+					GracePeriod:    v1.Duration{Duration: time.Hour},
+				},
+			},
+		},
+	}
+
+	startDKimRotation(domain, now)
+	status := domain.Status.DKim.Rotation
+	assert.Equal(t, corev1alpha1.DKimRotationPublishing, status.Phase)
+	assert.Equal(t, "k-1672531200", status.PendingSelector)
+
+	promoteDKimRotation(domain, now)
+	assert.Equal(t, corev1alpha1.DKimRotationStable, status.Phase)
+	assert.Equal(t, "k-1672531200", status.ActiveSelector)
+
+	startDKimRotation(domain, now.Add(time.Hour))
+	assert.Equal(t, corev1alpha1.DKimRotationStable, status.Phase, "rotation should not be due yet")
+
+	next := now.Add(24 * time.Hour)
+	startDKimRotation(domain, next)
+	assert.Equal(t, corev1alpha1.DKimRotationPublishing, status.Phase)
+	assert.Equal(t, "k-1672617600", status.PendingSelector)
+
+	promoteDKimRotation(domain, next)
+	assert.Equal(t, corev1alpha1.DKimRotationRetiring, status.Phase)
+	assert.Equal(t, "k-1672617600", status.ActiveSelector)
+	assert.Equal(t, "k-1672531200", status.RetiringSelector)
+
+	requeue, ok := dkimRotationRequeue(domain, next)
+	assert.True(t, ok)
+	assert.Equal(t, time.Hour, requeue)
+
+	startDKimRotation(domain, next.Add(time.Hour))
+	assert.Equal(t, corev1alpha1.DKimRotationStable, status.Phase)
+	assert.Empty(t, status.RetiringSelector)
+	assert.Equal(t, []string{"k-1672531200"}, status.RetiredSelectors)
+}
+
+func TestDKimRotationDisabled(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	domain := &corev1alpha1.Domain{
+		Status: corev1alpha1.DomainStatus{
+			DKim: corev1alpha1.DKimStatus{
+				Rotation: &corev1alpha1.DKimRotationStatus{
+					Phase:           corev1alpha1.DKimRotationPublishing,
+					ActiveSelector:  "k-1",
+					PendingSelector: "k-2",
+				},
+			},
+		},
+	}
+
+	// The active key is still published and retired through the grace
+	// period, the pending one was never used.
+	startDKimRotation(domain, now)
+	status := domain.Status.DKim.Rotation
+	assert.Equal(t, corev1alpha1.DKimRotationRetiring, status.Phase)
+	assert.Empty(t, status.ActiveSelector)
+	assert.Empty(t, status.PendingSelector)
+	assert.Equal(t, "k-1", status.RetiringSelector)
+	assert.Equal(t, []corev1alpha1.DKimSelector{{Selector: "k-1", KeyType: corev1alpha1.DKimKeyTypeRSA}}, domain.RotatedSelectors())
+
+	requeue, ok := dkimRotationRequeue(domain, now)
+	assert.True(t, ok)
+	assert.Equal(t, defaultDKimRotationGracePeriod, requeue)
+
+	// The status is dropped once the Secrets of the retired selectors are
+	// deleted.
+	startDKimRotation(domain, now.Add(defaultDKimRotationGracePeriod))
+	assert.Equal(t, []string{"k-2", "k-1"}, status.RetiredSelectors)
+	assert.Empty(t, domain.RotatedSelectors())
+
+	clearRetiredDKimSelectors(domain)
+	assert.Nil(t, domain.Status.DKim.Rotation)
+}
+
+func TestDKimRotationRetiringWithoutRetireTime(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	domain := &corev1alpha1.Domain{
+		Spec: corev1alpha1.DomainSpec{
+			DKim: corev1alpha1.DKim{
+				Rotation: &corev1alpha1.DKimRotation{Interval: v1.Duration{Duration: 24 * time.Hour}, GracePeriod: v1.Duration{Duration: time.Hour}},
+			},
+		},
+		Status: corev1alpha1.DomainStatus{
+			DKim: corev1alpha1.DKimStatus{
+				Rotation: &corev1alpha1.DKimRotationStatus{
+					Phase:            corev1alpha1.DKimRotationRetiring,
+					ActiveSelector:   "k-2",
+					RetiringSelector: "k-1",
+					LastRotationTime: &v1.Time{Time: now},
+				},
+			},
+		},
+	}
+
+	requeue, ok := dkimRotationRequeue(domain, now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, requeue)
+
+	startDKimRotation(domain, now)
+	status := domain.Status.DKim.Rotation
+	assert.Equal(t, corev1alpha1.DKimRotationRetiring, status.Phase)
+	assert.Equal(t, "k-1", status.RetiringSelector)
+	assert.Equal(t, now.Add(time.Hour), status.RetireTime.Time)
+}
@@ -22,19 +22,30 @@ import (
 	"reflect"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	netwrkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/go-logr/logr"
 	"github.com/kannon-email/k8nnon/api/v1alpha1"
 	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
 	"github.com/kannon-email/k8nnon/internal/dns/checker"
+	"github.com/kannon-email/k8nnon/internal/dns/records"
+	"github.com/kannon-email/k8nnon/internal/dns/resolver"
+	"github.com/kannon-email/k8nnon/internal/notify"
 )
 
 // DomainReconciler reconciles a Domain object
@@ -42,12 +53,37 @@ type DomainReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 
-	DNSChecker checker.DNSChecker
+	// Resolvers provides the resolvers used to verify the domain records.
+	Resolvers *resolver.Pool
+
+	// DNSMode is the checker mode of the domains not setting one.
+	DNSMode string
+
+	// DNSPolicy is the quorum policy of the domains not setting one.
+	DNSPolicy checker.Policy
+
+	// httpRouteGVK is the HTTPRoute version served by the cluster, empty
+	// when the Gateway API is not installed. It is set by SetupWithManager.
+	httpRouteGVK schema.GroupVersionKind
+
+	// Recorder emits the events of the condition transitions and of the
+	// stats ingress actions.
+	Recorder record.EventRecorder
+
+	// Notifier sends the status changes of the conditions to the
+	// notification endpoints, nil disables the notifications.
+	Notifier *notify.Notifier
 }
 
 //+kubebuilder:rbac:groups=core.k8s.kannon.email,resources=domains,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core.k8s.kannon.email,resources=domains/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=core.k8s.kannon.email,resources=domains/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingressclasses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -64,38 +100,143 @@ func (r *DomainReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 
 	domain := &corev1alpha1.Domain{}
 	if err := r.Get(ctx, req.NamespacedName, domain); err != nil {
+		if errors.IsNotFound(err) {
+			forgetDomainMetrics(req.NamespacedName)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	dnsStatus, err := r.checkDomainDNS(ctx, l, domain)
+	now := time.Now()
+	previous := append([]v1.Condition(nil), domain.Status.Conditions...)
+
+	recheck := hasRecheckAnnotation(domain)
+	if recheck {
+		ctx = resolver.WithoutCache(ctx)
+	}
+
+	// The DNS settings can only be fixed by editing the spec, so there is
+	// nothing to retry until the domain changes.
+	policy, err := r.dnsPolicy(domain)
+	if err != nil {
+		l.Error(err, "invalid dns quorum policy", "domain", domain)
+		setInvalidDNSSpecCondition(domain, ReasonInvalidQuorum, err)
+		return ctrl.Result{}, r.updateStatus(ctx, domain, previous)
+	}
+
+	dnsChecker, err := r.dnsChecker(domain)
+	if err != nil {
+		l.Error(err, "invalid dns resolvers", "domain", domain)
+		setInvalidDNSSpecCondition(domain, ReasonInvalidResolvers, err)
+		return ctrl.Result{}, r.updateStatus(ctx, domain, previous)
+	}
+	dnsChecker = dnsChecker.WithPolicy(policy)
+
+	startDKimRotation(domain, now)
+
+	if err := r.reconcileDKimKeys(ctx, domain, l); err != nil {
+		l.Error(err, "failed to reconcile dkim keys", "domain", domain)
+		if !isInvalidDKimSecret(err) {
+			return ctrl.Result{}, err
+		}
+
+		// Secrets the domain does not control do not trigger a reconcile,
+		// check again later whether it has been fixed.
+		setInvalidDNSSpecCondition(domain, ReasonInvalidDKimSecret, err)
+		return ctrl.Result{RequeueAfter: computeReconcileInterval(domain, now)}, r.updateStatus(ctx, domain, previous)
+	}
+
+	completeDKimRotation(ctx, dnsChecker, domain, now, l)
+
+	dnsStatus, err := checkDomainDNS(ctx, l, dnsChecker, domain)
 	if err != nil {
 		return ctrl.Result{RequeueAfter: 1 * time.Minute}, err
 	}
 
-	domain.Status = corev1alpha1.DomainStatus{
-		DNS: dnsStatus,
+	trackPropagation(&domain.Status.DNS, &dnsStatus, now)
+	domain.Status.DNS = dnsStatus
+	domain.Status.RequiredRecords = records.Required(domain)
+
+	ingressErr := r.reconcileRouting(ctx, domain, l)
+	if ingressErr != nil {
+		l.Error(ingressErr, "failed to reconcile stats routing", "domain", domain)
 	}
 
-	if err := r.reconcileIngress(ctx, domain, l); err != nil {
-		l.Error(err, "failed to reconcile ingress", "domain", domain)
-		return ctrl.Result{}, err
+	certErr := r.reconcileCertificate(ctx, domain, l)
+	if certErr != nil {
+		l.Error(certErr, "failed to reconcile certificate", "domain", domain)
+		setCertificateError(domain, certErr)
 	}
 
-	if err := r.Status().Update(ctx, domain); err != nil {
+	setDomainConditions(domain, ingressErr)
+
+	if err := r.updateStatus(ctx, domain, previous); err != nil {
 		return ctrl.Result{}, err
 	}
 
+	recordCheckMetrics(domain, now)
+	recordIngressMetrics(domain)
+
+	if recheck {
+		if err := r.removeRecheckAnnotation(ctx, domain); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// An invalid routing is retried when the spec or the ingress classes
+	// change.
+	if ingressErr != nil && !isInvalidRouting(ingressErr) {
+		return ctrl.Result{}, ingressErr
+	}
+
+	if certErr != nil {
+		return ctrl.Result{}, certErr
+	}
+
 	return ctrl.Result{
-		RequeueAfter: computeReconcileInterval(domain),
+		RequeueAfter: computeReconcileInterval(domain, now),
 	}, nil
 }
 
+// updateStatus stores the status of the domain, then reports the condition
+// transitions, so that a failed update does not report them twice.
+func (r *DomainReconciler) updateStatus(ctx context.Context, domain *corev1alpha1.Domain, previous []v1.Condition) error {
+	if err := r.Status().Update(ctx, domain); err != nil {
+		return err
+	}
+
+	r.recordTransitions(domain, previous)
+	return r.notifyTransitions(ctx, domain)
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *DomainReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1alpha1.Domain{}).
+	if err := metrics.Registry.Register(&domainsCollector{client: mgr.GetClient()}); err != nil {
+		return err
+	}
+
+	// Status updates must not trigger a reconcile, the checks are rerun
+	// on spec changes, on the recheck annotation and periodically.
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&corev1alpha1.Domain{}, builder.WithPredicates(predicate.Or(
+			predicate.GenerationChangedPredicate{},
+			predicate.AnnotationChangedPredicate{},
+		))).
 		Owns(&netwrkingv1.Ingress{}).
-		Complete(r)
+		Owns(&corev1.Secret{}).
+		Watches(&source.Kind{Type: &netwrkingv1.IngressClass{}}, handler.EnqueueRequestsFromMapFunc(r.domainsForIngressClass), builder.WithPredicates(ingressClassChanged))
+
+	// Without cert-manager the certificate readiness is polled, see
+	// computeReconcileInterval.
+	if hasKind(mgr.GetRESTMapper(), certificateGVK) {
+		b = b.Owns(newCertificate())
+	}
+
+	r.httpRouteGVK = servedHTTPRouteGVK(mgr.GetRESTMapper())
+	if !r.httpRouteGVK.Empty() {
+		b = b.Owns(newHTTPRoute(r.httpRouteGVK))
+	}
+
+	return b.Complete(r)
 }
 
 func (r *DomainReconciler) reconcileIngress(ctx context.Context, domain *v1alpha1.Domain, l logr.Logger) error {
@@ -113,22 +254,38 @@ func (r *DomainReconciler) reconcileIngress(ctx context.Context, domain *v1alpha
 		return nil
 	}
 
-	ingress, err = r.buildDesiredIngress(domain)
+	ingress, err = r.buildDesiredIngress(ctx, domain)
 
 	if err != nil {
 		return err
 	}
 
-	return r.Create(ctx, ingress)
+	if err := r.Create(ctx, ingress); err != nil {
+		return err
+	}
+
+	r.Recorder.Eventf(domain, corev1.EventTypeNormal, EventIngressCreated, "created stats ingress %s", name)
+	return nil
 }
 
 func (r *DomainReconciler) handleFoundIngress(ctx context.Context, ingress *netwrkingv1.Ingress, domain *v1alpha1.Domain, l logr.Logger) error {
+	if !v1.IsControlledBy(ingress, domain) {
+		if !domain.Status.DNS.Stats.OK {
+			return nil
+		}
+		return &invalidRoutingError{reason: ReasonInvalidRouting, msg: fmt.Sprintf("ingress %s exists and is not controlled by the domain", ingress.Name)}
+	}
+
 	if domain.Status.DNS.Stats.OK {
 		return r.reconcileExistingIngress(ctx, ingress, domain, l)
 	}
 
 	if ingress.DeletionTimestamp == nil {
-		return r.Delete(ctx, ingress)
+		if err := r.Delete(ctx, ingress); err != nil {
+			return err
+		}
+
+		r.Recorder.Eventf(domain, corev1.EventTypeNormal, EventIngressDeleted, "deleted stats ingress %s, the stats CNAME is not verified", ingress.Name)
 	}
 
 	return nil
@@ -143,7 +300,12 @@ func (r *DomainReconciler) reconcileExistingIngress(ctx context.Context, ingress
 		}
 	}
 
-	desiredSpec := buildIngressSpec(domain)
+	className, err := r.ingressClassName(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	desiredSpec := buildIngressSpec(domain, className)
 	if !reflect.DeepEqual(ingress.Spec, desiredSpec) {
 		toUpdate = true
 		ingress.Spec = desiredSpec
@@ -157,42 +319,162 @@ func (r *DomainReconciler) reconcileExistingIngress(ctx context.Context, ingress
 
 	l.Info("updating ingress", "ingress", ingress.Spec)
 
-	return r.Update(ctx, ingress)
+	if err := r.Update(ctx, ingress); err != nil {
+		return err
+	}
+
+	r.Recorder.Eventf(domain, corev1.EventTypeNormal, EventIngressUpdated, "updated stats ingress %s", ingress.Name)
+	return nil
+}
+
+// statusLatencyPrecision is the precision of the resolver latencies in the
+// status.
+const statusLatencyPrecision = 100 * time.Millisecond
+
+// statusTTL returns the TTL stored in the status, rounded down to the
+// minute past one minute: answers served by a cache have a TTL decreasing
+// on every check.
+func statusTTL(ttl time.Duration) time.Duration {
+	if ttl < time.Minute {
+		return ttl.Truncate(time.Second)
+	}
+	return ttl.Truncate(time.Minute)
 }
 
 func mapDNSCheckStats2DomainDNSResult(stats checker.DNSCheckStats) corev1alpha1.DNSStatusStats {
+	resolvers := make([]corev1alpha1.DNSResolverStatus, 0, len(stats.Results))
+	for _, res := range stats.Results {
+		status := corev1alpha1.DNSResolverStatus{
+			Resolver:  res.Resolver,
+			OK:        res.OK,
+			Lame:      res.Lame,
+			Unhealthy: res.Unhealthy,
+			DNSSEC:    string(res.DNSSEC),
+			Value:     res.Value,
+			Reason:    res.Reason,
+			Error:     res.Error,
+		}
+		if res.Latency > 0 {
+			status.Latency = &v1.Duration{Duration: res.Latency.Round(statusLatencyPrecision)}
+		}
+		if res.TTL != nil {
+			ttl := int32(statusTTL(*res.TTL) / time.Second)
+			status.TTL = &ttl
+		}
+		resolvers = append(resolvers, status)
+	}
+
 	return corev1alpha1.DNSStatusStats{
-		OK:     stats.Result(),
-		CntOK:  stats.CntOK,
-		CntErr: stats.CntErr,
-		CntKO:  stats.CntKO,
+		OK:           stats.Result(),
+		CntOK:        stats.CntOK,
+		CntErr:       stats.CntErr,
+		CntKO:        stats.CntKO,
+		Reason:       stats.Reason,
+		Inconsistent: stats.Inconsistent,
+		DNSSEC:       string(stats.DNSSEC),
+		Resolvers:    resolvers,
 	}
 }
 
-func (r *DomainReconciler) checkDomainDNS(ctx context.Context, l logr.Logger, domain *corev1alpha1.Domain) (corev1alpha1.DNSStatus, error) {
+// dnsChecker returns a checker using the resolvers of the domain spec, or
+// the operator-wide resolvers when the domain does not override them.
+func (r *DomainReconciler) dnsChecker(domain *corev1alpha1.Domain) (*checker.DNSChecker, error) {
+	resolvers, err := r.Resolvers.Resolvers(domain.Spec.DNS.Resolvers...)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := domain.Spec.DNS.Mode
+	if mode == "" {
+		mode = r.DNSMode
+	}
+
+	if mode == checker.ModeAuthoritative {
+		return checker.NewAuthoritativeDNSChecker(r.Resolvers.Nameserver, resolvers...), nil
+	}
+
+	return checker.NewDNSChecker(resolvers...), nil
+}
+
+func hasRecheckAnnotation(domain *corev1alpha1.Domain) bool {
+	_, ok := domain.Annotations[corev1alpha1.AnnotationRecheck]
+	return ok
+}
+
+// removeRecheckAnnotation acknowledges a forced re-check.
+func (r *DomainReconciler) removeRecheckAnnotation(ctx context.Context, domain *corev1alpha1.Domain) error {
+	patch := client.MergeFrom(domain.DeepCopy())
+	delete(domain.Annotations, corev1alpha1.AnnotationRecheck)
+	return r.Patch(ctx, domain, patch)
+}
+
+// dnsPolicy returns the quorum policy of the domain spec, or the
+// operator-wide policy when the domain does not set one.
+func (r *DomainReconciler) dnsPolicy(domain *corev1alpha1.Domain) (checker.Policy, error) {
+	if domain.Spec.DNS.Quorum == nil {
+		return r.DNSPolicy, nil
+	}
+
+	policy := checker.PolicyFromSpec(*domain.Spec.DNS.Quorum)
+	return policy, policy.Validate()
+}
+
+func checkDomainDNS(ctx context.Context, l logr.Logger, dnsChecker *checker.DNSChecker, domain *corev1alpha1.Domain) (corev1alpha1.DNSStatus, error) {
 	l.Info("checking domain dns", "domain", domain.Spec.BaseDomain)
 
-	dkimStats := r.DNSChecker.CheckDomainDKim(ctx, domain)
-	spfStats := r.DNSChecker.CheckDomainSPF(ctx, domain)
-	domainStats := r.DNSChecker.CheckDomainStatsDNS(ctx, domain)
+	// The DKIM check of the domain is computed from the checks of its
+	// selectors, so that each record is looked up once.
+	var dkimSelectors []corev1alpha1.DNSStatusDKIMSelector
+	var selectorStats []checker.DNSCheckStats
+	for _, selector := range domain.DKimSelectors() {
+		stats := dnsChecker.CheckDKimSelector(ctx, domain, selector)
+		selectorStats = append(selectorStats, stats)
+		dkimSelectors = append(dkimSelectors, corev1alpha1.DNSStatusDKIMSelector{
+			Selector:       selector.Selector,
+			KeyType:        selector.KeyType,
+			DNSStatusStats: mapDNSCheckStats2DomainDNSResult(stats),
+		})
+	}
+
+	dkimStats := dnsChecker.CombineDKimSelectors(selectorStats)
+	spfStats := dnsChecker.CheckDomainSPF(ctx, domain)
+	dmarcStats := dnsChecker.CheckDomainDMARC(ctx, domain)
+	domainStats := dnsChecker.CheckDomainStatsDNS(ctx, domain)
+
+	recordTTLMetrics(domain, checkDKIM, dkimStats)
+	recordTTLMetrics(domain, checkSPF, spfStats)
+	recordTTLMetrics(domain, checkDMARC, dmarcStats)
+	recordTTLMetrics(domain, checkStats, domainStats)
+
+	// Nameservers are discovered by the checks, a failure is already
+	// reported in their results.
+	nameservers, _ := dnsChecker.Nameservers(ctx, domain.Spec.DomainName)
 
 	return corev1alpha1.DNSStatus{
-		Stats: mapDNSCheckStats2DomainDNSResult(domainStats),
-		DKIM:  mapDNSCheckStats2DomainDNSResult(dkimStats),
-		SFP:   mapDNSCheckStats2DomainDNSResult(spfStats),
+		Stats:         mapDNSCheckStats2DomainDNSResult(domainStats),
+		DKIM:          mapDNSCheckStats2DomainDNSResult(dkimStats),
+		SFP:           mapDNSCheckStats2DomainDNSResult(spfStats),
+		DMARC:         mapDNSCheckStats2DomainDNSResult(dmarcStats),
+		DKIMSelectors: dkimSelectors,
+		Nameservers:   nameservers,
 	}, nil
 }
 
-func (r *DomainReconciler) buildDesiredIngress(domain *corev1alpha1.Domain) (*netwrkingv1.Ingress, error) {
+func (r *DomainReconciler) buildDesiredIngress(ctx context.Context, domain *corev1alpha1.Domain) (*netwrkingv1.Ingress, error) {
 	name := statsIngressName(domain)
 
+	className, err := r.ingressClassName(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
 	ing := &netwrkingv1.Ingress{
 		ObjectMeta: v1.ObjectMeta{
 			Name:        name,
 			Namespace:   domain.Namespace,
 			Annotations: domain.Spec.Ingress.Annotations,
 		},
-		Spec: buildIngressSpec(domain),
+		Spec: buildIngressSpec(domain, className),
 	}
 
 	if err := ctrl.SetControllerReference(domain, ing, r.Scheme); err != nil {
@@ -202,13 +484,14 @@ func (r *DomainReconciler) buildDesiredIngress(domain *corev1alpha1.Domain) (*ne
 	return ing, nil
 }
 
-func buildIngressSpec(domain *corev1alpha1.Domain) netwrkingv1.IngressSpec {
+func buildIngressSpec(domain *corev1alpha1.Domain, className *string) netwrkingv1.IngressSpec {
 	pathPrefix := netwrkingv1.PathTypePrefix
-	statsDomain := fmt.Sprintf("%s.%s", domain.Spec.StatsPrefix, domain.Spec.DomainName)
+	statsDomain := statsHost(domain)
 
-	tlsSecret := fmt.Sprintf("%s-tls", statsDomain)
+	tlsSecret := tlsSecretName(domain)
 
 	return netwrkingv1.IngressSpec{
+		IngressClassName: className,
 		Rules: []netwrkingv1.IngressRule{
 			{
 				Host: statsDomain,
@@ -250,13 +533,26 @@ func statsIngressName(domain *corev1alpha1.Domain) string {
 }
 
 func dnsReady(dnsStatus corev1alpha1.DNSStatus) bool {
-	return dnsStatus.DKIM.OK && dnsStatus.Stats.OK && dnsStatus.SFP.OK
+	return dnsStatus.DKIM.OK && dnsStatus.Stats.OK && dnsStatus.SFP.OK && dnsStatus.DMARC.OK
 }
 
-func computeReconcileInterval(domain *corev1alpha1.Domain) time.Duration {
-	if dnsReady(domain.Status.DNS) {
-		return 1 * time.Hour
+func certificateReady(domain *corev1alpha1.Domain) bool {
+	return domain.Status.Certificate == nil || domain.Status.Certificate.Ready
+}
+
+func computeReconcileInterval(domain *corev1alpha1.Domain, now time.Time) time.Duration {
+	interval := 1 * time.Minute
+	if dnsReady(domain.Status.DNS) && certificateReady(domain) {
+		interval = 1 * time.Hour
+	}
+
+	if rotation, ok := dkimRotationRequeue(domain, now); ok && rotation < interval {
+		interval = rotation
+	}
+
+	if interval < time.Second {
+		interval = time.Second
 	}
 
-	return 1 * time.Minute
+	return interval
 }
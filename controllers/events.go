@@ -0,0 +1,176 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+	"github.com/kannon-email/k8nnon/internal/notify"
+)
+
+// Event reasons of the stats ingress actions, the other events use the
+// reason of the condition that changed.
+const (
+	EventIngressCreated = "IngressCreated"
+	EventIngressUpdated = "IngressUpdated"
+	EventIngressDeleted = "IngressDeleted"
+)
+
+// eventConditions are the conditions reported as events, in the order the
+// events are emitted.
+var eventConditions = []string{
+	corev1alpha1.ConditionDKIMVerified,
+	corev1alpha1.ConditionSPFVerified,
+	corev1alpha1.ConditionDMARCVerified,
+	corev1alpha1.ConditionStatsDNSVerified,
+	corev1alpha1.ConditionIngressReady,
+	corev1alpha1.ConditionCertificateReady,
+	corev1alpha1.ConditionReady,
+}
+
+// recordTransitions emits an event for each condition of the domain whose
+// status or reason differs from the previous ones. Conditions that only
+// changed their message are not reported, so the periodic rechecks of a
+// domain do not emit the same events again.
+func (r *DomainReconciler) recordTransitions(domain *corev1alpha1.Domain, previous []v1.Condition) {
+	for _, conditionType := range eventConditions {
+		condition := meta.FindStatusCondition(domain.Status.Conditions, conditionType)
+		if condition == nil {
+			continue
+		}
+
+		old := meta.FindStatusCondition(previous, conditionType)
+		if old != nil && old.Status == condition.Status && old.Reason == condition.Reason {
+			continue
+		}
+
+		eventType := corev1.EventTypeNormal
+		if condition.Status != v1.ConditionTrue {
+			eventType = corev1.EventTypeWarning
+		}
+
+		r.Recorder.Event(domain, eventType, condition.Reason, transitionMessage(old, condition))
+	}
+}
+
+// notifyTransitions sends the conditions whose state differs from the one
+// last delivered, see DomainStatus.NotifiedConditions. The delivered state
+// is stored once the notification is done, so the transitions that were not
+// delivered, e.g. because of a restart, are sent by a later reconcile.
+func (r *DomainReconciler) notifyTransitions(ctx context.Context, domain *corev1alpha1.Domain) error {
+	if r.Notifier == nil {
+		return nil
+	}
+
+	// A new domain whose records are not published yet is not news, its
+	// failing conditions are recorded without notifying them.
+	baseline := map[string]string{}
+
+	for _, conditionType := range eventConditions {
+		condition := meta.FindStatusCondition(domain.Status.Conditions, conditionType)
+		if condition == nil {
+			continue
+		}
+
+		state := notificationState(condition.Status)
+		notified, ok := domain.Status.NotifiedConditions[conditionType]
+		switch {
+		case ok && notified == state:
+			continue
+		case !ok && state != notify.StateOK:
+			baseline[conditionType] = state
+			continue
+		case !ok:
+			notified = notify.StateUnknown
+		}
+
+		key, conditionType := client.ObjectKeyFromObject(domain), conditionType
+		r.Notifier.Notify(notificationEvent(domain, notified, condition), func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			if err := r.setNotifiedConditions(ctx, key, map[string]string{conditionType: state}); err != nil {
+				log.FromContext(ctx).Error(err, "failed to record notification", "domain", key, "condition", conditionType)
+			}
+		})
+	}
+
+	if len(baseline) == 0 {
+		return nil
+	}
+
+	return r.setNotifiedConditions(ctx, client.ObjectKeyFromObject(domain), baseline)
+}
+
+// setNotifiedConditions merges states into the notified conditions of a
+// domain, without conflicting with the updates of the reconciler.
+func (r *DomainReconciler) setNotifiedConditions(ctx context.Context, key types.NamespacedName, states map[string]string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{"notifiedConditions": states},
+	})
+	if err != nil {
+		return err
+	}
+
+	domain := &corev1alpha1.Domain{ObjectMeta: v1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+	return client.IgnoreNotFound(r.Status().Patch(ctx, domain, client.RawPatch(types.MergePatchType, patch)))
+}
+
+func notificationEvent(domain *corev1alpha1.Domain, oldState string, condition *v1.Condition) notify.Event {
+	return notify.Event{
+		Namespace:       domain.Namespace,
+		Name:            domain.Name,
+		Domain:          domain.Spec.DomainName,
+		Check:           condition.Type,
+		OldState:        oldState,
+		NewState:        notificationState(condition.Status),
+		Reason:          condition.Reason,
+		Message:         condition.Message,
+		RequiredRecords: domain.Status.RequiredRecords,
+		Time:            time.Now().UTC(),
+	}
+}
+
+func notificationState(status v1.ConditionStatus) string {
+	switch status {
+	case v1.ConditionTrue:
+		return notify.StateOK
+	case v1.ConditionFalse:
+		return notify.StateFailing
+	default:
+		return notify.StateUnknown
+	}
+}
+
+func transitionMessage(old, condition *v1.Condition) string {
+	if old == nil || old.Status == condition.Status {
+		return fmt.Sprintf("%s is %s: %s", condition.Type, condition.Status, condition.Message)
+	}
+
+	return fmt.Sprintf("%s changed from %s to %s: %s", condition.Type, old.Status, condition.Status, condition.Message)
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+	"github.com/kannon-email/k8nnon/internal/notify"
+)
+
+func TestRecordTransitions(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &DomainReconciler{Recorder: recorder}
+
+	ok := corev1alpha1.DNSStatusStats{OK: true, CntOK: 3}
+	domain := &corev1alpha1.Domain{
+		Status: corev1alpha1.DomainStatus{
+			DNS: corev1alpha1.DNSStatus{Stats: ok, DKIM: ok, SFP: ok, DMARC: ok},
+		},
+	}
+
+	setDomainConditions(domain, nil)
+	r.recordTransitions(domain, nil)
+	assert.Len(t, recorder.Events, 6, "the first conditions should all be reported")
+	drain(recorder)
+
+	// A recheck with the same outcome does not emit events.
+	previous := append([]v1.Condition(nil), domain.Status.Conditions...)
+	domain.Status.DNS.DKIM.CntOK = 2
+	setDomainConditions(domain, nil)
+	r.recordTransitions(domain, previous)
+	assert.Empty(t, recorder.Events)
+
+	previous = append([]v1.Condition(nil), domain.Status.Conditions...)
+	domain.Status.DNS.DKIM = corev1alpha1.DNSStatusStats{CntKO: 3, Reason: "no DKIM record found"}
+	setDomainConditions(domain, nil)
+	r.recordTransitions(domain, previous)
+
+	events := drain(recorder)
+	assert.Equal(t, []string{
+		"Warning RecordNotVerified DKIMVerified changed from True to False: no DKIM record found",
+		"Warning ChecksFailing Ready changed from True to False: failing checks: DKIMVerified",
+	}, events)
+}
+
+func drain(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestNotificationEvent(t *testing.T) {
+	domain := &corev1alpha1.Domain{
+		ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "example"},
+		Spec:       corev1alpha1.DomainSpec{DomainName: "example.com"},
+	}
+	condition := &v1.Condition{Type: corev1alpha1.ConditionReady, Status: v1.ConditionTrue, Reason: ReasonDomainReady}
+
+	event := notificationEvent(domain, notify.StateFailing, condition)
+	assert.Equal(t, "example.com", event.Domain)
+	assert.Equal(t, corev1alpha1.ConditionReady, event.Check)
+	assert.Equal(t, notify.StateFailing, event.OldState)
+	assert.Equal(t, notify.StateOK, event.NewState)
+}
+
+func TestNotifyTransitions(t *testing.T) {
+	received := make(chan notify.Event, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		payload := notify.Event{}
+		assert.Nil(t, json.NewDecoder(req.Body).Decode(&payload))
+		received <- payload
+	}))
+	defer server.Close()
+
+	notifier, err := notify.New(notify.Config{Endpoints: []notify.Endpoint{{URL: server.URL}}}, notify.DefaultOptions, logr.Discard())
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = notifier.Start(ctx) }()
+
+	domain := &corev1alpha1.Domain{ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "example"}}
+	domain.Status.Conditions = []v1.Condition{
+		{Type: corev1alpha1.ConditionDKIMVerified, Status: v1.ConditionFalse, Reason: ReasonRecordNotVerified},
+		{Type: corev1alpha1.ConditionSPFVerified, Status: v1.ConditionTrue, Reason: ReasonRecordVerified},
+	}
+
+	r := newIngressReconciler(t, domain)
+	r.Notifier = notifier
+	key := client.ObjectKeyFromObject(domain)
+
+	notified := func() map[string]string {
+		stored := &corev1alpha1.Domain{}
+		assert.Nil(t, r.Get(ctx, key, stored))
+		return stored.Status.NotifiedConditions
+	}
+
+	// The failing check of a new domain is recorded without notifying it,
+	// the verified one is recorded once delivered.
+	assert.Nil(t, r.notifyTransitions(ctx, domain))
+	payload := <-received
+	assert.Equal(t, corev1alpha1.ConditionSPFVerified, payload.Check)
+	assert.Equal(t, notify.StateUnknown, payload.OldState)
+	assert.Eventually(t, func() bool {
+		return reflect.DeepEqual(map[string]string{
+			corev1alpha1.ConditionDKIMVerified: notify.StateFailing,
+			corev1alpha1.ConditionSPFVerified:  notify.StateOK,
+		}, notified())
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A transition is notified from the state last delivered.
+	domain.Status.NotifiedConditions = notified()
+	meta.SetStatusCondition(&domain.Status.Conditions, v1.Condition{Type: corev1alpha1.ConditionDKIMVerified, Status: v1.ConditionTrue, Reason: ReasonRecordVerified})
+	assert.Nil(t, r.notifyTransitions(ctx, domain))
+	payload = <-received
+	assert.Equal(t, corev1alpha1.ConditionDKIMVerified, payload.Check)
+	assert.Equal(t, notify.StateFailing, payload.OldState)
+	assert.Eventually(t, func() bool {
+		return notified()[corev1alpha1.ConditionDKIMVerified] == notify.StateOK
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Empty(t, received)
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+)
+
+// gatewayGroup is the API group of the Gateway API.
+const gatewayGroup = "gateway.networking.k8s.io"
+
+// httpRouteVersions are the supported HTTPRoute versions, by preference.
+var httpRouteVersions = []string{"v1", "v1beta1"}
+
+// Event reasons of the stats HTTPRoute actions.
+const (
+	EventHTTPRouteCreated = "HTTPRouteCreated"
+	EventHTTPRouteUpdated = "HTTPRouteUpdated"
+	EventHTTPRouteDeleted = "HTTPRouteDeleted"
+)
+
+// servedHTTPRouteGVK returns the preferred HTTPRoute version served by the
+// API server, the zero value when the Gateway API is not installed.
+func servedHTTPRouteGVK(mapper meta.RESTMapper) schema.GroupVersionKind {
+	for _, version := range httpRouteVersions {
+		gvk := schema.GroupVersionKind{Group: gatewayGroup, Version: version, Kind: "HTTPRoute"}
+		if hasKind(mapper, gvk) {
+			return gvk
+		}
+	}
+
+	return schema.GroupVersionKind{}
+}
+
+func newHTTPRoute(gvk schema.GroupVersionKind) *unstructured.Unstructured {
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(gvk)
+	return route
+}
+
+// reconcileHTTPRoute handles the stats HTTPRoute like reconcileIngress
+// handles the stats ingress: it exists only while the stats CNAME is
+// verified. Only the fields set by the operator are updated, an HTTPRoute of
+// the same name not controlled by the domain is an invalid routing.
+func (r *DomainReconciler) reconcileHTTPRoute(ctx context.Context, domain *corev1alpha1.Domain, l logr.Logger) error {
+	if r.httpRouteGVK.Empty() {
+		return &invalidRoutingError{reason: ReasonGatewayAPIMissing, msg: "the Gateway API HTTPRoute CRD is not installed"}
+	}
+
+	if domain.Spec.HTTPRoute == nil || len(domain.Spec.HTTPRoute.ParentRefs) == 0 {
+		return &invalidRoutingError{reason: ReasonInvalidRouting, msg: "spec.httpRoute.parentRefs is required by the HTTPRoute routing"}
+	}
+
+	name := statsIngressName(domain)
+	route := newHTTPRoute(r.httpRouteGVK)
+
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: domain.Namespace}, route)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+
+	if !domain.Status.DNS.Stats.OK {
+		if found {
+			return r.deleteOwnedHTTPRoute(ctx, route, domain, "the stats CNAME is not verified")
+		}
+		return nil
+	}
+
+	desired := httpRouteSpec(domain)
+
+	if !found {
+		route.SetName(name)
+		route.SetNamespace(domain.Namespace)
+		route.Object["spec"] = desired
+		if err := ctrl.SetControllerReference(domain, route, r.Scheme); err != nil {
+			return err
+		}
+
+		l.Info("creating httproute", "httproute", name)
+		if err := r.Create(ctx, route); err != nil {
+			return err
+		}
+
+		r.Recorder.Eventf(domain, corev1.EventTypeNormal, EventHTTPRouteCreated, "created stats HTTPRoute %s", name)
+		return nil
+	}
+
+	if !v1.IsControlledBy(route, domain) {
+		return &invalidRoutingError{reason: ReasonInvalidRouting, msg: fmt.Sprintf("HTTPRoute %s exists and is not controlled by the domain", name)}
+	}
+
+	changed, err := setManagedFields(route, desired)
+	if err != nil || !changed {
+		return err
+	}
+
+	l.Info("updating httproute", "httproute", name)
+	if err := r.Update(ctx, route); err != nil {
+		return err
+	}
+
+	r.Recorder.Eventf(domain, corev1.EventTypeNormal, EventHTTPRouteUpdated, "updated stats HTTPRoute %s", name)
+	return nil
+}
+
+// deleteHTTPRoute deletes the stats HTTPRoute created by the operator.
+func (r *DomainReconciler) deleteHTTPRoute(ctx context.Context, domain *corev1alpha1.Domain) error {
+	if r.httpRouteGVK.Empty() {
+		return nil
+	}
+
+	route := newHTTPRoute(r.httpRouteGVK)
+	err := r.Get(ctx, types.NamespacedName{Name: statsIngressName(domain), Namespace: domain.Namespace}, route)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	return r.deleteOwnedHTTPRoute(ctx, route, domain, "the stats endpoint is routed by an Ingress")
+}
+
+func (r *DomainReconciler) deleteOwnedHTTPRoute(ctx context.Context, route *unstructured.Unstructured, domain *corev1alpha1.Domain, why string) error {
+	if !v1.IsControlledBy(route, domain) || route.GetDeletionTimestamp() != nil {
+		return nil
+	}
+
+	if err := r.Delete(ctx, route); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	r.Recorder.Eventf(domain, corev1.EventTypeNormal, EventHTTPRouteDeleted, "deleted stats HTTPRoute %s, %s", route.GetName(), why)
+	return nil
+}
+
+// httpRouteSpec returns the spec of the stats HTTPRoute. It sets the fields
+// defaulted by the API server, so that it compares with the spec read from
+// the cluster, with the types of decoded JSON.
+func httpRouteSpec(domain *corev1alpha1.Domain) map[string]interface{} {
+	parentRefs := make([]interface{}, 0, len(domain.Spec.HTTPRoute.ParentRefs))
+	for _, ref := range domain.Spec.HTTPRoute.ParentRefs {
+		group := ref.Group
+		if group == "" {
+			group = gatewayGroup
+		}
+		kind := ref.Kind
+		if kind == "" {
+			kind = "Gateway"
+		}
+
+		parentRef := map[string]interface{}{
+			"group": group,
+			"kind":  kind,
+			"name":  ref.Name,
+		}
+		if ref.Namespace != "" {
+			parentRef["namespace"] = ref.Namespace
+		}
+		if ref.SectionName != "" {
+			parentRef["sectionName"] = ref.SectionName
+		}
+
+		parentRefs = append(parentRefs, parentRef)
+	}
+
+	service := domain.Spec.Ingress.Service
+
+	return map[string]interface{}{
+		"parentRefs": parentRefs,
+		"hostnames":  []interface{}{statsHost(domain)},
+		"rules": []interface{}{
+			map[string]interface{}{
+				"matches": []interface{}{
+					map[string]interface{}{
+						"path": map[string]interface{}{"type": "PathPrefix", "value": "/stats"},
+					},
+				},
+				"backendRefs": []interface{}{
+					map[string]interface{}{
+						"group":  "",
+						"kind":   "Service",
+						"name":   service.Name,
+						"port":   int64(service.Port),
+						"weight": int64(1),
+					},
+				},
+			},
+		},
+	}
+}
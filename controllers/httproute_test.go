@@ -0,0 +1,156 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	netwrkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+)
+
+var httpRouteGVK = schema.GroupVersionKind{Group: gatewayGroup, Version: "v1", Kind: "HTTPRoute"}
+
+func httpRouteDomain() *corev1alpha1.Domain {
+	return &corev1alpha1.Domain{
+		ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "example", UID: "uid"},
+		Spec: corev1alpha1.DomainSpec{
+			DomainName:  "example.com",
+			StatsPrefix: "stats",
+			Ingress: corev1alpha1.DomainIngressSpec{
+				Service: corev1alpha1.DomainIngressServiceSpec{Name: "stats", Port: 8080},
+			},
+			Routing: corev1alpha1.RoutingHTTPRoute,
+			HTTPRoute: &corev1alpha1.DomainHTTPRouteSpec{
+				ParentRefs: []corev1alpha1.HTTPRouteParentRef{{Name: "public", Namespace: "gateways", SectionName: "https"}},
+			},
+		},
+	}
+}
+
+func TestReconcileHTTPRoute(t *testing.T) {
+	ctx := context.Background()
+	domain := httpRouteDomain()
+	key := types.NamespacedName{Namespace: "default", Name: "example-stats"}
+
+	// The ingress of the previous routing is removed.
+	controller := true
+	ingress := &netwrkingv1.Ingress{ObjectMeta: v1.ObjectMeta{
+		Namespace: "default",
+		Name:      "example-stats",
+		OwnerReferences: []v1.OwnerReference{{
+			APIVersion: corev1alpha1.GroupVersion.String(),
+			Kind:       "Domain",
+			Name:       domain.Name,
+			UID:        domain.UID,
+			Controller: &controller,
+		}},
+	}}
+	r := newIngressReconciler(t, ingress)
+	r.httpRouteGVK = httpRouteGVK
+
+	// The route waits for the stats CNAME.
+	assert.Nil(t, r.reconcileRouting(ctx, domain, logr.Discard()))
+	assert.True(t, apierrors.IsNotFound(r.Get(ctx, key, newHTTPRoute(httpRouteGVK))))
+	assert.True(t, apierrors.IsNotFound(r.Get(ctx, key, &netwrkingv1.Ingress{})))
+
+	domain.Status.DNS.Stats.OK = true
+	assert.Nil(t, r.reconcileRouting(ctx, domain, logr.Discard()))
+
+	route := newHTTPRoute(httpRouteGVK)
+	assert.Nil(t, r.Get(ctx, key, route))
+	assert.True(t, v1.IsControlledBy(route, domain))
+	assert.Equal(t, httpRouteSpec(domain), route.Object["spec"])
+
+	hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+	assert.Equal(t, []string{"stats.example.com"}, hostnames)
+
+	// Drift is reconciled.
+	route.Object["spec"].(map[string]interface{})["hostnames"] = []interface{}{"other.example.com"}
+	assert.Nil(t, r.Update(ctx, route))
+	assert.Nil(t, r.reconcileRouting(ctx, domain, logr.Discard()))
+	assert.Nil(t, r.Get(ctx, key, route))
+	assert.Equal(t, httpRouteSpec(domain), route.Object["spec"])
+
+	// The fields not set by the operator are kept.
+	assert.Nil(t, unstructured.SetNestedField(route.Object, "example", "spec", "extra"))
+	assert.Nil(t, r.Update(ctx, route))
+	assert.Nil(t, r.reconcileRouting(ctx, domain, logr.Discard()))
+	assert.Nil(t, r.Get(ctx, key, route))
+	extra, _, _ := unstructured.NestedString(route.Object, "spec", "extra")
+	assert.Equal(t, "example", extra)
+
+	// Switching back to an Ingress removes the route.
+	domain.Spec.Routing = corev1alpha1.RoutingIngress
+	assert.Nil(t, r.reconcileRouting(ctx, domain, logr.Discard()))
+	assert.True(t, apierrors.IsNotFound(r.Get(ctx, key, newHTTPRoute(httpRouteGVK))))
+	assert.Nil(t, r.Get(ctx, key, &netwrkingv1.Ingress{}))
+}
+
+func TestReconcileHTTPRouteInvalid(t *testing.T) {
+	ctx := context.Background()
+	domain := httpRouteDomain()
+	domain.Status.DNS.Stats.OK = true
+
+	r := newIngressReconciler(t)
+	err := r.reconcileRouting(ctx, domain, logr.Discard())
+	assert.True(t, isInvalidRouting(err))
+	assert.Equal(t, ReasonGatewayAPIMissing, ingressCondition(domain, err).Reason)
+
+	r.httpRouteGVK = httpRouteGVK
+	domain.Spec.HTTPRoute = nil
+	err = r.reconcileRouting(ctx, domain, logr.Discard())
+	assert.Equal(t, ReasonInvalidRouting, ingressCondition(domain, err).Reason)
+}
+
+func TestReconcileHTTPRouteNotOwned(t *testing.T) {
+	ctx := context.Background()
+	domain := httpRouteDomain()
+	domain.Status.DNS.Stats.OK = true
+	key := types.NamespacedName{Namespace: "default", Name: "example-stats"}
+
+	r := newIngressReconciler(t)
+	r.httpRouteGVK = httpRouteGVK
+
+	foreign := newHTTPRoute(httpRouteGVK)
+	foreign.SetName(key.Name)
+	foreign.SetNamespace(key.Namespace)
+	foreign.Object["spec"] = map[string]interface{}{"hostnames": []interface{}{"other.example.com"}}
+	assert.Nil(t, r.Create(ctx, foreign))
+
+	err := r.reconcileRouting(ctx, domain, logr.Discard())
+	assert.True(t, isInvalidRouting(err))
+	assert.Equal(t, ReasonInvalidRouting, ingressCondition(domain, err).Reason)
+
+	route := newHTTPRoute(httpRouteGVK)
+	assert.Nil(t, r.Get(ctx, key, route))
+	assert.Equal(t, map[string]interface{}{"hostnames": []interface{}{"other.example.com"}}, route.Object["spec"])
+
+	// A foreign route is not deleted when the stats CNAME fails.
+	domain.Status.DNS.Stats.OK = false
+	assert.Nil(t, r.reconcileRouting(ctx, domain, logr.Discard()))
+	assert.Nil(t, r.Get(ctx, key, route))
+}
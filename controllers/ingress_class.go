@@ -0,0 +1,136 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	netwrkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+)
+
+// legacyIngressClassAnnotation is the deprecated annotation selecting the
+// ingress controller, the API server rejects ingresses setting both the
+// annotation and the class name.
+const legacyIngressClassAnnotation = "kubernetes.io/ingress.class"
+
+// ingressClassName returns the ingress class of the stats ingress: the
+// class of the spec, which must exist, or the default class of the cluster.
+// It returns nil when the cluster has no default class or the class is set
+// by the deprecated annotation.
+func (r *DomainReconciler) ingressClassName(ctx context.Context, domain *corev1alpha1.Domain) (*string, error) {
+	name := domain.Spec.Ingress.ClassName
+	_, legacy := domain.Spec.Ingress.Annotations[legacyIngressClassAnnotation]
+
+	if name == "" {
+		if legacy {
+			return nil, nil
+		}
+
+		classes := &netwrkingv1.IngressClassList{}
+		if err := r.List(ctx, classes); err != nil {
+			return nil, err
+		}
+
+		return defaultIngressClass(classes.Items), nil
+	}
+
+	if legacy {
+		return nil, &invalidRoutingError{
+			reason: ReasonInvalidIngressClass,
+			msg:    fmt.Sprintf("ingress class %q conflicts with the %s annotation", name, legacyIngressClassAnnotation),
+		}
+	}
+
+	class := &netwrkingv1.IngressClass{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name}, class); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, &invalidRoutingError{reason: ReasonInvalidIngressClass, msg: fmt.Sprintf("ingress class %q not found", name)}
+		}
+		return nil, err
+	}
+
+	return &name, nil
+}
+
+// defaultIngressClass returns the default ingress class, the most recent
+// one when several are marked as default, as the API server does.
+func defaultIngressClass(classes []netwrkingv1.IngressClass) *string {
+	var found *netwrkingv1.IngressClass
+	for i := range classes {
+		class := &classes[i]
+		if !isDefaultIngressClass(class) {
+			continue
+		}
+
+		if found == nil || found.CreationTimestamp.Before(&class.CreationTimestamp) {
+			found = class
+		}
+	}
+
+	if found == nil {
+		return nil
+	}
+
+	return &found.Name
+}
+
+func isDefaultIngressClass(obj client.Object) bool {
+	return obj.GetAnnotations()[netwrkingv1.AnnotationIsDefaultIngressClass] == "true"
+}
+
+// ingressClassChanged filters out the updates of the ingress classes that
+// do not change the default class, the only change affecting the ingresses.
+var ingressClassChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return isDefaultIngressClass(e.ObjectOld) != isDefaultIngressClass(e.ObjectNew)
+	},
+}
+
+// domainsForIngressClass returns the domains using an ingress class, and
+// those using the default one when it is or was the default class, the
+// old and the new object of an update are both mapped.
+func (r *DomainReconciler) domainsForIngressClass(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+
+	domains := &corev1alpha1.DomainList{}
+	if err := r.List(ctx, domains); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list domains", "ingressclass", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, domain := range domains.Items {
+		className := domain.Spec.Ingress.ClassName
+		if className == obj.GetName() || className == "" && isDefaultIngressClass(obj) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: domain.Namespace, Name: domain.Name},
+			})
+		}
+	}
+
+	return requests
+}
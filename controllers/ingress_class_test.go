@@ -0,0 +1,204 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	netwrkingv1 "k8s.io/api/networking/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+)
+
+func ingressClass(name string, isDefault bool, created time.Time) *netwrkingv1.IngressClass {
+	class := &netwrkingv1.IngressClass{
+		ObjectMeta: v1.ObjectMeta{Name: name, CreationTimestamp: v1.NewTime(created)},
+	}
+	if isDefault {
+		class.Annotations = map[string]string{netwrkingv1.AnnotationIsDefaultIngressClass: "true"}
+	}
+	return class
+}
+
+func newIngressReconciler(t *testing.T, objs ...client.Object) *DomainReconciler {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, clientgoscheme.AddToScheme(scheme))
+	assert.Nil(t, corev1alpha1.AddToScheme(scheme))
+
+	return &DomainReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(10),
+	}
+}
+
+func TestIngressClassNameDefault(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	r := newIngressReconciler(t,
+		ingressClass("traefik", true, now.Add(-time.Hour)),
+		ingressClass("nginx", true, now),
+		ingressClass("haproxy", false, now.Add(time.Hour)),
+	)
+
+	domain := &corev1alpha1.Domain{}
+	className, err := r.ingressClassName(ctx, domain)
+	assert.Nil(t, err)
+	assert.Equal(t, "nginx", *className, "the most recent default class should be used")
+
+	domain.Spec.Ingress.Annotations = map[string]string{legacyIngressClassAnnotation: "traefik"}
+	className, err = r.ingressClassName(ctx, domain)
+	assert.Nil(t, err)
+	assert.Nil(t, className, "the deprecated annotation should not be overridden")
+
+	r = newIngressReconciler(t, ingressClass("haproxy", false, now))
+	className, err = r.ingressClassName(ctx, &corev1alpha1.Domain{})
+	assert.Nil(t, err)
+	assert.Nil(t, className)
+}
+
+func TestIngressClassNameInvalid(t *testing.T) {
+	ctx := context.Background()
+	r := newIngressReconciler(t, ingressClass("nginx", false, time.Now()))
+
+	domain := &corev1alpha1.Domain{}
+	domain.Spec.Ingress.ClassName = "nginx"
+	className, err := r.ingressClassName(ctx, domain)
+	assert.Nil(t, err)
+	assert.Equal(t, "nginx", *className)
+
+	domain.Spec.Ingress.ClassName = "missing"
+	_, err = r.ingressClassName(ctx, domain)
+	assert.True(t, isInvalidRouting(err))
+	assert.Equal(t, `ingress class "missing" not found`, err.Error())
+
+	domain.Spec.Ingress.ClassName = "nginx"
+	domain.Spec.Ingress.Annotations = map[string]string{legacyIngressClassAnnotation: "nginx"}
+	_, err = r.ingressClassName(ctx, domain)
+	assert.True(t, isInvalidRouting(err))
+
+	condition := ingressCondition(domain, err)
+	assert.Equal(t, ReasonInvalidIngressClass, condition.Reason)
+}
+
+func TestReconcileIngressClassDrift(t *testing.T) {
+	ctx := context.Background()
+
+	domain := &corev1alpha1.Domain{
+		ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "example"},
+		Spec: corev1alpha1.DomainSpec{
+			DomainName:  "example.com",
+			StatsPrefix: "stats",
+			Ingress: corev1alpha1.DomainIngressSpec{
+				ClassName: "nginx",
+				Service:   corev1alpha1.DomainIngressServiceSpec{Name: "stats", Port: 8080},
+			},
+		},
+	}
+
+	other := "traefik"
+	ingress := &netwrkingv1.Ingress{
+		ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: statsIngressName(domain)},
+		Spec:       buildIngressSpec(domain, &other),
+	}
+
+	r := newIngressReconciler(t, ingressClass("nginx", false, time.Now()), ingress)
+	assert.Nil(t, r.reconcileExistingIngress(ctx, ingress, domain, logr.Discard()))
+
+	updated := &netwrkingv1.Ingress{}
+	assert.Nil(t, r.Get(ctx, types.NamespacedName{Namespace: "default", Name: ingress.Name}, updated))
+	assert.Equal(t, "nginx", *updated.Spec.IngressClassName)
+}
+
+func TestDomainsForIngressClass(t *testing.T) {
+	domain := func(name, className string) *corev1alpha1.Domain {
+		return &corev1alpha1.Domain{
+			ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: name},
+			Spec:       corev1alpha1.DomainSpec{Ingress: corev1alpha1.DomainIngressSpec{ClassName: className}},
+		}
+	}
+	r := newIngressReconciler(t, domain("default", ""), domain("nginx", "nginx"), domain("traefik", "traefik"))
+
+	names := func(class *netwrkingv1.IngressClass) []string {
+		var names []string
+		for _, req := range r.domainsForIngressClass(class) {
+			names = append(names, req.Name)
+		}
+		return names
+	}
+
+	assert.ElementsMatch(t, []string{"nginx"}, names(ingressClass("nginx", false, time.Now())))
+	assert.ElementsMatch(t, []string{"default", "nginx"}, names(ingressClass("nginx", true, time.Now())))
+
+	old, updated := ingressClass("nginx", false, time.Now()), ingressClass("nginx", false, time.Now())
+	updated.Labels = map[string]string{"team": "platform"}
+	assert.False(t, ingressClassChanged.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: updated}))
+
+	updated.Annotations = map[string]string{netwrkingv1.AnnotationIsDefaultIngressClass: "true"}
+	assert.True(t, ingressClassChanged.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: updated}))
+}
+
+func TestReconcileIngressNotOwned(t *testing.T) {
+	ctx := context.Background()
+
+	domain := &corev1alpha1.Domain{
+		ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "example", UID: "uid"},
+		Spec: corev1alpha1.DomainSpec{
+			DomainName:  "example.com",
+			StatsPrefix: "stats",
+			Ingress: corev1alpha1.DomainIngressSpec{
+				ClassName: "nginx",
+				Service:   corev1alpha1.DomainIngressServiceSpec{Name: "stats", Port: 8080},
+			},
+		},
+	}
+
+	other := "traefik"
+	foreign := &netwrkingv1.Ingress{
+		ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: statsIngressName(domain)},
+		Spec:       buildIngressSpec(domain, &other),
+	}
+	key := types.NamespacedName{Namespace: "default", Name: foreign.Name}
+
+	r := newIngressReconciler(t, ingressClass("nginx", false, time.Now()), foreign)
+
+	domain.Status.DNS.Stats.OK = true
+	err := r.reconcileIngress(ctx, domain, logr.Discard())
+	assert.True(t, isInvalidRouting(err), "got %v", err)
+
+	ingress := &netwrkingv1.Ingress{}
+	assert.Nil(t, r.Get(ctx, key, ingress))
+	assert.Equal(t, "traefik", *ingress.Spec.IngressClassName)
+
+	// A foreign ingress is not deleted when the stats CNAME fails.
+	domain.Status.DNS.Stats.OK = false
+	assert.Nil(t, r.reconcileIngress(ctx, domain, logr.Discard()))
+	assert.Nil(t, r.Get(ctx, key, ingress))
+}
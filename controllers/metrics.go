@@ -0,0 +1,176 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+	"github.com/kannon-email/k8nnon/internal/dns/checker"
+)
+
+// Values of the check label of the DNS check metrics.
+const (
+	checkDKIM  = "dkim"
+	checkSPF   = "spf"
+	checkDMARC = "dmarc"
+	checkStats = "stats"
+)
+
+var (
+	checkVerified = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "k8nnon_domain_check_verified",
+		Help: "Whether a DNS check of a Domain passes (1) or fails (0).",
+	}, []string{"namespace", "name", "check"})
+
+	checkLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "k8nnon_domain_check_last_success_timestamp_seconds",
+		Help: "Unix time of the last time a DNS check of a Domain passed. For a failing check it is the time it started failing.",
+	}, []string{"namespace", "name", "check"})
+
+	recordTTL = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "k8nnon_domain_record_ttl_seconds",
+		Help: "Lowest TTL of the answers a DNS check of a Domain relied on, as seen by the resolvers at the last check.",
+	}, []string{"namespace", "name", "check"})
+
+	checkErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8nnon_dns_check_errors_total",
+		Help: "Number of DNS checks whose lookups failed, by resolver and check.",
+	}, []string{"resolver", "check"})
+
+	ingressReconciles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8nnon_ingress_reconciles_total",
+		Help: "Number of stats ingress reconciles by outcome, the reason of the IngressReady condition.",
+	}, []string{"reason"})
+
+	domainsDesc = prometheus.NewDesc(
+		"k8nnon_domains",
+		"Number of Domains by status and reason of their Ready condition.",
+		[]string{"status", "reason"}, nil,
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(checkVerified, checkLastSuccess, recordTTL, checkErrors, ingressReconciles)
+}
+
+// recordCheckMetrics records the outcome of the DNS checks of domain, once
+// its status and conditions are stored.
+func recordCheckMetrics(domain *corev1alpha1.Domain, now time.Time) {
+	checks := []struct {
+		check         string
+		conditionType string
+		stats         corev1alpha1.DNSStatusStats
+	}{
+		{checkDKIM, corev1alpha1.ConditionDKIMVerified, domain.Status.DNS.DKIM},
+		{checkSPF, corev1alpha1.ConditionSPFVerified, domain.Status.DNS.SFP},
+		{checkDMARC, corev1alpha1.ConditionDMARCVerified, domain.Status.DNS.DMARC},
+		{checkStats, corev1alpha1.ConditionStatsDNSVerified, domain.Status.DNS.Stats},
+	}
+
+	for _, c := range checks {
+		verified := 0.0
+		if c.stats.OK {
+			verified = 1
+			checkLastSuccess.WithLabelValues(domain.Namespace, domain.Name, c.check).Set(float64(now.Unix()))
+		} else if condition := meta.FindStatusCondition(domain.Status.Conditions, c.conditionType); condition != nil {
+			// The check passed until its condition turned false, which
+			// survives restarts unlike the gauge.
+			checkLastSuccess.WithLabelValues(domain.Namespace, domain.Name, c.check).Set(float64(condition.LastTransitionTime.Unix()))
+		}
+		checkVerified.WithLabelValues(domain.Namespace, domain.Name, c.check).Set(verified)
+
+		for _, res := range c.stats.Resolvers {
+			if res.Error != "" && !res.Unhealthy {
+				checkErrors.WithLabelValues(res.Resolver, c.check).Inc()
+			}
+		}
+	}
+}
+
+// recordTTLMetrics records the lowest TTL of the answers of a check, the
+// status only keeps rounded TTLs.
+func recordTTLMetrics(domain *corev1alpha1.Domain, check string, stats checker.DNSCheckStats) {
+	var lowest *time.Duration
+	for _, res := range stats.Results {
+		if res.TTL != nil && (lowest == nil || *res.TTL < *lowest) {
+			lowest = res.TTL
+		}
+	}
+
+	if lowest == nil {
+		recordTTL.DeleteLabelValues(domain.Namespace, domain.Name, check)
+		return
+	}
+	recordTTL.WithLabelValues(domain.Namespace, domain.Name, check).Set(lowest.Seconds())
+}
+
+// recordIngressMetrics records the outcome of the ingress reconcile of
+// domain, once its conditions are set.
+func recordIngressMetrics(domain *corev1alpha1.Domain) {
+	if ingress := meta.FindStatusCondition(domain.Status.Conditions, corev1alpha1.ConditionIngressReady); ingress != nil {
+		ingressReconciles.WithLabelValues(ingress.Reason).Inc()
+	}
+}
+
+// forgetDomainMetrics deletes the metrics of a deleted Domain.
+func forgetDomainMetrics(name types.NamespacedName) {
+	labels := prometheus.Labels{"namespace": name.Namespace, "name": name.Name}
+	checkVerified.DeletePartialMatch(labels)
+	checkLastSuccess.DeletePartialMatch(labels)
+	recordTTL.DeletePartialMatch(labels)
+}
+
+// domainsCollector counts the Domains by readiness when scraped.
+type domainsCollector struct {
+	client client.Reader
+}
+
+func (c *domainsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- domainsDesc
+}
+
+func (c *domainsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	domains := &corev1alpha1.DomainList{}
+	if err := c.client.List(ctx, domains); err != nil {
+		ch <- prometheus.NewInvalidMetric(domainsDesc, err)
+		return
+	}
+
+	counts := map[[2]string]int{}
+	for _, domain := range domains.Items {
+		key := [2]string{"Unknown", ""}
+		if ready := meta.FindStatusCondition(domain.Status.Conditions, corev1alpha1.ConditionReady); ready != nil {
+			key = [2]string{string(ready.Status), ready.Reason}
+		}
+		counts[key]++
+	}
+
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(domainsDesc, prometheus.GaugeValue, float64(count), key[0], key[1])
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+	"github.com/kannon-email/k8nnon/internal/dns/checker"
+)
+
+func TestRecordCheckMetrics(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	domain := &corev1alpha1.Domain{
+		ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "metrics"},
+		Status: corev1alpha1.DomainStatus{
+			DNS: corev1alpha1.DNSStatus{
+				DKIM: corev1alpha1.DNSStatusStats{OK: true, Resolvers: []corev1alpha1.DNSResolverStatus{
+					{Resolver: "10.0.0.53:53", OK: true},
+				}},
+				SFP: corev1alpha1.DNSStatusStats{Resolvers: []corev1alpha1.DNSResolverStatus{
+					{Resolver: "10.0.0.53:53", Error: "i/o timeout"},
+				}},
+			},
+		},
+	}
+
+	failedAt := time.Unix(1600000000, 0)
+	domain.Status.Conditions = []v1.Condition{
+		{Type: corev1alpha1.ConditionSPFVerified, Status: v1.ConditionFalse, LastTransitionTime: v1.NewTime(failedAt)},
+	}
+
+	before := testutil.ToFloat64(checkErrors.WithLabelValues("10.0.0.53:53", checkSPF))
+
+	recordCheckMetrics(domain, now)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(checkVerified.WithLabelValues("default", "metrics", checkDKIM)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(checkVerified.WithLabelValues("default", "metrics", checkSPF)))
+	assert.Equal(t, float64(now.Unix()), testutil.ToFloat64(checkLastSuccess.WithLabelValues("default", "metrics", checkDKIM)))
+	assert.Equal(t, float64(failedAt.Unix()), testutil.ToFloat64(checkLastSuccess.WithLabelValues("default", "metrics", checkSPF)),
+		"a failing check should report when it started failing")
+	assert.Equal(t, before+1, testutil.ToFloat64(checkErrors.WithLabelValues("10.0.0.53:53", checkSPF)))
+
+	forgetDomainMetrics(types.NamespacedName{Namespace: "default", Name: "metrics"})
+	assert.Equal(t, 0, testutil.CollectAndCount(checkVerified))
+	assert.Equal(t, 0, testutil.CollectAndCount(checkLastSuccess))
+}
+
+func TestDomainsCollector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, corev1alpha1.AddToScheme(scheme))
+
+	ready := func(name string, status v1.ConditionStatus, reason string) *corev1alpha1.Domain {
+		domain := &corev1alpha1.Domain{ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: name}}
+		setCondition(domain, v1.Condition{Type: corev1alpha1.ConditionReady, Status: status, Reason: reason})
+		return domain
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		ready("a", v1.ConditionTrue, ReasonDomainReady),
+		ready("b", v1.ConditionTrue, ReasonDomainReady),
+		ready("c", v1.ConditionFalse, ReasonChecksFailing),
+		&corev1alpha1.Domain{ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "d"}},
+	).Build()
+
+	expected := `
+# HELP k8nnon_domains Number of Domains by status and reason of their Ready condition.
+# TYPE k8nnon_domains gauge
+k8nnon_domains{reason="",status="Unknown"} 1
+k8nnon_domains{reason="ChecksFailing",status="False"} 1
+k8nnon_domains{reason="DomainReady",status="True"} 2
+`
+	assert.Nil(t, testutil.CollectAndCompare(&domainsCollector{client: c}, strings.NewReader(expected)))
+}
+
+func TestRecordTTLMetrics(t *testing.T) {
+	domain := &corev1alpha1.Domain{ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "ttl"}}
+	long, short := time.Hour, 5*time.Minute
+
+	recordTTLMetrics(domain, checkSPF, checker.DNSCheckStats{Results: []checker.ResolverResult{
+		{Resolver: "a", TTL: &long}, {Resolver: "b", TTL: &short}, {Resolver: "c"},
+	}})
+	assert.Equal(t, 300.0, testutil.ToFloat64(recordTTL.WithLabelValues("default", "ttl", checkSPF)))
+
+	recordTTLMetrics(domain, checkSPF, checker.DNSCheckStats{})
+	forgetDomainMetrics(types.NamespacedName{Namespace: "default", Name: "ttl"})
+	assert.Equal(t, 0, testutil.CollectAndCount(recordTTL))
+}
+
+func TestMapDNSCheckStatsRounding(t *testing.T) {
+	ttl := func(d time.Duration) *time.Duration { return &d }
+
+	status := mapDNSCheckStats2DomainDNSResult(checker.DNSCheckStats{Results: []checker.ResolverResult{
+		{Resolver: "8.8.8.8:53", Latency: 1234 * time.Millisecond, TTL: ttl(3599 * time.Second)},
+		{Resolver: "1.0.0.1:53", Latency: 20 * time.Millisecond, TTL: ttl(42500 * time.Millisecond)},
+		{Resolver: "9.9.9.9:53"},
+	}})
+
+	assert.Equal(t, 1200*time.Millisecond, status.Resolvers[0].Latency.Duration)
+	assert.Equal(t, int32(3540), *status.Resolvers[0].TTL)
+	assert.Equal(t, time.Duration(0), status.Resolvers[1].Latency.Duration)
+	assert.Equal(t, int32(42), *status.Resolvers[1].TTL)
+	assert.Nil(t, status.Resolvers[2].Latency)
+	assert.Nil(t, status.Resolvers[2].TTL)
+}
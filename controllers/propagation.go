@@ -0,0 +1,81 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+)
+
+// trackPropagation carries the first seen OK timestamps of the previous DNS
+// status over to the current one, setting them to now for the checks and
+// resolvers that just started passing.
+func trackPropagation(previous, current *corev1alpha1.DNSStatus, now time.Time) {
+	t := v1.NewTime(now)
+
+	trackStatsPropagation(&previous.Stats, &current.Stats, t)
+	trackStatsPropagation(&previous.DKIM, &current.DKIM, t)
+	trackStatsPropagation(&previous.SFP, &current.SFP, t)
+	trackStatsPropagation(&previous.DMARC, &current.DMARC, t)
+
+	for i := range current.DKIMSelectors {
+		selector := &current.DKIMSelectors[i]
+
+		prev := &corev1alpha1.DNSStatusStats{}
+		for j := range previous.DKIMSelectors {
+			if previous.DKIMSelectors[j].Selector == selector.Selector {
+				prev = &previous.DKIMSelectors[j].DNSStatusStats
+				break
+			}
+		}
+
+		trackStatsPropagation(prev, &selector.DNSStatusStats, t)
+	}
+}
+
+func trackStatsPropagation(previous, current *corev1alpha1.DNSStatusStats, now v1.Time) {
+	current.FirstSeenOK = firstSeenOK(previous.OK, previous.FirstSeenOK, current.OK, now)
+
+	for i := range current.Resolvers {
+		res := &current.Resolvers[i]
+
+		var prev corev1alpha1.DNSResolverStatus
+		for _, p := range previous.Resolvers {
+			if p.Resolver == res.Resolver {
+				prev = p
+				break
+			}
+		}
+
+		res.FirstSeenOK = firstSeenOK(prev.OK, prev.FirstSeenOK, res.OK, now)
+	}
+}
+
+func firstSeenOK(wasOK bool, seen *v1.Time, ok bool, now v1.Time) *v1.Time {
+	if !ok {
+		return nil
+	}
+
+	if wasOK && seen != nil {
+		return seen
+	}
+
+	return &now
+}
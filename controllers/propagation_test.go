@@ -0,0 +1,66 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+)
+
+func TestTrackPropagation(t *testing.T) {
+	first := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+
+	check := func(ok ...bool) corev1alpha1.DNSStatusStats {
+		stats := corev1alpha1.DNSStatusStats{OK: true}
+		for i, o := range ok {
+			stats.Resolvers = append(stats.Resolvers, corev1alpha1.DNSResolverStatus{Resolver: []string{"a", "b"}[i], OK: o})
+			stats.OK = stats.OK && o
+		}
+		return stats
+	}
+
+	previous := &corev1alpha1.DNSStatus{}
+	current := &corev1alpha1.DNSStatus{
+		SFP:           check(true, false),
+		DKIMSelectors: []corev1alpha1.DNSStatusDKIMSelector{{Selector: "s1", DNSStatusStats: check(true)}},
+	}
+
+	trackPropagation(previous, current, first)
+
+	assert.Nil(t, current.SFP.FirstSeenOK)
+	assert.Equal(t, first, current.SFP.Resolvers[0].FirstSeenOK.Time)
+	assert.Nil(t, current.SFP.Resolvers[1].FirstSeenOK)
+	assert.Equal(t, first, current.DKIMSelectors[0].FirstSeenOK.Time)
+
+	previous, current = current, &corev1alpha1.DNSStatus{
+		SFP:           check(true, true),
+		DKIMSelectors: []corev1alpha1.DNSStatusDKIMSelector{{Selector: "s1", DNSStatusStats: check(false)}},
+	}
+
+	trackPropagation(previous, current, second)
+
+	assert.Equal(t, second, current.SFP.FirstSeenOK.Time)
+	assert.Equal(t, first, current.SFP.Resolvers[0].FirstSeenOK.Time, "first seen should be kept while passing")
+	assert.Equal(t, second, current.SFP.Resolvers[1].FirstSeenOK.Time)
+	assert.Nil(t, current.DKIMSelectors[0].FirstSeenOK, "first seen should be reset when failing")
+	assert.Nil(t, current.DKIMSelectors[0].Resolvers[0].FirstSeenOK)
+}
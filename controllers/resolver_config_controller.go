@@ -0,0 +1,87 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/kannon-email/k8nnon/internal/dns/resolver"
+)
+
+// ResolverConfigKey is the ConfigMap key holding the resolver configuration.
+const ResolverConfigKey = "config.yaml"
+
+// ResolverConfigReconciler keeps the default resolvers of the pool in sync
+// with a ConfigMap. When the ConfigMap is deleted the static defaults are
+// restored, when it is invalid the current resolvers are kept.
+type ResolverConfigReconciler struct {
+	client.Client
+
+	Resolvers *resolver.Pool
+	ConfigMap types.NamespacedName
+
+	// Defaults are the resolvers used when the ConfigMap does not exist.
+	Defaults []string
+}
+
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
+
+func (r *ResolverConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	cm := &corev1.ConfigMap{}
+	err := r.Get(ctx, r.ConfigMap, cm)
+	if errors.IsNotFound(err) {
+		l.Info("resolver configmap not found, using default resolvers", "resolvers", r.Defaults)
+		return ctrl.Result{}, r.Resolvers.SetDefaults(r.Defaults)
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	config, err := resolver.ParseConfig([]byte(cm.Data[ResolverConfigKey]))
+	if err != nil {
+		// Retrying does not help until the ConfigMap is fixed, which
+		// triggers a new reconciliation.
+		l.Error(err, "invalid resolver configmap, keeping current resolvers", "configmap", r.ConfigMap)
+		return ctrl.Result{}, nil
+	}
+
+	l.Info("updating resolvers", "resolvers", config.Resolvers)
+
+	return ctrl.Result{}, r.Resolvers.SetDefaults(config.Resolvers)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ResolverConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	isConfigMap := predicate.NewPredicateFuncs(func(o client.Object) bool {
+		return o.GetName() == r.ConfigMap.Name && o.GetNamespace() == r.ConfigMap.Namespace
+	})
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("resolverconfig").
+		For(&corev1.ConfigMap{}, builder.WithPredicates(isConfigMap)).
+		Complete(r)
+}
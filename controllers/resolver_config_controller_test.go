@@ -0,0 +1,64 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kannon-email/k8nnon/internal/dns/resolver"
+)
+
+func TestResolverConfigReconciler(t *testing.T) {
+	ctx := context.Background()
+	name := types.NamespacedName{Namespace: "k8nnon-system", Name: "resolvers"}
+
+	pool, err := resolver.NewPool("8.8.8.8")
+	assert.Nil(t, err)
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{Namespace: name.Namespace, Name: name.Name},
+		Data:       map[string]string{ResolverConfigKey: "resolvers:\n- 10.0.0.53\n"},
+	}
+
+	c := fake.NewClientBuilder().WithObjects(cm).Build()
+	r := &ResolverConfigReconciler{Client: c, Resolvers: pool, ConfigMap: name, Defaults: []string{"8.8.8.8"}}
+
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: name})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.53:53"}, pool.Defaults())
+
+	cm.Data[ResolverConfigKey] = "resolvers:\n- not a resolver\n"
+	assert.Nil(t, c.Update(ctx, cm))
+
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: name})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.53:53"}, pool.Defaults(), "invalid configuration should be ignored")
+
+	assert.Nil(t, c.Delete(ctx, cm))
+
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: name})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"8.8.8.8:53"}, pool.Defaults())
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	netwrkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+)
+
+// invalidRoutingError reports a routing of the stats endpoint that cannot
+// be set up, only fixing the spec or the cluster solves it.
+type invalidRoutingError struct {
+	reason string
+	msg    string
+}
+
+func (e *invalidRoutingError) Error() string {
+	return e.msg
+}
+
+func isInvalidRouting(err error) bool {
+	var routingErr *invalidRoutingError
+	return errors.As(err, &routingErr)
+}
+
+func usesHTTPRoute(domain *corev1alpha1.Domain) bool {
+	return domain.Spec.Routing == corev1alpha1.RoutingHTTPRoute
+}
+
+// reconcileRouting exposes the stats endpoint with the routing of the spec,
+// and removes the objects of the other routing when it changes.
+func (r *DomainReconciler) reconcileRouting(ctx context.Context, domain *corev1alpha1.Domain, l logr.Logger) error {
+	if usesHTTPRoute(domain) {
+		if err := r.deleteStatsIngress(ctx, domain); err != nil {
+			return err
+		}
+		return r.reconcileHTTPRoute(ctx, domain, l)
+	}
+
+	if err := r.deleteHTTPRoute(ctx, domain); err != nil {
+		return err
+	}
+	return r.reconcileIngress(ctx, domain, l)
+}
+
+// deleteStatsIngress deletes the stats ingress created by the operator.
+func (r *DomainReconciler) deleteStatsIngress(ctx context.Context, domain *corev1alpha1.Domain) error {
+	ingress := &netwrkingv1.Ingress{}
+	err := r.Get(ctx, types.NamespacedName{Name: statsIngressName(domain), Namespace: domain.Namespace}, ingress)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	if !v1.IsControlledBy(ingress, domain) || ingress.DeletionTimestamp != nil {
+		return nil
+	}
+
+	if err := r.Delete(ctx, ingress); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	r.Recorder.Eventf(domain, corev1.EventTypeNormal, EventIngressDeleted, "deleted stats ingress %s, the stats endpoint is routed by an HTTPRoute", ingress.Name)
+	return nil
+}
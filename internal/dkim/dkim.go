@@ -0,0 +1,105 @@
+package dkim
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+)
+
+// RSAKeySize is the size of generated RSA keys, as recommended by RFC 8301.
+const RSAKeySize = 2048
+
+// GenerateKey generates a new DKIM key pair of the given type and returns
+// the PEM encoded PKCS #8 private key and the public key as published in
+// the DKIM record.
+func GenerateKey(keyType string) ([]byte, string, error) {
+	var key crypto.Signer
+	var err error
+
+	switch keyType {
+	case corev1alpha1.DKimKeyTypeRSA, "":
+		key, err = rsa.GenerateKey(rand.Reader, RSAKeySize)
+	case corev1alpha1.DKimKeyTypeEd25519:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, "", fmt.Errorf("unsupported key type %q", keyType)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	publicKey, err := encodePublicKey(key.Public())
+	if err != nil {
+		return nil, "", err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), publicKey, nil
+}
+
+// PublicKey returns the DKIM public key data matching a PEM encoded private
+// key generated by GenerateKey.
+func PublicKey(keyType string, privateKeyPEM []byte) (string, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return "", fmt.Errorf("invalid PEM private key")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		if keyType != corev1alpha1.DKimKeyTypeRSA {
+			return "", fmt.Errorf("private key is not of type %s", keyType)
+		}
+		return encodePublicKey(key.Public())
+	case ed25519.PrivateKey:
+		if keyType != corev1alpha1.DKimKeyTypeEd25519 {
+			return "", fmt.Errorf("private key is not of type %s", keyType)
+		}
+		return encodePublicKey(key.Public())
+	default:
+		return "", fmt.Errorf("unsupported private key %T", key)
+	}
+}
+
+// Record returns the TXT record publishing the given public key.
+func Record(keyType, publicKey string) string {
+	if keyType == "" {
+		keyType = corev1alpha1.DKimKeyTypeRSA
+	}
+
+	return fmt.Sprintf("v=DKIM1; k=%s; p=%s", keyType, publicKey)
+}
+
+// RecordName returns the name of the TXT record of selector.
+func RecordName(selector, domainName string) string {
+	return fmt.Sprintf("%s._domainkey.%s", selector, domainName)
+}
+
+func encodePublicKey(key crypto.PublicKey) (string, error) {
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		return base64.StdEncoding.EncodeToString(key), nil
+	default:
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(der), nil
+	}
+}
@@ -0,0 +1,39 @@
+package dkim_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+	"github.com/kannon-email/k8nnon/internal/dkim"
+	"github.com/kannon-email/k8nnon/internal/dns/checker"
+)
+
+func TestGenerateKey(t *testing.T) {
+	for _, keyType := range []string{corev1alpha1.DKimKeyTypeRSA, corev1alpha1.DKimKeyTypeEd25519} {
+		privateKey, publicKey, err := dkim.GenerateKey(keyType)
+		assert.Nil(t, err)
+
+		derived, err := dkim.PublicKey(keyType, privateKey)
+		assert.Nil(t, err)
+		assert.Equal(t, publicKey, derived)
+
+		record, err := checker.ParseDKIM(dkim.Record(keyType, publicKey))
+		assert.Nil(t, err, "generated %s record should be valid", keyType)
+		assert.Equal(t, keyType, record.KeyType)
+	}
+}
+
+func TestPublicKeyTypeMismatch(t *testing.T) {
+	privateKey, _, err := dkim.GenerateKey(corev1alpha1.DKimKeyTypeEd25519)
+	assert.Nil(t, err)
+
+	_, err = dkim.PublicKey(corev1alpha1.DKimKeyTypeRSA, privateKey)
+	assert.NotNil(t, err)
+}
+
+func TestRecord(t *testing.T) {
+	assert.Equal(t, "v=DKIM1; k=rsa; p=key", dkim.Record("", "key"))
+	assert.Equal(t, "kannon._domainkey.example.com", dkim.RecordName("kannon", "example.com"))
+}
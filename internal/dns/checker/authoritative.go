@@ -0,0 +1,235 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/kannon-email/k8nnon/internal/dns/resolver"
+)
+
+// Checker modes.
+const (
+	// ModeRecursive queries the configured recursive resolvers.
+	ModeRecursive = "recursive"
+	// ModeAuthoritative queries the authoritative nameservers of the zone
+	// directly, bypassing the caches of recursive resolvers.
+	ModeAuthoritative = "authoritative"
+)
+
+// nameserverPort is the port authoritative nameservers are queried on.
+var nameserverPort = "53"
+
+// NameserverFunc returns the resolver querying the authoritative nameserver
+// at addr, e.g. resolver.NewAuthoritativeResolver or Pool.Nameserver.
+type NameserverFunc func(addr string) (resolver.Resolver, error)
+
+// NewAuthoritativeDNSChecker returns a checker querying each authoritative
+// nameserver of the zone of the domain through nameserver. The resolvers are
+// used to discover the nameservers and to resolve names outside the zone,
+// like SPF includes.
+func NewAuthoritativeDNSChecker(nameserver NameserverFunc, r ...resolver.Resolver) *DNSChecker {
+	return &DNSChecker{
+		resolvers:   r,
+		nameservers: &nameserverCache{zones: map[string]nameserverResult{}},
+		nameserver:  nameserver,
+	}
+}
+
+// Nameservers returns the authoritative nameservers queried for domainName,
+// or nil when the checker is not in authoritative mode.
+func (d DNSChecker) Nameservers(ctx context.Context, domainName string) ([]string, error) {
+	if d.nameservers == nil {
+		return nil, nil
+	}
+
+	servers, err := d.authoritativeResolvers(ctx, domainName)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(servers))
+	for i, s := range servers {
+		names = append(names, resolver.Name(s, i))
+	}
+
+	return names, nil
+}
+
+type nameserverResult struct {
+	resolvers []resolver.Resolver
+	err       error
+}
+
+// nameserverCache holds the nameservers discovered by a checker, so that
+// they are looked up once per zone and not once per check.
+type nameserverCache struct {
+	mu    sync.Mutex
+	zones map[string]nameserverResult
+}
+
+func (d DNSChecker) authoritativeResolvers(ctx context.Context, domainName string) ([]resolver.Resolver, error) {
+	c := d.nameservers
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if res, ok := c.zones[domainName]; ok {
+		return res.resolvers, res.err
+	}
+
+	resolvers, err := d.discoverNameservers(ctx, domainName)
+	c.zones[domainName] = nameserverResult{resolvers: resolvers, err: err}
+
+	return resolvers, err
+}
+
+// discoverNameservers finds the zone containing domainName and returns a
+// resolver for each of its authoritative nameservers.
+func (d DNSChecker) discoverNameservers(ctx context.Context, domainName string) ([]resolver.Resolver, error) {
+	var lastErr error
+	for _, r := range d.resolvers {
+		zone, nss, err := findZone(ctx, r, domainName)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		var servers []resolver.Resolver
+		for _, ns := range nss {
+			server, err := d.newNameserver(ctx, r, zone, ns.Host)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			servers = append(servers, server)
+		}
+
+		if len(servers) == 0 {
+			return nil, fmt.Errorf("no reachable nameserver for zone %s: %w", zone, lastErr)
+		}
+
+		return servers, nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no resolver configured")
+	}
+
+	return nil, fmt.Errorf("cannot discover the nameservers of %s: %w", domainName, lastErr)
+}
+
+// findZone walks up the labels of name until it finds the apex of the zone
+// containing it, and returns the zone with its NS records.
+func findZone(ctx context.Context, r resolver.Resolver, name string) (string, []*net.NS, error) {
+	name = normalizeDomain(name)
+
+	for strings.Contains(name, ".") {
+		nss, err := r.LookupNS(ctx, name)
+		if err == nil && len(nss) > 0 {
+			return name, nss, nil
+		}
+		if err != nil && !isNotFound(err) {
+			return "", nil, err
+		}
+
+		_, name, _ = strings.Cut(name, ".")
+	}
+
+	return "", nil, fmt.Errorf("no NS record found for %s or its parents", name)
+}
+
+func (d DNSChecker) newNameserver(ctx context.Context, r resolver.Resolver, zone, host string) (resolver.Resolver, error) {
+	addrs, err := r.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	// IPv6 is often not routable from inside clusters, prefer IPv4.
+	addr := addrs[0]
+	for _, a := range addrs {
+		if ip := net.ParseIP(a); ip != nil && ip.To4() != nil {
+			addr = a
+			break
+		}
+	}
+
+	server, err := d.nameserver(net.JoinHostPort(addr, nameserverPort))
+	if err != nil {
+		return nil, err
+	}
+
+	return &zoneResolver{
+		Resolver: server,
+		name:     normalizeDomain(host),
+		zone:     zone,
+		fallback: r,
+	}, nil
+}
+
+// zoneResolver sends the queries for names inside zone to an authoritative
+// nameserver and the others to a fallback recursive resolver.
+type zoneResolver struct {
+	resolver.Resolver
+
+	name     string
+	zone     string
+	fallback resolver.Resolver
+}
+
+func (z *zoneResolver) String() string {
+	return z.name
+}
+
+func (z *zoneResolver) resolverFor(name string) resolver.Resolver {
+	name = normalizeDomain(name)
+	if name == z.zone || strings.HasSuffix(name, "."+z.zone) {
+		return z.Resolver
+	}
+
+	return z.fallback
+}
+
+func (z *zoneResolver) LookupCNAME(ctx context.Context, name string) (string, error) {
+	return z.resolverFor(name).LookupCNAME(ctx, name)
+}
+
+func (z *zoneResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return z.resolverFor(host).LookupHost(ctx, host)
+}
+
+func (z *zoneResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	return z.resolverFor(name).LookupMX(ctx, name)
+}
+
+func (z *zoneResolver) LookupNS(ctx context.Context, name string) ([]*net.NS, error) {
+	return z.resolverFor(name).LookupNS(ctx, name)
+}
+
+func (z *zoneResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return z.resolverFor(name).LookupTXT(ctx, name)
+}
+
+// inconsistent reports whether the authoritative nameservers disagree on
+// the outcome of a check or on the record they serve, or some of them are
+// lame.
+func inconsistent(results []ResolverResult) bool {
+	ok := 0
+	values := map[string]bool{}
+	for _, res := range results {
+		if res.Lame {
+			return true
+		}
+		if res.OK {
+			ok++
+		}
+		if res.Error == "" {
+			values[res.Value] = true
+		}
+	}
+
+	return ok > 0 && ok < len(results) || len(values) > 1
+}
@@ -0,0 +1,164 @@
+package checker_test
+
+import (
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	mockdns "github.com/foxcpp/go-mockdns"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kannon-email/k8nnon/internal/dns/checker"
+	"github.com/kannon-email/k8nnon/internal/dns/resolver"
+)
+
+// startNameservers serves each zone set on a different loopback address,
+// all on the same port, and sets it as the nameserver port.
+func startNameservers(t *testing.T, servers map[string]*mockdns.Server) {
+	l, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.Nil(t, err)
+	port := l.LocalAddr().(*net.UDPAddr).Port
+	assert.Nil(t, l.Close())
+
+	for ip, handler := range servers {
+		conn, err := net.ListenPacket("udp4", net.JoinHostPort(ip, strconv.Itoa(port)))
+		if err != nil {
+			t.Skipf("cannot listen on %s: %s", ip, err)
+		}
+
+		srv := &dns.Server{PacketConn: conn, Handler: handler}
+		go func() { _ = srv.ActivateAndServe() }()
+
+		t.Cleanup(func() {
+			_ = srv.Shutdown()
+			_ = handler.Close()
+		})
+	}
+
+	t.Cleanup(checker.SetNameserverPort(strconv.Itoa(port)))
+}
+
+func newNameserver(t *testing.T, zones map[string]mockdns.Zone, authoritative bool) *mockdns.Server {
+	srv, err := mockdns.NewServerWithLogger(zones, log.New(io.Discard, "", 0), authoritative)
+	assert.Nil(t, err)
+	return srv
+}
+
+func recursiveResolver() *mockdns.Resolver {
+	return &mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"example.com.": {
+				NS: []net.NS{{Host: "ns1.example.com."}, {Host: "ns2.example.com."}, {Host: "ns3.example.com."}},
+			},
+			"ns1.example.com.": {A: []string{"127.0.0.1"}},
+			"ns2.example.com.": {A: []string{"127.0.0.2"}},
+			"ns3.example.com.": {A: []string{"127.0.0.3"}},
+			"mx.kannon.io.": {
+				TXT: []string{"v=spf1 ip4:192.0.2.0/24 -all"},
+			},
+		},
+	}
+}
+
+func TestAuthoritativeConsistent(t *testing.T) {
+	ctx := createContext(t)
+
+	zones := map[string]mockdns.Zone{
+		"_dmarc.example.com.": {TXT: []string{"v=DMARC1; p=reject"}},
+		"example.com.":        {TXT: []string{"v=spf1 include:mx.kannon.io -all"}},
+	}
+
+	startNameservers(t, map[string]*mockdns.Server{
+		"127.0.0.1": newNameserver(t, zones, true),
+		"127.0.0.2": newNameserver(t, zones, true),
+		"127.0.0.3": newNameserver(t, zones, true),
+	})
+
+	domain := createDomain(t)
+	c := checker.NewAuthoritativeDNSChecker(resolver.NewAuthoritativeResolver, recursiveResolver())
+
+	nameservers, err := c.Nameservers(ctx, domain.Spec.DomainName)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ns1.example.com", "ns2.example.com", "ns3.example.com"}, nameservers)
+
+	res := c.CheckDomainDMARC(ctx, domain)
+	assert.True(t, res.Result(), "should have resolved DMARC")
+	assert.Equal(t, 3, res.CntOK)
+	assert.False(t, res.Inconsistent)
+
+	// The SPF include is outside the zone and resolved recursively.
+	domain.Spec.BaseDomain = "mx.kannon.io"
+	res = c.CheckDomainSPF(ctx, domain)
+	assert.True(t, res.Result(), "should have resolved SPF: %s", res.Reason)
+}
+
+func TestAuthoritativeInconsistent(t *testing.T) {
+	ctx := createContext(t)
+
+	synced := map[string]mockdns.Zone{
+		"_dmarc.example.com.": {TXT: []string{"v=DMARC1; p=reject"}},
+	}
+	stale := map[string]mockdns.Zone{
+		"example.com.": {},
+	}
+
+	startNameservers(t, map[string]*mockdns.Server{
+		"127.0.0.1": newNameserver(t, synced, true),
+		"127.0.0.2": newNameserver(t, stale, true),
+		"127.0.0.3": newNameserver(t, synced, false),
+	})
+
+	domain := createDomain(t)
+	c := checker.NewAuthoritativeDNSChecker(resolver.NewAuthoritativeResolver, recursiveResolver())
+
+	res := c.CheckDomainDMARC(ctx, domain)
+	assert.False(t, res.Result(), "should not have resolved DMARC")
+	assert.True(t, res.Inconsistent)
+
+	assert.Equal(t, "ns1.example.com", res.Results[0].Resolver)
+	assert.True(t, res.Results[0].OK)
+	assert.Equal(t, "v=DMARC1; p=reject", res.Results[0].Value)
+	assert.Equal(t, 9999*time.Second, *res.Results[0].TTL)
+	assert.Equal(t, "no DMARC record found at _dmarc.example.com", res.Results[1].Reason)
+	assert.True(t, res.Results[2].Lame, "non authoritative answers should be reported as lame")
+	assert.Contains(t, res.Results[2].Error, "lame delegation")
+}
+
+func TestAuthoritativeDifferentRecords(t *testing.T) {
+	ctx := createContext(t)
+
+	startNameservers(t, map[string]*mockdns.Server{
+		"127.0.0.1": newNameserver(t, map[string]mockdns.Zone{
+			"_dmarc.example.com.": {TXT: []string{"v=DMARC1; p=reject"}},
+		}, true),
+		"127.0.0.2": newNameserver(t, map[string]mockdns.Zone{
+			"_dmarc.example.com.": {TXT: []string{"v=DMARC1; p=reject; rua=mailto:dmarc@example.com"}},
+		}, true),
+		"127.0.0.3": newNameserver(t, map[string]mockdns.Zone{
+			"_dmarc.example.com.": {TXT: []string{"v=DMARC1; p=reject"}},
+		}, true),
+	})
+
+	domain := createDomain(t)
+	c := checker.NewAuthoritativeDNSChecker(resolver.NewAuthoritativeResolver, recursiveResolver())
+
+	res := c.CheckDomainDMARC(ctx, domain)
+	assert.Equal(t, 3, res.CntOK)
+	assert.True(t, res.Inconsistent, "nameservers serving different records should be inconsistent")
+}
+
+func TestAuthoritativeNoZone(t *testing.T) {
+	ctx := createContext(t)
+
+	domain := createDomain(t)
+	c := checker.NewAuthoritativeDNSChecker(resolver.NewAuthoritativeResolver, &mockdns.Resolver{})
+
+	res := c.CheckDomainDMARC(ctx, domain)
+	assert.False(t, res.Result())
+	assert.Equal(t, 1, res.CntErr)
+	assert.Contains(t, res.Reason, "cannot discover the nameservers of example.com")
+}
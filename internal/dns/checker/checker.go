@@ -2,10 +2,12 @@ package checker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
 	"sync"
+	"time"
 
 	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
 	"github.com/kannon-email/k8nnon/internal/dns/resolver"
@@ -13,6 +15,12 @@ import (
 
 type DNSChecker struct {
 	resolvers []resolver.Resolver
+	policy    Policy
+
+	// nameservers is set in authoritative mode.
+	nameservers *nameserverCache
+	// nameserver returns the resolver of an authoritative nameserver.
+	nameserver NameserverFunc
 }
 
 var ServerAddresses = []string{
@@ -28,36 +36,225 @@ var ServerAddresses = []string{
 	"8.20.247.20",
 }
 
+// DNSCheckStats is the outcome of a check. Resolvers validating the record
+// are counted in CntOK, the ones answering with a wrong or missing record in
+// CntKO and the ones whose lookup failed in CntErr. Unhealthy resolvers, see
+// resolver.ErrUnhealthy, are counted apart in CntUnhealthy.
 type DNSCheckStats struct {
-	CntOK  int
-	CntKO  int
-	CntErr int
+	CntOK        int
+	CntKO        int
+	CntErr       int
+	CntUnhealthy int
+
+	// Policy decides whether the check passes.
+	Policy Policy
+
+	// Reason is the most common failure reason reported by the resolvers
+	// that did not validate the record.
+	Reason string
+
+	// Results holds the outcome of the check on each resolver, in the
+	// order the resolvers were given to the checker. In authoritative mode
+	// there is a result for each nameserver of the zone.
+	Results []ResolverResult
+
+	// Inconsistent is set in authoritative mode when the nameservers
+	// disagree on the outcome of the check or some of them are lame.
+	Inconsistent bool
+
+	// DNSSEC is the weakest DNSSEC state of the answers of the resolvers,
+	// empty when DNSSEC is not validated.
+	DNSSEC resolver.DNSSECState
+}
+
+// ResolverResult is the outcome of a check on a single resolver.
+type ResolverResult struct {
+	Resolver string `json:"resolver"`
+	OK       bool   `json:"ok"`
+	Lame     bool   `json:"lame,omitempty"`
+	// Unhealthy is set when the resolver was not queried because it failed
+	// repeatedly.
+	Unhealthy bool `json:"unhealthy,omitempty"`
+
+	// Value is the record observed by the resolver, if any.
+	Value string `json:"value,omitempty"`
+	// Reason explains why the observed record does not pass the check.
+	Reason string `json:"reason,omitempty"`
+	// Error is set when the lookup failed.
+	Error string `json:"error,omitempty"`
+	// DNSSEC is the DNSSEC state of the answers the check relied on.
+	DNSSEC resolver.DNSSECState `json:"dnssec,omitempty"`
+
+	Latency time.Duration `json:"latency"`
+	// TTL is the lowest TTL of the answers the check relied on, nil when
+	// the resolver does not report it.
+	TTL *time.Duration `json:"ttl,omitempty"`
 }
 
+// Result reports whether the check passes according to its policy.
 func (c DNSCheckStats) Result() bool {
-	return c.CntOK > c.CntKO+c.CntErr
+	return c.Policy.Passes(c)
 }
 
 func NewDNSChecker(r ...resolver.Resolver) *DNSChecker {
 	return &DNSChecker{resolvers: r}
 }
 
-type checkFunc func(ctx context.Context, r resolver.Resolver, domain *corev1alpha1.Domain) (bool, error)
+// WithPolicy returns a copy of the checker using policy to decide whether
+// a check passes.
+func (d DNSChecker) WithPolicy(policy Policy) *DNSChecker {
+	d.policy = policy
+	return &d
+}
+
+type checkResult struct {
+	ok     bool
+	reason string
+	value  string
+}
+
+// observed sets the record observed by the check.
+func (c checkResult) observed(value string) checkResult {
+	c.value = value
+	return c
+}
+
+func checkOK() checkResult {
+	return checkResult{ok: true}
+}
+
+func checkKO(format string, args ...interface{}) checkResult {
+	return checkResult{reason: fmt.Sprintf(format, args...)}
+}
+
+type checkFunc func(ctx context.Context, r resolver.Resolver, domain *corev1alpha1.Domain) (checkResult, error)
 
 func (d DNSChecker) CheckDomainDKim(ctx context.Context, domain *corev1alpha1.Domain) DNSCheckStats {
 	return d.checkDNS(ctx, domain, checkDomainDKim)
 }
 
+// CheckDKimSelector checks a single DKIM selector of the domain.
+func (d DNSChecker) CheckDKimSelector(ctx context.Context, domain *corev1alpha1.Domain, selector corev1alpha1.DKimSelector) DNSCheckStats {
+	return d.checkDNS(ctx, domain, func(ctx context.Context, r resolver.Resolver, domain *corev1alpha1.Domain) (checkResult, error) {
+		return checkDKimSelector(ctx, r, domain, selector)
+	})
+}
+
+// CombineDKimSelectors returns the DKIM check of the domain from the checks
+// of its selectors, in the order of domain.DKimSelectors, as CheckDomainDKim
+// would report it without looking the records up again: a resolver
+// validates the DKIM records when it validates every selector, otherwise
+// its result is the one of the first selector it did not validate.
+func (d DNSChecker) CombineDKimSelectors(selectors []DNSCheckStats) DNSCheckStats {
+	if len(selectors) == 0 {
+		return DNSCheckStats{CntKO: 1, Policy: d.policy, Reason: "no DKIM selector configured"}
+	}
+
+	for _, stats := range selectors {
+		// The nameservers of the zone could not be discovered.
+		if len(stats.Results) == 0 {
+			return stats
+		}
+	}
+
+	combined := DNSCheckStats{Policy: d.policy}
+	reasons := map[string]int{}
+
+	for _, first := range selectors[0].Results {
+		res := ResolverResult{Resolver: first.Resolver, OK: true}
+		failed := false
+
+		var values []string
+		for _, stats := range selectors {
+			selectorRes, ok := findResult(stats.Results, first.Resolver)
+			if !ok {
+				selectorRes = ResolverResult{Resolver: first.Resolver, Error: "the resolver did not check every DKIM selector"}
+			}
+
+			if !failed && (!selectorRes.OK || selectorRes.Error != "") {
+				failed = true
+				res.OK = false
+				res.Lame, res.Unhealthy = selectorRes.Lame, selectorRes.Unhealthy
+				res.Value, res.Reason, res.Error = selectorRes.Value, selectorRes.Reason, selectorRes.Error
+			}
+			values = append(values, selectorRes.Value)
+
+			res.Latency += selectorRes.Latency
+			if selectorRes.TTL != nil && (res.TTL == nil || *selectorRes.TTL < *res.TTL) {
+				res.TTL = selectorRes.TTL
+			}
+			if selectorRes.DNSSEC.Weaker(res.DNSSEC) {
+				res.DNSSEC = selectorRes.DNSSEC
+			}
+		}
+		if !failed {
+			res.Value = strings.Join(values, " | ")
+		}
+
+		combined.Results = append(combined.Results, res)
+		if res.DNSSEC.Weaker(combined.DNSSEC) {
+			combined.DNSSEC = res.DNSSEC
+		}
+		switch {
+		case res.Unhealthy:
+			combined.CntUnhealthy += 1
+		case res.Error != "":
+			combined.CntErr += 1
+			reasons[res.Error] += 1
+		case res.OK:
+			combined.CntOK += 1
+		default:
+			combined.CntKO += 1
+			reasons[res.Reason] += 1
+		}
+	}
+
+	combined.Reason = mostCommonReason(reasons)
+
+	if d.nameservers != nil {
+		combined.Inconsistent = inconsistent(combined.Results)
+	}
+
+	return combined
+}
+
+func findResult(results []ResolverResult, name string) (ResolverResult, bool) {
+	for _, res := range results {
+		if res.Resolver == name {
+			return res, true
+		}
+	}
+
+	return ResolverResult{}, false
+}
+
 func (d DNSChecker) CheckDomainSPF(ctx context.Context, domain *corev1alpha1.Domain) DNSCheckStats {
 	return d.checkDNS(ctx, domain, checkDomainSPF)
 }
 
+func (d DNSChecker) CheckDomainDMARC(ctx context.Context, domain *corev1alpha1.Domain) DNSCheckStats {
+	return d.checkDNS(ctx, domain, checkDomainDMARC)
+}
+
 func (d DNSChecker) CheckDomainStatsDNS(ctx context.Context, domain *corev1alpha1.Domain) DNSCheckStats {
 	return d.checkDNS(ctx, domain, checkDomainStatsDNS)
 }
 
 func (d DNSChecker) checkDNS(ctx context.Context, domain *corev1alpha1.Domain, checkFunc checkFunc) DNSCheckStats {
-	result := DNSCheckStats{}
+	resolvers := d.resolvers
+	if d.nameservers != nil {
+		var err error
+		resolvers, err = d.authoritativeResolvers(ctx, domain.Spec.DomainName)
+		if err != nil {
+			return DNSCheckStats{CntErr: 1, Policy: d.policy, Reason: err.Error()}
+		}
+	}
+
+	result := DNSCheckStats{
+		Policy:  d.policy,
+		Results: make([]ResolverResult, len(resolvers)),
+	}
+	reasons := map[string]int{}
 
 	wg := sync.WaitGroup{}
 	m := sync.Mutex{}
@@ -65,88 +262,223 @@ func (d DNSChecker) checkDNS(ctx context.Context, domain *corev1alpha1.Domain, c
 	innertCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	for _, res := range d.resolvers {
+	for i, res := range resolvers {
 		wg.Add(1)
 
-		go func(r resolver.Resolver) {
+		go func(i int, r resolver.Resolver) {
 			defer wg.Done()
 
-			status, err := checkFunc(innertCtx, r, domain)
-			m.Lock()
+			traceCtx, trace := resolver.WithTrace(innertCtx)
+			start := time.Now()
+			status, err := checkFunc(traceCtx, r, domain)
+
+			res := ResolverResult{
+				Resolver: resolver.Name(r, i),
+				OK:       status.ok,
+				Value:    status.value,
+				Reason:   status.reason,
+				Latency:  time.Since(start),
+			}
+			if ttl, ok := trace.TTL(); ok {
+				res.TTL = &ttl
+			}
+			res.DNSSEC = trace.DNSSEC()
+			if res.DNSSEC == resolver.DNSSECBogus && err == nil && status.ok {
+				// Receivers validating DNSSEC ignore bogus records.
+				status = checkKO("DNSSEC validation failed for the records of %s", domain.Spec.DomainName).observed(status.value)
+				res.OK = false
+				res.Reason = status.reason
+			}
 			if err != nil {
-				result.CntErr += 1
+				var lameErr *resolver.LameDelegationError
+				res.Lame = errors.As(err, &lameErr)
+				res.Unhealthy = errors.Is(err, resolver.ErrUnhealthy)
+				res.Error = err.Error()
+				status.reason = err.Error()
+			}
+
+			m.Lock()
+			result.Results[i] = res
+			if res.DNSSEC.Weaker(result.DNSSEC) {
+				result.DNSSEC = res.DNSSEC
 			}
-			if status {
+			switch {
+			case res.Unhealthy:
+				result.CntUnhealthy += 1
+			case err != nil:
+				result.CntErr += 1
+				reasons[status.reason] += 1
+			case status.ok:
 				result.CntOK += 1
-			} else {
+			default:
 				result.CntKO += 1
+				reasons[status.reason] += 1
 			}
 			m.Unlock()
-		}(res)
+		}(i, res)
 	}
 
 	wg.Wait()
 
+	result.Reason = mostCommonReason(reasons)
+
+	if d.nameservers != nil {
+		result.Inconsistent = inconsistent(result.Results)
+	}
+
 	return result
 }
 
-func checkDomainDKim(ctx context.Context, r resolver.Resolver, domain *corev1alpha1.Domain) (bool, error) {
-	sub := fmt.Sprintf("%s._domainkey.%s", domain.Spec.DKim.Selector, domain.Spec.DomainName)
+func mostCommonReason(reasons map[string]int) string {
+	reason := ""
+	for r, cnt := range reasons {
+		if cnt > reasons[reason] || (cnt == reasons[reason] && r < reason) {
+			reason = r
+		}
+	}
+
+	return reason
+}
+
+func checkDomainDKim(ctx context.Context, r resolver.Resolver, domain *corev1alpha1.Domain) (checkResult, error) {
+	selectors := domain.DKimSelectors()
+	if len(selectors) == 0 {
+		return checkKO("no DKIM selector configured"), nil
+	}
+
+	var values []string
+	for _, selector := range selectors {
+		res, err := checkDKimSelector(ctx, r, domain, selector)
+		if err != nil || !res.ok {
+			return res, err
+		}
+		values = append(values, res.value)
+	}
+
+	return checkOK().observed(strings.Join(values, " | ")), nil
+}
+
+func checkDKimSelector(ctx context.Context, r resolver.Resolver, domain *corev1alpha1.Domain, selector corev1alpha1.DKimSelector) (checkResult, error) {
+	sub := fmt.Sprintf("%s._domainkey.%s", selector.Selector, domain.Spec.DomainName)
+
+	if selector.PublicKey == "" {
+		return checkKO("DKIM key for selector %s has not been generated yet", selector.Selector), nil
+	}
+
+	expected, err := ParseDKIMPublicKey(selector.KeyType, selector.PublicKey)
+	if err != nil {
+		return checkKO("configured DKIM public key for selector %s is invalid: %s", selector.Selector, err), nil
+	}
 
 	res, err := r.LookupTXT(ctx, sub)
 	if err != nil {
-		if dnsErr, ok := err.(*net.DNSError); ok {
-			if dnsErr.IsNotFound {
-				return false, nil
-			}
+		if isNotFound(err) {
+			return checkKO("no DKIM record found at %s", sub), nil
 		}
 
-		return false, err
+		return checkResult{}, err
 	}
 
+	observed := strings.Join(res, " | ")
+
+	var parseErr error
 	for _, txt := range res {
-		if txt == fmt.Sprintf("k=rsa; p=%s", domain.Spec.DKim.PublicKey) {
-			return true, nil
+		record, err := ParseDKIM(txt)
+		if err != nil {
+			parseErr = err
+			continue
 		}
+
+		if record.KeyType == selector.KeyType && record.Matches(expected) {
+			return checkOK().observed(txt), nil
+		}
+	}
+
+	if parseErr != nil {
+		return checkKO("invalid DKIM record at %s: %s", sub, parseErr).observed(observed), nil
 	}
 
-	return false, nil
+	return checkKO("DKIM record at %s does not match the expected %s public key", sub, selector.KeyType).observed(observed), nil
 }
 
-func checkDomainSPF(ctx context.Context, r resolver.Resolver, domain *corev1alpha1.Domain) (bool, error) {
-	res, err := r.LookupTXT(ctx, domain.Spec.DomainName)
+func checkDomainSPF(ctx context.Context, r resolver.Resolver, domain *corev1alpha1.Domain) (checkResult, error) {
+	res, err := EvaluateSPF(ctx, r, domain.Spec.DomainName)
 	if err != nil {
-		if dnsErr, ok := err.(*net.DNSError); ok {
-			if dnsErr.IsNotFound {
-				return false, nil
-			}
+		var permErr *SPFPermError
+		if errors.As(err, &permErr) {
+			return checkKO("%s", permErr.Error()), nil
 		}
 
-		return false, err
+		return checkResult{}, err
 	}
 
+	if !res.Authorizes(domain.Spec.BaseDomain) {
+		return checkKO("SPF record of %s does not include %s", domain.Spec.DomainName, domain.Spec.BaseDomain).observed(res.Record), nil
+	}
+
+	return checkOK().observed(res.Record), nil
+}
+
+func checkDomainDMARC(ctx context.Context, r resolver.Resolver, domain *corev1alpha1.Domain) (checkResult, error) {
+	sub := fmt.Sprintf("_dmarc.%s", domain.Spec.DomainName)
+
+	res, err := r.LookupTXT(ctx, sub)
+	if err != nil {
+		if isNotFound(err) {
+			return checkKO("no DMARC record found at %s", sub), nil
+		}
+
+		return checkResult{}, err
+	}
+
+	var records []string
 	for _, txt := range res {
-		if strings.Contains(txt, fmt.Sprintf("include:%s", domain.Spec.BaseDomain)) {
-			return true, nil
+		if isDMARCRecord(txt) {
+			records = append(records, txt)
 		}
 	}
 
-	return false, nil
+	// RFC 7489 6.6.3: multiple records mean no policy is applied.
+	switch len(records) {
+	case 0:
+		return checkKO("no DMARC record found at %s", sub).observed(strings.Join(res, " | ")), nil
+	case 1:
+	default:
+		return checkKO("found %d DMARC records at %s", len(records), sub).observed(strings.Join(records, " | ")), nil
+	}
+
+	record, err := ParseDMARC(records[0])
+	if err != nil {
+		return checkKO("invalid DMARC record at %s: %s", sub, err).observed(records[0]), nil
+	}
+
+	if !record.Enforces(domain.Spec.DMARC.Policy) {
+		return checkKO("DMARC policy %q is weaker than %q", record.Policy, domain.Spec.DMARC.Policy).observed(records[0]), nil
+	}
+
+	return checkOK().observed(records[0]), nil
 }
 
-func checkDomainStatsDNS(ctx context.Context, r resolver.Resolver, domain *corev1alpha1.Domain) (bool, error) {
+func checkDomainStatsDNS(ctx context.Context, r resolver.Resolver, domain *corev1alpha1.Domain) (checkResult, error) {
 	statsDomain := fmt.Sprintf("%s.%s", domain.Spec.StatsPrefix, domain.Spec.DomainName)
 
 	res, err := r.LookupCNAME(ctx, statsDomain)
 	if err != nil {
-		if dnsErr, ok := err.(*net.DNSError); ok {
-			if dnsErr.IsNotFound {
-				return false, nil
-			}
+		if isNotFound(err) {
+			return checkKO("no CNAME record found at %s", statsDomain), nil
 		}
 
-		return false, err
+		return checkResult{}, err
+	}
+
+	if res != domain.Spec.BaseDomain && res != domain.Spec.BaseDomain+"." {
+		return checkKO("CNAME %s points to %s instead of %s", statsDomain, res, domain.Spec.BaseDomain).observed(res), nil
 	}
 
-	return res == domain.Spec.BaseDomain || res == domain.Spec.BaseDomain+".", nil
+	return checkOK().observed(res), nil
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
 }
@@ -40,7 +40,7 @@ func TestDKimOk(t *testing.T) {
 		Zones: map[string]mockdns.Zone{
 			"selector._domainkey.example.com.": {
 				TXT: []string{
-					"k=rsa; p=publicKey",
+					"k=rsa; p=" + testPublicKey,
 				},
 			},
 		},
@@ -54,6 +54,168 @@ func TestDKimOk(t *testing.T) {
 	assert.True(t, res.Result(), "should have resolved DKIM")
 }
 
+func TestDKimRecordFormatting(t *testing.T) {
+	ctx := createContext(t)
+
+	r := mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"selector._domainkey.example.com.": {
+				TXT: []string{
+					"v=DKIM1;h=sha256 ; t=s;k=rsa;\tp=" + testPublicKey[:40] + " " + testPublicKey[40:] + ";",
+				},
+			},
+		},
+	}
+
+	domain := createDomain(t)
+
+	c := checker.NewDNSChecker(&r)
+
+	res := c.CheckDomainDKim(ctx, domain)
+	assert.True(t, res.Result(), "should have resolved DKIM")
+}
+
+func TestDKimInvalidRecord(t *testing.T) {
+	ctx := createContext(t)
+
+	r := mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"selector._domainkey.example.com.": {
+				TXT: []string{
+					"v=DKIM1; k=rsa; p=",
+				},
+			},
+		},
+	}
+
+	domain := createDomain(t)
+
+	c := checker.NewDNSChecker(&r)
+
+	res := c.CheckDomainDKim(ctx, domain)
+	assert.False(t, res.Result(), "should not have resolved DKIM")
+	assert.Equal(t, "invalid DKIM record at selector._domainkey.example.com: public key has been revoked", res.Reason)
+}
+
+func TestDKimMultipleSelectors(t *testing.T) {
+	ctx := createContext(t)
+
+	r := mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"selector._domainkey.example.com.": {
+				TXT: []string{
+					"v=DKIM1; k=rsa; p=" + testPublicKey,
+				},
+			},
+			"ed._domainkey.example.com.": {
+				TXT: []string{
+					"v=DKIM1; k=ed25519; p=" + testEd25519PublicKey,
+				},
+			},
+		},
+	}
+
+	domain := createDomain(t)
+	domain.Spec.DKim.Selectors = []corev1alpha1.DKimSelector{
+		{
+			Selector:  "ed",
+			KeyType:   corev1alpha1.DKimKeyTypeEd25519,
+			PublicKey: testEd25519PublicKey,
+		},
+	}
+
+	c := checker.NewDNSChecker(&r)
+
+	res := c.CheckDomainDKim(ctx, domain)
+	assert.True(t, res.Result(), "should have resolved all DKIM selectors")
+
+	domain.Spec.DKim.Selectors = append(domain.Spec.DKim.Selectors, corev1alpha1.DKimSelector{
+		Selector:  "old",
+		PublicKey: otherPublicKey,
+	})
+
+	res = c.CheckDomainDKim(ctx, domain)
+	assert.False(t, res.Result(), "should not have resolved the old DKIM selector")
+	assert.Equal(t, "no DKIM record found at old._domainkey.example.com", res.Reason)
+
+	res = c.CheckDKimSelector(ctx, domain, domain.Spec.DKim.AllSelectors()[1])
+	assert.True(t, res.Result(), "should have resolved the Ed25519 selector")
+}
+
+func TestCombineDKimSelectors(t *testing.T) {
+	ctx := createContext(t)
+
+	rsa := "v=DKIM1; k=rsa; p=" + testPublicKey
+	ed := "v=DKIM1; k=ed25519; p=" + testEd25519PublicKey
+	r := []resolver.Resolver{
+		&mockdns.Resolver{Zones: map[string]mockdns.Zone{
+			"selector._domainkey.example.com.": {TXT: []string{rsa}},
+			"ed._domainkey.example.com.":       {TXT: []string{ed}},
+		}},
+		&mockdns.Resolver{Zones: map[string]mockdns.Zone{
+			"selector._domainkey.example.com.": {TXT: []string{rsa}},
+		}},
+		&mockdns.Resolver{Zones: map[string]mockdns.Zone{
+			"ed._domainkey.example.com.": {TXT: []string{ed}},
+		}},
+	}
+
+	domain := createDomain(t)
+	domain.Spec.DKim.Selectors = []corev1alpha1.DKimSelector{
+		{Selector: "ed", KeyType: corev1alpha1.DKimKeyTypeEd25519, PublicKey: testEd25519PublicKey},
+	}
+
+	c := checker.NewDNSChecker(r...)
+
+	var selectors []checker.DNSCheckStats
+	for _, selector := range domain.DKimSelectors() {
+		selectors = append(selectors, c.CheckDKimSelector(ctx, domain, selector))
+	}
+
+	res := c.CombineDKimSelectors(selectors)
+	expected := c.CheckDomainDKim(ctx, domain)
+
+	assert.Equal(t, expected.Result(), res.Result())
+	assert.Equal(t, 1, res.CntOK)
+	assert.Equal(t, 2, res.CntKO)
+	assert.Equal(t, expected.Reason, res.Reason)
+	for i := range expected.Results {
+		assert.Equal(t, expected.Results[i].OK, res.Results[i].OK)
+		assert.Equal(t, expected.Results[i].Value, res.Results[i].Value)
+		assert.Equal(t, expected.Results[i].Reason, res.Results[i].Reason)
+	}
+
+	res = c.CombineDKimSelectors(nil)
+	assert.False(t, res.Result())
+	assert.Equal(t, "no DKIM selector configured", res.Reason)
+}
+
+func TestDKimKeyTypeMismatch(t *testing.T) {
+	ctx := createContext(t)
+
+	r := mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"ed._domainkey.example.com.": {
+				TXT: []string{
+					"v=DKIM1; k=rsa; p=" + testPublicKey,
+				},
+			},
+		},
+	}
+
+	domain := createDomain(t)
+	selector := corev1alpha1.DKimSelector{
+		Selector:  "ed",
+		KeyType:   corev1alpha1.DKimKeyTypeEd25519,
+		PublicKey: testEd25519PublicKey,
+	}
+
+	c := checker.NewDNSChecker(&r)
+
+	res := c.CheckDKimSelector(ctx, domain, selector)
+	assert.False(t, res.Result(), "should not have resolved DKIM")
+}
+
 func TestDKimMultipleOK(t *testing.T) {
 	ctx := createContext(t)
 
@@ -62,7 +224,7 @@ func TestDKimMultipleOK(t *testing.T) {
 			Zones: map[string]mockdns.Zone{
 				"selector._domainkey.example.com.": {
 					TXT: []string{
-						"k=rsa; p=publicKey",
+						"k=rsa; p=" + testPublicKey,
 					},
 				},
 			},
@@ -71,7 +233,7 @@ func TestDKimMultipleOK(t *testing.T) {
 			Zones: map[string]mockdns.Zone{
 				"selector._domainkey.example.com.": {
 					TXT: []string{
-						"k=rsa; p=publicKey",
+						"k=rsa; p=" + testPublicKey,
 					},
 				},
 			},
@@ -80,7 +242,7 @@ func TestDKimMultipleOK(t *testing.T) {
 			Zones: map[string]mockdns.Zone{
 				"selector._domainkey.example.com.": {
 					TXT: []string{
-						"k=rsa; p=publicKeyErr",
+						"k=rsa; p=" + otherPublicKey,
 					},
 				},
 			},
@@ -105,7 +267,7 @@ func TestDKimMultipleKO(t *testing.T) {
 			Zones: map[string]mockdns.Zone{
 				"selector._domainkey.example.com.": {
 					TXT: []string{
-						"k=rsa; p=publicKey",
+						"k=rsa; p=" + testPublicKey,
 					},
 				},
 			},
@@ -117,7 +279,7 @@ func TestDKimMultipleKO(t *testing.T) {
 			Zones: map[string]mockdns.Zone{
 				"selector._domainkey.example.com.": {
 					TXT: []string{
-						"k=rsa; p=publicKeyErr",
+						"k=rsa; p=" + otherPublicKey,
 					},
 				},
 			},
@@ -132,6 +294,20 @@ func TestDKimMultipleKO(t *testing.T) {
 	assert.False(t, res.Result(), "should have resolved DKIM")
 	assert.Equal(t, 2, res.CntKO)
 	assert.Equal(t, 1, res.CntOK)
+
+	assert.Len(t, res.Results, 3)
+	assert.Equal(t, "resolver-0", res.Results[0].Resolver)
+	assert.True(t, res.Results[0].OK)
+	assert.Equal(t, "k=rsa; p="+testPublicKey, res.Results[0].Value)
+	assert.Nil(t, res.Results[0].TTL, "mock resolvers do not report TTLs")
+
+	assert.Equal(t, "resolver-1", res.Results[1].Resolver)
+	assert.False(t, res.Results[1].OK)
+	assert.Equal(t, "no DKIM record found at selector._domainkey.example.com", res.Results[1].Reason)
+	assert.Empty(t, res.Results[1].Value)
+
+	assert.False(t, res.Results[2].OK)
+	assert.Equal(t, "k=rsa; p="+otherPublicKey, res.Results[2].Value)
 }
 
 func TestDKIMWithoutHost(t *testing.T) {
@@ -177,6 +353,11 @@ func TestSPFOk(t *testing.T) {
 					"v=spf1 include:mx.example.com ~all",
 				},
 			},
+			"mx.example.com.": {
+				TXT: []string{
+					"v=spf1 ip4:192.0.2.0/24 -all",
+				},
+			},
 		},
 	}
 
@@ -188,6 +369,83 @@ func TestSPFOk(t *testing.T) {
 	assert.True(t, res.Result(), "should have resolved SPF")
 }
 
+func TestDMARCOk(t *testing.T) {
+	ctx := createContext(t)
+
+	r := mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"_dmarc.example.com.": {
+				TXT: []string{
+					"v=DMARC1; p=quarantine; rua=mailto:dmarc@example.com",
+				},
+			},
+		},
+	}
+
+	domain := createDomain(t)
+
+	c := checker.NewDNSChecker(&r)
+
+	res := c.CheckDomainDMARC(ctx, domain)
+	assert.True(t, res.Result(), "should have resolved DMARC")
+}
+
+func TestDMARCWeakerPolicy(t *testing.T) {
+	ctx := createContext(t)
+
+	r := mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"_dmarc.example.com.": {
+				TXT: []string{
+					"v=DMARC1; p=none",
+				},
+			},
+		},
+	}
+
+	domain := createDomain(t)
+	domain.Spec.DMARC.Policy = checker.DMARCPolicyReject
+
+	c := checker.NewDNSChecker(&r)
+
+	res := c.CheckDomainDMARC(ctx, domain)
+	assert.False(t, res.Result(), "should not accept a weaker DMARC policy")
+}
+
+func TestDMARCMultipleRecords(t *testing.T) {
+	ctx := createContext(t)
+
+	r := mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"_dmarc.example.com.": {
+				TXT: []string{
+					"v=DMARC1; p=none",
+					"v=DMARC1; p=reject",
+				},
+			},
+		},
+	}
+
+	domain := createDomain(t)
+
+	c := checker.NewDNSChecker(&r)
+
+	res := c.CheckDomainDMARC(ctx, domain)
+	assert.False(t, res.Result(), "should not accept multiple DMARC records")
+}
+
+func TestDMARCWithoutHost(t *testing.T) {
+	ctx := createContext(t)
+
+	r := mockdns.Resolver{}
+
+	domain := createDomain(t)
+	c := checker.NewDNSChecker(&r)
+
+	res := c.CheckDomainDMARC(ctx, domain)
+	assert.False(t, res.Result(), "should not have resolved DMARC")
+}
+
 func TestStatsWithoutHost(t *testing.T) {
 	ctx := createContext(t)
 
@@ -267,6 +525,12 @@ func TestLoopupCname(t *testing.T) {
 
 }
 
+const (
+	testPublicKey        = "MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC6/mD1mOU7OhNGusGq8qttWvYNEPO4zU+PBKHtAHM2Zvt6Gzm7cr8+UXHTWYwRjEeBob750evjLQsaN7GS6uybYqjuFnH/M78DDxi0n8Cwfv8+V9qGfrJYvUcN49FFkUh/ND9c9F8b/MkiQsYEHZt+DBU/8hjJxT8pdxmFGo4bzwIDAQAB"
+	testEd25519PublicKey = "p2zEbdB/pTm97mLY4L8TagVmmooFJBW4j3WUZcGGn+8="
+	otherPublicKey       = "MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQCqxZVjiNCcXKl+eAMh9bavL/I4yddyt2K8LwEhDWMcd3nIOtQnm0n3lGMnWB/rgDGHk1rtjwyMlu0qWOdcVhRB3B/ERPgTcyz4ErTakReDhuLxJ773zzD0n5YSNZa87C0wxM1MGx/lDfC4beNSEG/FPH74LYw+aeIXyf4Pg94+5wIDAQAB"
+)
+
 func createDomain(t *testing.T) *corev1alpha1.Domain {
 	t.Helper()
 
@@ -275,7 +539,7 @@ func createDomain(t *testing.T) *corev1alpha1.Domain {
 			DomainName: "example.com",
 			DKim: corev1alpha1.DKim{
 				Selector:  "selector",
-				PublicKey: "publicKey",
+				PublicKey: testPublicKey,
 			},
 			BaseDomain:  "mx.example.com",
 			StatsPrefix: "stats",
@@ -288,3 +552,33 @@ func createContext(t *testing.T) context.Context {
 
 	return context.Background()
 }
+
+// bogusResolver answers like mockdns.Resolver, reporting the answers as
+// DNSSEC bogus.
+type bogusResolver struct {
+	mockdns.Resolver
+}
+
+func (r *bogusResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	resolver.ObserveDNSSEC(ctx, resolver.DNSSECBogus)
+	return r.Resolver.LookupTXT(ctx, name)
+}
+
+func TestDMARCDNSSECBogus(t *testing.T) {
+	ctx := createContext(t)
+
+	domain := createDomain(t)
+	domain.Spec.DMARC.Policy = "reject"
+
+	zones := map[string]mockdns.Zone{
+		"_dmarc.example.com.": {TXT: []string{"v=DMARC1; p=reject"}},
+	}
+	c := checker.NewDNSChecker(&bogusResolver{mockdns.Resolver{Zones: zones}})
+
+	res := c.CheckDomainDMARC(ctx, domain)
+	assert.False(t, res.Result())
+	assert.Equal(t, 1, res.CntKO)
+	assert.Equal(t, resolver.DNSSECBogus, res.DNSSEC)
+	assert.Equal(t, "v=DMARC1; p=reject", res.Results[0].Value)
+	assert.Contains(t, res.Reason, "DNSSEC validation failed")
+}
@@ -0,0 +1,137 @@
+package checker
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+)
+
+// DKIMRecord is a parsed DKIM public key record, as defined in RFC 6376 3.6.1.
+type DKIMRecord struct {
+	Version        string
+	KeyType        string
+	HashAlgorithms []string
+	ServiceTypes   []string
+	Flags          []string
+
+	// PublicKey is the base64 encoded key data, stripped of whitespace.
+	PublicKey string
+
+	// Key is the decoded public key.
+	Key crypto.PublicKey
+}
+
+// ParseDKIM parses a DKIM TXT record. Records split over multiple character
+// strings can be passed as separate arguments and are joined before parsing.
+func ParseDKIM(txt ...string) (DKIMRecord, error) {
+	record := DKIMRecord{
+		KeyType: corev1alpha1.DKimKeyTypeRSA,
+	}
+
+	tags, err := parseTagList(strings.Join(txt, ""))
+	if err != nil {
+		return record, err
+	}
+
+	for i, t := range tags {
+		switch t.name {
+		case "v":
+			if i != 0 || t.value != "DKIM1" {
+				return record, fmt.Errorf("v=DKIM1 must be the first tag")
+			}
+			record.Version = t.value
+		case "k":
+			record.KeyType = t.value
+		case "h":
+			record.HashAlgorithms = splitDKIMList(t.value)
+		case "s":
+			record.ServiceTypes = splitDKIMList(t.value)
+		case "t":
+			record.Flags = splitDKIMList(t.value)
+		case "p":
+			record.PublicKey = removeWhitespace(t.value)
+			if record.PublicKey == "" {
+				return record, fmt.Errorf("public key has been revoked")
+			}
+		}
+	}
+
+	if record.PublicKey == "" {
+		return record, fmt.Errorf("missing p tag")
+	}
+
+	key, err := ParseDKIMPublicKey(record.KeyType, record.PublicKey)
+	if err != nil {
+		return record, err
+	}
+	record.Key = key
+
+	return record, nil
+}
+
+// ParseDKIMPublicKey decodes the base64 key data of a DKIM record of the
+// given key type.
+func ParseDKIMPublicKey(keyType, data string) (crypto.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(removeWhitespace(data))
+	if err != nil {
+		return nil, fmt.Errorf("public key is not valid base64: %w", err)
+	}
+
+	switch keyType {
+	case corev1alpha1.DKimKeyTypeRSA:
+		if key, err := x509.ParsePKIXPublicKey(der); err == nil {
+			rsaKey, ok := key.(*rsa.PublicKey)
+			if !ok {
+				return nil, fmt.Errorf("public key is not an RSA key")
+			}
+			return rsaKey, nil
+		}
+
+		key, err := x509.ParsePKCS1PublicKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA public key: %w", err)
+		}
+		return key, nil
+	case corev1alpha1.DKimKeyTypeEd25519:
+		// RFC 8463 3.2: Ed25519 keys are published as the raw 32 byte key.
+		if len(der) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key: expected %d bytes, got %d", ed25519.PublicKeySize, len(der))
+		}
+		return ed25519.PublicKey(der), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", keyType)
+	}
+}
+
+// Matches reports whether the record publishes the given public key.
+func (r DKIMRecord) Matches(key crypto.PublicKey) bool {
+	k, ok := r.Key.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(key)
+}
+
+func splitDKIMList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ":") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func removeWhitespace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,52 @@
+package checker_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+	"github.com/kannon-email/k8nnon/internal/dns/checker"
+)
+
+func TestParseDKIM(t *testing.T) {
+	record, err := checker.ParseDKIM("v=DKIM1; k=rsa; h=sha1:sha256; s=email; t=y:s; p=" + testPublicKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "DKIM1", record.Version)
+	assert.Equal(t, "rsa", record.KeyType)
+	assert.Equal(t, []string{"sha1", "sha256"}, record.HashAlgorithms)
+	assert.Equal(t, []string{"email"}, record.ServiceTypes)
+	assert.Equal(t, []string{"y", "s"}, record.Flags)
+	assert.Equal(t, testPublicKey, record.PublicKey)
+}
+
+func TestParseDKIMSplitStrings(t *testing.T) {
+	record, err := checker.ParseDKIM("v=DKIM1; p="+testPublicKey[:100], testPublicKey[100:])
+	assert.Nil(t, err)
+	assert.Equal(t, "rsa", record.KeyType)
+
+	key, err := checker.ParseDKIMPublicKey(corev1alpha1.DKimKeyTypeRSA, testPublicKey)
+	assert.Nil(t, err)
+	assert.True(t, record.Matches(key))
+
+	other, err := checker.ParseDKIMPublicKey(corev1alpha1.DKimKeyTypeRSA, otherPublicKey)
+	assert.Nil(t, err)
+	assert.False(t, record.Matches(other))
+}
+
+func TestParseDKIMInvalid(t *testing.T) {
+	records := []string{
+		"k=rsa; v=DKIM1; p=" + testPublicKey,
+		"v=DKIM1; k=rsa",
+		"v=DKIM1; k=rsa; p=",
+		"v=DKIM1; k=rsa; p=notbase64!",
+		"v=DKIM1; k=rsa; p=cHVibGljS2V5",
+		"v=DKIM1; k=dsa; p=" + testPublicKey,
+		"v=DKIM1; p=" + testPublicKey + "; p=" + otherPublicKey,
+	}
+
+	for _, txt := range records {
+		_, err := checker.ParseDKIM(txt)
+		assert.NotNil(t, err, "should not have parsed %q", txt)
+	}
+}
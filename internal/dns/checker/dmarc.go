@@ -0,0 +1,125 @@
+package checker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	DMARCPolicyNone       = "none"
+	DMARCPolicyQuarantine = "quarantine"
+	DMARCPolicyReject     = "reject"
+)
+
+var dmarcPolicyStrength = map[string]int{
+	DMARCPolicyNone:       0,
+	DMARCPolicyQuarantine: 1,
+	DMARCPolicyReject:     2,
+}
+
+// DMARCRecord is a parsed DMARC policy record, as defined in RFC 7489.
+type DMARCRecord struct {
+	Policy          string
+	SubdomainPolicy string
+	Percentage      int
+	RUA             []string
+	RUF             []string
+	ADKIM           string
+	ASPF            string
+}
+
+func isDMARCRecord(txt string) bool {
+	first, _, _ := strings.Cut(txt, ";")
+	name, version, ok := strings.Cut(first, "=")
+	return ok && strings.TrimSpace(name) == "v" && strings.TrimSpace(version) == "DMARC1"
+}
+
+// ParseDMARC parses a DMARC TXT record.
+func ParseDMARC(txt string) (DMARCRecord, error) {
+	record := DMARCRecord{
+		Percentage: 100,
+		ADKIM:      "r",
+		ASPF:       "r",
+	}
+
+	tags, err := parseTagList(txt)
+	if err != nil {
+		return record, err
+	}
+
+	if len(tags) == 0 || tags[0].name != "v" || tags[0].value != "DMARC1" {
+		return record, fmt.Errorf("record must start with v=DMARC1")
+	}
+
+	for _, t := range tags[1:] {
+		switch t.name {
+		case "p":
+			if _, ok := dmarcPolicyStrength[t.value]; !ok {
+				return record, fmt.Errorf("invalid policy %q", t.value)
+			}
+			record.Policy = t.value
+		case "sp":
+			if _, ok := dmarcPolicyStrength[t.value]; !ok {
+				return record, fmt.Errorf("invalid subdomain policy %q", t.value)
+			}
+			record.SubdomainPolicy = t.value
+		case "pct":
+			pct, err := strconv.Atoi(t.value)
+			if err != nil || pct < 0 || pct > 100 {
+				return record, fmt.Errorf("invalid pct %q", t.value)
+			}
+			record.Percentage = pct
+		case "rua":
+			uris, err := parseDMARCURIs(t.value)
+			if err != nil {
+				return record, fmt.Errorf("invalid rua: %w", err)
+			}
+			record.RUA = uris
+		case "ruf":
+			uris, err := parseDMARCURIs(t.value)
+			if err != nil {
+				return record, fmt.Errorf("invalid ruf: %w", err)
+			}
+			record.RUF = uris
+		case "adkim":
+			if t.value != "r" && t.value != "s" {
+				return record, fmt.Errorf("invalid adkim %q", t.value)
+			}
+			record.ADKIM = t.value
+		case "aspf":
+			if t.value != "r" && t.value != "s" {
+				return record, fmt.Errorf("invalid aspf %q", t.value)
+			}
+			record.ASPF = t.value
+		}
+	}
+
+	if record.Policy == "" {
+		return record, fmt.Errorf("missing p tag")
+	}
+
+	if record.SubdomainPolicy == "" {
+		record.SubdomainPolicy = record.Policy
+	}
+
+	return record, nil
+}
+
+// Enforces reports whether the record policy is at least as strict as policy.
+func (r DMARCRecord) Enforces(policy string) bool {
+	return dmarcPolicyStrength[r.Policy] >= dmarcPolicyStrength[policy]
+}
+
+func parseDMARCURIs(value string) ([]string, error) {
+	var uris []string
+	for _, uri := range strings.Split(value, ",") {
+		uri = strings.TrimSpace(uri)
+		if !strings.HasPrefix(strings.ToLower(uri), "mailto:") {
+			return nil, fmt.Errorf("unsupported uri %q", uri)
+		}
+		uris = append(uris, uri)
+	}
+
+	return uris, nil
+}
@@ -0,0 +1,57 @@
+package checker_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kannon-email/k8nnon/internal/dns/checker"
+)
+
+func TestParseDMARC(t *testing.T) {
+	record, err := checker.ParseDMARC("v=DMARC1; p=reject; sp=none; pct=50; rua=mailto:a@example.com,mailto:b@example.com; adkim=s")
+	assert.Nil(t, err)
+	assert.Equal(t, checker.DMARCRecord{
+		Policy:          "reject",
+		SubdomainPolicy: "none",
+		Percentage:      50,
+		RUA:             []string{"mailto:a@example.com", "mailto:b@example.com"},
+		ADKIM:           "s",
+		ASPF:            "r",
+	}, record)
+}
+
+func TestParseDMARCDefaults(t *testing.T) {
+	record, err := checker.ParseDMARC("v=DMARC1;p=quarantine")
+	assert.Nil(t, err)
+	assert.Equal(t, "quarantine", record.SubdomainPolicy)
+	assert.Equal(t, 100, record.Percentage)
+	assert.Equal(t, "r", record.ADKIM)
+	assert.Equal(t, "r", record.ASPF)
+}
+
+func TestParseDMARCInvalid(t *testing.T) {
+	records := []string{
+		"p=reject; v=DMARC1",
+		"v=DMARC1",
+		"v=DMARC1; p=block",
+		"v=DMARC1; p=none; pct=120",
+		"v=DMARC1; p=none; rua=https://example.com",
+		"v=DMARC1; p=none; p=reject",
+		"v=DMARC1; p=none; aspf=x",
+	}
+
+	for _, txt := range records {
+		_, err := checker.ParseDMARC(txt)
+		assert.NotNil(t, err, "should not have parsed %q", txt)
+	}
+}
+
+func TestDMARCEnforces(t *testing.T) {
+	record := checker.DMARCRecord{Policy: checker.DMARCPolicyQuarantine}
+
+	assert.True(t, record.Enforces(""))
+	assert.True(t, record.Enforces(checker.DMARCPolicyNone))
+	assert.True(t, record.Enforces(checker.DMARCPolicyQuarantine))
+	assert.False(t, record.Enforces(checker.DMARCPolicyReject))
+}
@@ -0,0 +1,9 @@
+package checker
+
+// SetNameserverPort changes the port authoritative nameservers are queried
+// on and returns a function restoring it.
+func SetNameserverPort(port string) func() {
+	previous := nameserverPort
+	nameserverPort = port
+	return func() { nameserverPort = previous }
+}
@@ -0,0 +1,227 @@
+package checker
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+	"github.com/kannon-email/k8nnon/internal/dns/resolver"
+)
+
+// Quorum policy types.
+const (
+	// PolicyMajority passes when more than half of the resolvers validate
+	// the record.
+	PolicyMajority = "majority"
+	// PolicyAll passes when every resolver validates the record.
+	PolicyAll = "all"
+	// PolicyAny passes when at least one resolver validates the record.
+	PolicyAny = "any"
+	// PolicyAtLeast passes when at least MinOK resolvers validate the
+	// record.
+	PolicyAtLeast = "atLeast"
+	// PolicyWeighted passes when the resolvers validating the record hold
+	// more than half of the total weight.
+	PolicyWeighted = "weighted"
+)
+
+// PolicyTypes lists the supported quorum policy types.
+var PolicyTypes = []string{PolicyMajority, PolicyAll, PolicyAny, PolicyAtLeast, PolicyWeighted}
+
+// Policy decides whether a check passes from the results of the resolvers.
+// The zero value is a strict majority counting errors as failures.
+type Policy struct {
+	Type string
+
+	// MinOK is the number of resolvers that must validate the record with
+	// PolicyAtLeast.
+	MinOK int
+
+	// Weights are the weights of the resolvers with PolicyWeighted, by
+	// resolver name. Resolvers without weight weigh 1.
+	Weights map[string]int
+
+	// IgnoreErrors excludes the resolvers whose lookup failed from the
+	// quorum, so that unreachable resolvers do not fail the check.
+	IgnoreErrors bool
+}
+
+// PolicyFromSpec returns the policy configured by a Domain spec.
+func PolicyFromSpec(quorum corev1alpha1.DNSQuorumPolicy) Policy {
+	return Policy{
+		Type:         quorum.Type,
+		MinOK:        quorum.MinOK,
+		Weights:      NormalizeWeights(quorum.Weights),
+		IgnoreErrors: quorum.IgnoreErrors,
+	}
+}
+
+// Validate checks that the policy is well formed.
+func (p Policy) Validate() error {
+	switch p.Type {
+	case "", PolicyMajority, PolicyAll, PolicyAny, PolicyWeighted:
+	case PolicyAtLeast:
+		if p.MinOK < 1 {
+			return fmt.Errorf("%s quorum policy requires a positive minimum number of resolvers", PolicyAtLeast)
+		}
+	default:
+		return fmt.Errorf("unknown quorum policy %q, valid policies are %s", p.Type, strings.Join(PolicyTypes, ", "))
+	}
+
+	for name, w := range p.Weights {
+		if w < 0 {
+			return fmt.Errorf("negative weight %d for resolver %s", w, name)
+		}
+	}
+
+	return nil
+}
+
+// Passes reports whether the check passes according to the policy.
+func (p Policy) Passes(stats DNSCheckStats) bool {
+	ok, total := stats.CntOK, stats.CntOK+stats.CntKO
+	if !p.IgnoreErrors {
+		total += stats.CntErr
+	}
+
+	// Unhealthy resolvers are left out of a majority, weighted or not, so
+	// that it does not depend on resolvers that are down, but the policies
+	// requiring every or a number of resolvers cannot be met without them.
+	if p.Type == PolicyAll || p.Type == PolicyAtLeast {
+		total += stats.CntUnhealthy
+	}
+
+	if p.Type == PolicyWeighted {
+		ok, total = p.weigh(stats.Results)
+	}
+
+	if total == 0 {
+		return false
+	}
+
+	switch p.Type {
+	case PolicyAll:
+		return ok == total
+	case PolicyAny:
+		return ok > 0
+	case PolicyAtLeast:
+		return ok >= p.MinOK
+	default:
+		return ok*2 > total
+	}
+}
+
+func (p Policy) weigh(results []ResolverResult) (int, int) {
+	ok, total := 0, 0
+	for _, res := range results {
+		if res.Unhealthy || p.IgnoreErrors && res.Error != "" {
+			continue
+		}
+
+		w := p.weight(res.Resolver)
+		total += w
+		if res.OK {
+			ok += w
+		}
+	}
+
+	return ok, total
+}
+
+func (p Policy) weight(name string) int {
+	if w, ok := p.Weights[name]; ok {
+		return w
+	}
+
+	if addr, err := resolver.ParseAddress(name); err == nil {
+		if w, ok := p.Weights[addr]; ok {
+			return w
+		}
+	}
+
+	return 1
+}
+
+func (p Policy) String() string {
+	s := p.Type
+	if s == "" {
+		s = PolicyMajority
+	}
+
+	if p.Type == PolicyAtLeast {
+		s += fmt.Sprintf("(%d)", p.MinOK)
+	}
+
+	if p.IgnoreErrors {
+		s += ", ignoring errors"
+	}
+
+	return s
+}
+
+// NormalizeWeights returns weights with resolver addresses in canonical
+// form, see resolver.ParseAddress. Other names, like the nameservers of the
+// authoritative mode, are kept as they are.
+func NormalizeWeights(weights map[string]int) map[string]int {
+	if weights == nil {
+		return nil
+	}
+
+	normalized := make(map[string]int, len(weights))
+	for name, w := range weights {
+		if addr, err := resolver.ParseAddress(name); err == nil {
+			name = addr
+		}
+		normalized[name] = w
+	}
+
+	return normalized
+}
+
+// BindFlags registers the flags configuring the policy on fs, with names
+// starting with prefix.
+func (p *Policy) BindFlags(fs *flag.FlagSet, prefix string) {
+	fs.StringVar(&p.Type, prefix+"quorum", PolicyMajority,
+		"Quorum policy deciding when a DNS check passes, one of "+strings.Join(PolicyTypes, ", ")+".")
+	fs.IntVar(&p.MinOK, prefix+"quorum-min-ok", 1,
+		"Number of resolvers that must validate a record with the "+PolicyAtLeast+" quorum policy.")
+	fs.BoolVar(&p.IgnoreErrors, prefix+"quorum-ignore-errors", false,
+		"Exclude the resolvers whose lookup failed from the quorum.")
+	fs.Func(prefix+"quorum-weights",
+		"Comma separated resolver=weight pairs for the "+PolicyWeighted+" quorum policy, resolvers without weight weigh 1.",
+		func(s string) error {
+			weights, err := parseWeights(s)
+			if err != nil {
+				return err
+			}
+			p.Weights = NormalizeWeights(weights)
+			return nil
+		})
+}
+
+func parseWeights(s string) (map[string]int, error) {
+	weights := map[string]int{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		// IPv6 resolvers contain colons, so the weight follows the last =.
+		i := strings.LastIndex(pair, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid resolver weight %q, expected resolver=weight", pair)
+		}
+
+		w, err := strconv.Atoi(pair[i+1:])
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid resolver weight %q", pair)
+		}
+
+		weights[pair[:i]] = w
+	}
+
+	return weights, nil
+}
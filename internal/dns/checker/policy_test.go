@@ -0,0 +1,141 @@
+package checker_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/foxcpp/go-mockdns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kannon-email/k8nnon/internal/dns/checker"
+	"github.com/kannon-email/k8nnon/internal/dns/resolver"
+)
+
+func TestPolicyPasses(t *testing.T) {
+	stats := checker.DNSCheckStats{CntOK: 2, CntKO: 1, CntErr: 2}
+
+	tests := []struct {
+		policy checker.Policy
+		passes bool
+	}{
+		{checker.Policy{}, false},
+		{checker.Policy{Type: checker.PolicyMajority, IgnoreErrors: true}, true},
+		{checker.Policy{Type: checker.PolicyAll}, false},
+		{checker.Policy{Type: checker.PolicyAll, IgnoreErrors: true}, false},
+		{checker.Policy{Type: checker.PolicyAny}, true},
+		{checker.Policy{Type: checker.PolicyAtLeast, MinOK: 2}, true},
+		{checker.Policy{Type: checker.PolicyAtLeast, MinOK: 3}, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.passes, tt.policy.Passes(stats), tt.policy.String())
+	}
+}
+
+func TestPolicyNoAnswers(t *testing.T) {
+	stats := checker.DNSCheckStats{CntErr: 3}
+
+	assert.False(t, checker.Policy{Type: checker.PolicyAny, IgnoreErrors: true}.Passes(stats))
+	assert.False(t, checker.Policy{Type: checker.PolicyAll, IgnoreErrors: true}.Passes(stats))
+}
+
+func TestPolicyWeighted(t *testing.T) {
+	stats := checker.DNSCheckStats{
+		CntOK:  1,
+		CntKO:  2,
+		CntErr: 1,
+		Results: []checker.ResolverResult{
+			{Resolver: "8.8.8.8:53", OK: true},
+			{Resolver: "1.1.1.1:53"},
+			{Resolver: "9.9.9.9:53"},
+			{Resolver: "1.0.0.1:53", Error: "timeout"},
+		},
+	}
+
+	policy := checker.Policy{
+		Type:    checker.PolicyWeighted,
+		Weights: checker.NormalizeWeights(map[string]int{"8.8.8.8": 4}),
+	}
+	assert.True(t, policy.Passes(stats))
+
+	policy.Weights = map[string]int{"8.8.8.8:53": 3}
+	assert.False(t, policy.Passes(stats))
+
+	policy.IgnoreErrors = true
+	assert.True(t, policy.Passes(stats))
+}
+
+func TestPolicyValidate(t *testing.T) {
+	assert.Nil(t, checker.Policy{}.Validate())
+	assert.Nil(t, checker.Policy{Type: checker.PolicyAtLeast, MinOK: 1}.Validate())
+	assert.NotNil(t, checker.Policy{Type: checker.PolicyAtLeast}.Validate())
+	assert.NotNil(t, checker.Policy{Type: "quorum"}.Validate())
+	assert.NotNil(t, checker.Policy{Weights: map[string]int{"8.8.8.8:53": -1}}.Validate())
+}
+
+type failingResolver struct {
+	mockdns.Resolver
+}
+
+func (*failingResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return nil, &net.DNSError{Err: "i/o timeout", Name: name, IsTimeout: true}
+}
+
+func TestCheckErrorsCountedApart(t *testing.T) {
+	ctx := createContext(t)
+
+	domain := createDomain(t)
+	domain.Spec.DMARC.Policy = "reject"
+
+	ok := &mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"_dmarc.example.com.": {TXT: []string{"v=DMARC1; p=reject"}},
+		},
+	}
+	c := checker.NewDNSChecker(ok, &failingResolver{}, &failingResolver{})
+
+	res := c.CheckDomainDMARC(ctx, domain)
+	assert.Equal(t, 1, res.CntOK)
+	assert.Equal(t, 0, res.CntKO)
+	assert.Equal(t, 2, res.CntErr)
+	assert.False(t, res.Result())
+
+	res = c.WithPolicy(checker.Policy{IgnoreErrors: true}).CheckDomainDMARC(ctx, domain)
+	assert.True(t, res.Result())
+}
+
+type unhealthyResolver struct {
+	mockdns.Resolver
+}
+
+func (*unhealthyResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return nil, &resolver.UnhealthyError{Server: "10.0.0.53:53"}
+}
+
+func TestCheckSkipsUnhealthyResolvers(t *testing.T) {
+	ctx := createContext(t)
+
+	domain := createDomain(t)
+	domain.Spec.DMARC.Policy = "reject"
+
+	ok := &mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"_dmarc.example.com.": {TXT: []string{"v=DMARC1; p=reject"}},
+		},
+	}
+	c := checker.NewDNSChecker(ok, &unhealthyResolver{}, &unhealthyResolver{})
+
+	res := c.CheckDomainDMARC(ctx, domain)
+	assert.Equal(t, 1, res.CntOK)
+	assert.Equal(t, 0, res.CntErr)
+	assert.Equal(t, 2, res.CntUnhealthy)
+	assert.True(t, res.Results[1].Unhealthy)
+	assert.True(t, res.Result())
+
+	res = c.WithPolicy(checker.Policy{Type: checker.PolicyAll}).CheckDomainDMARC(ctx, domain)
+	assert.False(t, res.Result(), "unhealthy resolvers should count against all")
+
+	res = c.WithPolicy(checker.Policy{Type: checker.PolicyAtLeast, MinOK: 2}).CheckDomainDMARC(ctx, domain)
+	assert.False(t, res.Result())
+}
@@ -0,0 +1,367 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/kannon-email/k8nnon/internal/dns/resolver"
+)
+
+const (
+	// spfMaxLookups is the maximum number of DNS-querying terms allowed
+	// while evaluating an SPF policy (RFC 7208 4.6.4).
+	spfMaxLookups = 10
+
+	// spfMaxVoidLookups is the maximum number of lookups that may return
+	// no answer while evaluating an SPF policy (RFC 7208 4.6.4).
+	spfMaxVoidLookups = 2
+
+	// spfMaxMXRecords is the maximum number of MX records an "mx"
+	// mechanism may return (RFC 7208 4.6.4).
+	spfMaxMXRecords = 10
+)
+
+// SPFPermError is returned when an SPF policy cannot be evaluated because it
+// is broken, as opposed to temporary DNS failures.
+type SPFPermError struct {
+	Domain string
+	Reason string
+}
+
+func (e *SPFPermError) Error() string {
+	return fmt.Sprintf("spf permerror on %s: %s", e.Domain, e.Reason)
+}
+
+// SPFResult is the outcome of walking the SPF policy of a domain.
+type SPFResult struct {
+	// Record is the SPF record published by the evaluated domain.
+	Record string
+
+	// Includes lists every domain reached through include and redirect terms.
+	Includes []string
+	// Authorized lists the domains of Includes whose passing hosts pass the
+	// evaluated policy, those reached only through include mechanisms
+	// without a qualifier or with the "+" one.
+	Authorized []string
+
+	Lookups     int
+	VoidLookups int
+}
+
+// Authorizes reports whether the evaluated policy delegates to domain,
+// either directly or through nested includes and redirects. An include
+// qualified with "-", "~" or "?" does not authorize its domain.
+func (r SPFResult) Authorizes(domain string) bool {
+	domain = normalizeDomain(domain)
+	for _, include := range r.Authorized {
+		if include == domain {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EvaluateSPF walks the SPF policy published by domain, resolving every
+// include, redirect, a, mx and exists term and enforcing the RFC 7208
+// processing limits.
+func EvaluateSPF(ctx context.Context, r resolver.Resolver, domain string) (SPFResult, error) {
+	e := &spfEvaluator{r: r}
+
+	record, err := e.evaluate(ctx, normalizeDomain(domain), true)
+
+	return SPFResult{
+		Record:      record,
+		Includes:    e.includes,
+		Authorized:  e.authorized,
+		Lookups:     e.lookups,
+		VoidLookups: e.voidLookups,
+	}, err
+}
+
+type spfEvaluator struct {
+	r           resolver.Resolver
+	includes    []string
+	authorized  []string
+	lookups     int
+	voidLookups int
+}
+
+// evaluate walks the policy of domain, pass tells whether its passing hosts
+// pass the evaluated policy.
+func (e *spfEvaluator) evaluate(ctx context.Context, domain string, pass bool) (string, error) {
+	record, err := e.lookupRecord(ctx, domain)
+	if err != nil {
+		return "", err
+	}
+
+	terms := strings.Fields(record)[1:]
+
+	var redirect string
+	hasAll := false
+
+	for _, term := range terms {
+		if name, value, ok := strings.Cut(term, "="); ok && isSPFModifierName(name) {
+			switch strings.ToLower(name) {
+			case "redirect":
+				if redirect != "" {
+					return record, e.permError(domain, "multiple redirect modifiers")
+				}
+				redirect = value
+			}
+			continue
+		}
+
+		mechanism := strings.TrimLeft(term, "+-~?")
+		qualifier := strings.TrimSuffix(term, mechanism)
+		name, target, cidr := splitSPFMechanism(mechanism)
+
+		switch name {
+		case "all":
+			hasAll = true
+		case "ip4", "ip6":
+			if !isValidSPFNetwork(name, target, cidr) {
+				return record, e.permError(domain, fmt.Sprintf("invalid %s mechanism %q", name, term))
+			}
+		case "include":
+			if target == "" {
+				return record, e.permError(domain, "include mechanism without domain")
+			}
+			if err := e.countLookup(domain); err != nil {
+				return record, err
+			}
+			if err := e.include(ctx, domain, target, pass && (qualifier == "" || qualifier == "+")); err != nil {
+				return record, err
+			}
+		case "a":
+			if err := e.countLookup(domain); err != nil {
+				return record, err
+			}
+			if err := e.lookupHost(ctx, domain, targetOrDomain(target, domain)); err != nil {
+				return record, err
+			}
+		case "mx":
+			if err := e.countLookup(domain); err != nil {
+				return record, err
+			}
+			if err := e.lookupMX(ctx, domain, targetOrDomain(target, domain)); err != nil {
+				return record, err
+			}
+		case "exists":
+			if target == "" {
+				return record, e.permError(domain, "exists mechanism without domain")
+			}
+			if err := e.countLookup(domain); err != nil {
+				return record, err
+			}
+			if err := e.lookupHost(ctx, domain, target); err != nil {
+				return record, err
+			}
+		case "ptr":
+			if err := e.countLookup(domain); err != nil {
+				return record, err
+			}
+		default:
+			return record, e.permError(domain, fmt.Sprintf("unknown mechanism %q", term))
+		}
+	}
+
+	// RFC 7208 6.1: redirect is ignored when the record contains "all".
+	if redirect != "" && !hasAll {
+		if err := e.countLookup(domain); err != nil {
+			return record, err
+		}
+		if err := e.include(ctx, domain, redirect, pass); err != nil {
+			return record, err
+		}
+	}
+
+	return record, nil
+}
+
+func (e *spfEvaluator) lookupRecord(ctx context.Context, domain string) (string, error) {
+	res, err := e.r.LookupTXT(ctx, domain)
+	if err != nil {
+		if isNotFound(err) {
+			return "", e.permError(domain, "no SPF record found")
+		}
+		return "", err
+	}
+
+	var records []string
+	for _, txt := range res {
+		if isSPFRecord(txt) {
+			records = append(records, txt)
+		}
+	}
+
+	switch len(records) {
+	case 0:
+		return "", e.permError(domain, "no SPF record found")
+	case 1:
+		return records[0], nil
+	default:
+		return "", e.permError(domain, fmt.Sprintf("found %d SPF records", len(records)))
+	}
+}
+
+func (e *spfEvaluator) include(ctx context.Context, domain, target string, pass bool) error {
+	if strings.Contains(target, "%") {
+		// Macros depend on the message being evaluated and can not be
+		// expanded statically.
+		return nil
+	}
+
+	target = normalizeDomain(target)
+	e.includes = append(e.includes, target)
+	if pass {
+		e.authorized = append(e.authorized, target)
+	}
+
+	if _, err := e.evaluate(ctx, target, pass); err != nil {
+		var permErr *SPFPermError
+		if errors.As(err, &permErr) && permErr.Domain == target && permErr.Reason == "no SPF record found" {
+			return e.permError(domain, fmt.Sprintf("included domain %s has no SPF record", target))
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (e *spfEvaluator) lookupHost(ctx context.Context, domain, target string) error {
+	if strings.Contains(target, "%") {
+		return nil
+	}
+
+	if _, err := e.r.LookupHost(ctx, target); err != nil {
+		if isNotFound(err) {
+			return e.countVoidLookup(domain)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (e *spfEvaluator) lookupMX(ctx context.Context, domain, target string) error {
+	if strings.Contains(target, "%") {
+		return nil
+	}
+
+	mxs, err := e.r.LookupMX(ctx, target)
+	if err != nil {
+		if isNotFound(err) {
+			return e.countVoidLookup(domain)
+		}
+		return err
+	}
+
+	if len(mxs) == 0 {
+		return e.countVoidLookup(domain)
+	}
+
+	if len(mxs) > spfMaxMXRecords {
+		return e.permError(domain, fmt.Sprintf("mx mechanism for %s returned %d records", target, len(mxs)))
+	}
+
+	return nil
+}
+
+func (e *spfEvaluator) countLookup(domain string) error {
+	e.lookups++
+	if e.lookups > spfMaxLookups {
+		return e.permError(domain, fmt.Sprintf("too many DNS lookups (limit is %d)", spfMaxLookups))
+	}
+
+	return nil
+}
+
+func (e *spfEvaluator) countVoidLookup(domain string) error {
+	e.voidLookups++
+	if e.voidLookups > spfMaxVoidLookups {
+		return e.permError(domain, fmt.Sprintf("too many void DNS lookups (limit is %d)", spfMaxVoidLookups))
+	}
+
+	return nil
+}
+
+func (e *spfEvaluator) permError(domain, reason string) error {
+	return &SPFPermError{Domain: domain, Reason: reason}
+}
+
+func isSPFRecord(txt string) bool {
+	version, _, _ := strings.Cut(txt, " ")
+	return strings.EqualFold(version, "v=spf1")
+}
+
+func isSPFModifierName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i, c := range name {
+		isAlpha := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		isOther := (c >= '0' && c <= '9') || c == '-' || c == '_' || c == '.'
+		if !isAlpha && (i == 0 || !isOther) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// splitSPFMechanism splits a mechanism like "a:example.com/24" into its
+// name, target domain and cidr length.
+func splitSPFMechanism(mechanism string) (name, target, cidr string) {
+	name, target, _ = strings.Cut(mechanism, ":")
+	name = strings.ToLower(name)
+
+	if name == "ip4" || name == "ip6" {
+		target, cidr, _ = strings.Cut(target, "/")
+		return name, target, cidr
+	}
+
+	if n, c, ok := strings.Cut(name, "/"); ok {
+		return n, target, c
+	}
+
+	if i := strings.Index(target, "/"); i >= 0 {
+		return name, target[:i], target[i+1:]
+	}
+
+	return name, target, cidr
+}
+
+func isValidSPFNetwork(name, ip, cidr string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	if (name == "ip4") != (parsed.To4() != nil) {
+		return false
+	}
+
+	if cidr == "" {
+		return true
+	}
+
+	_, _, err := net.ParseCIDR(ip + "/" + cidr)
+	return err == nil
+}
+
+func targetOrDomain(target, domain string) string {
+	if target == "" {
+		return domain
+	}
+
+	return target
+}
+
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(domain), ".")
+}
@@ -0,0 +1,206 @@
+package checker_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	mockdns "github.com/foxcpp/go-mockdns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kannon-email/k8nnon/internal/dns/checker"
+)
+
+func TestEvaluateSPFNestedInclude(t *testing.T) {
+	ctx := createContext(t)
+
+	r := mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"example.com.": {
+				TXT: []string{"v=spf1 mx a:mail.example.com include:_spf.example.com -all"},
+				MX:  []net.MX{{Host: "mail.example.com.", Pref: 10}},
+			},
+			"mail.example.com.": {
+				A: []string{"192.0.2.1"},
+			},
+			"_spf.example.com.": {
+				TXT: []string{"v=spf1 include:mx.example.com ~all"},
+			},
+			"mx.example.com.": {
+				TXT: []string{"v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/32 -all"},
+			},
+		},
+	}
+
+	res, err := checker.EvaluateSPF(ctx, &r, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, res.Lookups)
+	assert.True(t, res.Authorizes("mx.example.com."))
+	assert.False(t, res.Authorizes("other.com"))
+}
+
+func TestEvaluateSPFRedirect(t *testing.T) {
+	ctx := createContext(t)
+
+	r := mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"example.com.": {
+				TXT: []string{"v=spf1 redirect=mx.example.com"},
+			},
+			"mx.example.com.": {
+				TXT: []string{"v=spf1 ip4:192.0.2.1 -all"},
+			},
+		},
+	}
+
+	res, err := checker.EvaluateSPF(ctx, &r, "example.com")
+	assert.Nil(t, err)
+	assert.True(t, res.Authorizes("mx.example.com"))
+}
+
+func TestEvaluateSPFQualifiedInclude(t *testing.T) {
+	ctx := createContext(t)
+
+	r := mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"example.com.": {
+				TXT: []string{"v=spf1 -include:mx.example.com ~include:_spf.example.com +include:ok.example.com -all"},
+			},
+			"_spf.example.com.": {
+				TXT: []string{"v=spf1 include:nested.example.com -all"},
+			},
+			"mx.example.com.": {
+				TXT: []string{"v=spf1 ip4:192.0.2.1 -all"},
+			},
+			"nested.example.com.": {
+				TXT: []string{"v=spf1 ip4:192.0.2.2 -all"},
+			},
+			"ok.example.com.": {
+				TXT: []string{"v=spf1 ip4:192.0.2.3 -all"},
+			},
+		},
+	}
+
+	res, err := checker.EvaluateSPF(ctx, &r, "example.com")
+	assert.Nil(t, err)
+	assert.False(t, res.Authorizes("mx.example.com"))
+	assert.False(t, res.Authorizes("nested.example.com"), "a domain nested in a softfail include is not authorized")
+	assert.True(t, res.Authorizes("ok.example.com"))
+	assert.Contains(t, res.Includes, "mx.example.com")
+}
+
+func TestEvaluateSPFMultipleRecords(t *testing.T) {
+	ctx := createContext(t)
+
+	r := mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"example.com.": {
+				TXT: []string{
+					"v=spf1 include:mx.example.com ~all",
+					"v=spf1 -all",
+				},
+			},
+		},
+	}
+
+	_, err := checker.EvaluateSPF(ctx, &r, "example.com")
+	assertSPFPermError(t, err, "found 2 SPF records")
+}
+
+func TestEvaluateSPFTooManyLookups(t *testing.T) {
+	ctx := createContext(t)
+
+	zones := map[string]mockdns.Zone{
+		"example.com.": {
+			TXT: []string{"v=spf1 include:spf0.example.com -all"},
+		},
+	}
+	for i := 0; i < 11; i++ {
+		zones[fmt.Sprintf("spf%d.example.com.", i)] = mockdns.Zone{
+			TXT: []string{fmt.Sprintf("v=spf1 include:spf%d.example.com -all", i+1)},
+		}
+	}
+
+	r := mockdns.Resolver{Zones: zones}
+
+	_, err := checker.EvaluateSPF(ctx, &r, "example.com")
+	assertSPFPermError(t, err, "too many DNS lookups (limit is 10)")
+}
+
+func TestEvaluateSPFTooManyVoidLookups(t *testing.T) {
+	ctx := createContext(t)
+
+	r := mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"example.com.": {
+				TXT: []string{"v=spf1 a:a.example.com a:b.example.com exists:c.example.com -all"},
+			},
+		},
+	}
+
+	_, err := checker.EvaluateSPF(ctx, &r, "example.com")
+	assertSPFPermError(t, err, "too many void DNS lookups (limit is 2)")
+}
+
+func TestEvaluateSPFSyntaxError(t *testing.T) {
+	ctx := createContext(t)
+
+	r := mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"example.com.": {
+				TXT: []string{"v=spf1 ip4:300.0.0.1 -all"},
+			},
+		},
+	}
+
+	_, err := checker.EvaluateSPF(ctx, &r, "example.com")
+	assertSPFPermError(t, err, `invalid ip4 mechanism "ip4:300.0.0.1"`)
+}
+
+func TestEvaluateSPFMissingInclude(t *testing.T) {
+	ctx := createContext(t)
+
+	r := mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"example.com.": {
+				TXT: []string{"v=spf1 include:mx.example.com -all"},
+			},
+		},
+	}
+
+	_, err := checker.EvaluateSPF(ctx, &r, "example.com")
+	assertSPFPermError(t, err, "included domain mx.example.com has no SPF record")
+}
+
+func TestSPFReason(t *testing.T) {
+	ctx := createContext(t)
+
+	r := mockdns.Resolver{
+		Zones: map[string]mockdns.Zone{
+			"example.com.": {
+				TXT: []string{
+					"v=spf1 include:mx.example.com ~all",
+					"v=spf1 -all",
+				},
+			},
+		},
+	}
+
+	domain := createDomain(t)
+
+	c := checker.NewDNSChecker(&r)
+
+	res := c.CheckDomainSPF(ctx, domain)
+	assert.False(t, res.Result(), "should not have resolved SPF")
+	assert.Equal(t, "spf permerror on example.com: found 2 SPF records", res.Reason)
+}
+
+func assertSPFPermError(t *testing.T, err error, reason string) {
+	t.Helper()
+
+	var permErr *checker.SPFPermError
+	if assert.True(t, errors.As(err, &permErr), "expected a permerror, got %v", err) {
+		assert.Equal(t, reason, permErr.Reason)
+	}
+}
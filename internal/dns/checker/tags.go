@@ -0,0 +1,40 @@
+package checker
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tag struct {
+	name  string
+	value string
+}
+
+// parseTagList parses a `tag=value; tag=value` list as used by DKIM and
+// DMARC records.
+func parseTagList(txt string) ([]tag, error) {
+	var tags []tag
+	seen := map[string]bool{}
+
+	for _, spec := range strings.Split(txt, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid tag %q", spec)
+		}
+
+		name = strings.TrimSpace(name)
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate tag %q", name)
+		}
+		seen[name] = true
+
+		tags = append(tags, tag{name: name, value: strings.TrimSpace(value)})
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,278 @@
+package records
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+)
+
+const (
+	FormatBIND      = "bind"
+	FormatJSON      = "json"
+	FormatOctoDNS   = "octodns"
+	FormatTerraform = "terraform"
+
+	// DefaultTTL is the TTL used when exporting records.
+	DefaultTTL = 3600
+
+	// maxTXTStringLength is the maximum length of a single TXT character
+	// string (RFC 1035 3.3).
+	maxTXTStringLength = 255
+)
+
+// Formats lists the supported export formats.
+var Formats = []string{FormatBIND, FormatJSON, FormatOctoDNS, FormatTerraform}
+
+// Zone groups the records required by a domain.
+type Zone struct {
+	Domain  string                        `json:"domain"`
+	Records []corev1alpha1.RequiredRecord `json:"records"`
+}
+
+// ZoneFor returns the records required by domain.
+func ZoneFor(domain *corev1alpha1.Domain) Zone {
+	return Zone{
+		Domain:  domain.Spec.DomainName,
+		Records: Required(domain),
+	}
+}
+
+// Export writes the zones in the given format.
+func Export(w io.Writer, format string, zones []Zone) error {
+	switch format {
+	case FormatBIND:
+		return exportBIND(w, zones)
+	case FormatJSON:
+		return exportJSON(w, zones)
+	case FormatOctoDNS:
+		return exportOctoDNS(w, zones)
+	case FormatTerraform:
+		return exportTerraform(w, zones)
+	default:
+		return fmt.Errorf("unknown format %q, valid formats are %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+func exportBIND(w io.Writer, zones []Zone) error {
+	for i, zone := range zones {
+		header := fmt.Sprintf("; %s\n", zone.Domain)
+		if i > 0 {
+			header = "\n" + header
+		}
+		if _, err := io.WriteString(w, header); err != nil {
+			return err
+		}
+
+		for _, r := range zone.Records {
+			value := fqdn(r.Value)
+			if r.Type == TypeTXT {
+				value = quoteTXT(r.Value)
+			}
+
+			if _, err := fmt.Fprintf(w, "%s\t%d\tIN\t%s\t%s\n", fqdn(r.Name), DefaultTTL, r.Type, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func exportJSON(w io.Writer, zones []Zone) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(zones)
+}
+
+type octoDNSRecord struct {
+	Type   string   `json:"type"`
+	TTL    int      `json:"ttl"`
+	Value  string   `json:"value,omitempty"`
+	Values []string `json:"values,omitempty"`
+}
+
+// exportOctoDNS writes one YAML document per zone, in the format of the
+// octoDNS YamlProvider zone files.
+func exportOctoDNS(w io.Writer, zones []Zone) error {
+	for _, zone := range zones {
+		records := map[string][]octoDNSRecord{}
+
+		for _, set := range recordSets(zone) {
+			record := octoDNSRecord{Type: set.Type, TTL: DefaultTTL}
+
+			values := set.Values
+			if set.Type == TypeTXT {
+				// octoDNS requires semicolons in TXT values to be escaped.
+				for i, v := range values {
+					values[i] = strings.ReplaceAll(v, ";", "\\;")
+				}
+			} else {
+				for i, v := range values {
+					values[i] = fqdn(v)
+				}
+			}
+
+			if len(values) == 1 {
+				record.Value = values[0]
+			} else {
+				record.Values = values
+			}
+
+			records[set.Name] = append(records[set.Name], record)
+		}
+
+		out, err := yaml.Marshal(records)
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "---\n# %s.yaml\n%s", zone.Domain, out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var terraformIdentifier = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// exportTerraform writes resources for the hashicorp/dns Terraform provider.
+func exportTerraform(w io.Writer, zones []Zone) error {
+	for _, zone := range zones {
+		for _, set := range recordSets(zone) {
+			id := terraformIdentifier.ReplaceAllString(strings.TrimSuffix(set.Name+"_"+zone.Domain, "_"), "_")
+			id = strings.Trim(strings.ToLower(id), "_")
+
+			var b strings.Builder
+			b.WriteString("\n")
+			switch set.Type {
+			case TypeTXT:
+				fmt.Fprintf(&b, "resource \"dns_txt_record_set\" %q {\n", id)
+				fmt.Fprintf(&b, "  zone = %q\n", fqdn(zone.Domain))
+				if set.Name != "" {
+					fmt.Fprintf(&b, "  name = %q\n", set.Name)
+				}
+
+				b.WriteString("  txt  = [\n")
+				for _, v := range set.Values {
+					fmt.Fprintf(&b, "    %s,\n", terraformTXT(v))
+				}
+				b.WriteString("  ]\n")
+				fmt.Fprintf(&b, "  ttl  = %d\n", DefaultTTL)
+			case TypeCNAME:
+				fmt.Fprintf(&b, "resource \"dns_cname_record\" %q {\n", id)
+				fmt.Fprintf(&b, "  zone  = %q\n", fqdn(zone.Domain))
+				fmt.Fprintf(&b, "  name  = %q\n", set.Name)
+				fmt.Fprintf(&b, "  cname = %q\n", fqdn(set.Values[0]))
+				fmt.Fprintf(&b, "  ttl   = %d\n", DefaultTTL)
+			}
+			b.WriteString("}\n")
+
+			if _, err := io.WriteString(w, b.String()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// terraformTXT quotes a TXT value for the hashicorp/dns provider, which
+// writes it between quotes in the zone file syntax: a value longer than 255
+// bytes is split in character strings separated by escaped quotes, like
+// quoteTXT splits it.
+func terraformTXT(value string) string {
+	var parts []string
+	for len(value) > maxTXTStringLength {
+		parts = append(parts, value[:maxTXTStringLength])
+		value = value[maxTXTStringLength:]
+	}
+	parts = append(parts, value)
+
+	for i, p := range parts {
+		quoted := fmt.Sprintf("%q", p)
+		parts[i] = quoted[1 : len(quoted)-1]
+	}
+
+	return `"` + strings.Join(parts, `\" \"`) + `"`
+}
+
+type recordSet struct {
+	Name   string
+	Type   string
+	Values []string
+}
+
+// recordSets groups the records of a zone by relative name and type.
+func recordSets(zone Zone) []recordSet {
+	var sets []recordSet
+	index := map[string]int{}
+
+	for _, r := range zone.Records {
+		name := relativeName(r.Name, zone.Domain)
+		key := name + "/" + r.Type
+
+		i, ok := index[key]
+		if !ok {
+			i = len(sets)
+			index[key] = i
+			sets = append(sets, recordSet{Name: name, Type: r.Type})
+		}
+
+		sets[i].Values = append(sets[i].Values, r.Value)
+	}
+
+	sort.SliceStable(sets, func(i, j int) bool {
+		return sets[i].Name < sets[j].Name
+	})
+
+	return sets
+}
+
+func relativeName(name, zone string) string {
+	name = strings.TrimSuffix(name, ".")
+	zone = strings.TrimSuffix(zone, ".")
+
+	if name == zone {
+		return ""
+	}
+
+	return strings.TrimSuffix(name, "."+zone)
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+
+	return name + "."
+}
+
+// quoteTXT quotes a TXT value for a zone file, splitting it in multiple
+// character strings when it is longer than 255 bytes.
+func quoteTXT(value string) string {
+	var parts []string
+	for len(value) > maxTXTStringLength {
+		parts = append(parts, value[:maxTXTStringLength])
+		value = value[maxTXTStringLength:]
+	}
+	parts = append(parts, value)
+
+	for i, p := range parts {
+		p = strings.ReplaceAll(p, `\`, `\\`)
+		parts[i] = `"` + strings.ReplaceAll(p, `"`, `\"`) + `"`
+	}
+
+	if len(parts) == 1 {
+		return parts[0]
+	}
+
+	return "( " + strings.Join(parts, " ") + " )"
+}
@@ -0,0 +1,105 @@
+package records_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+	"github.com/kannon-email/k8nnon/internal/dns/records"
+)
+
+func testZone() records.Zone {
+	return records.Zone{
+		Domain: "example.com",
+		Records: []corev1alpha1.RequiredRecord{
+			{Name: "selector._domainkey.example.com", Type: records.TypeTXT, Value: "v=DKIM1; k=rsa; p=key"},
+			{Name: "example.com", Type: records.TypeTXT, Value: "v=spf1 include:mx.example.com ~all"},
+			{Name: "stats.example.com", Type: records.TypeCNAME, Value: "mx.example.com"},
+		},
+	}
+}
+
+func TestExportBIND(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := records.Export(out, records.FormatBIND, []records.Zone{testZone()})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "; example.com\n"+
+		"selector._domainkey.example.com.\t3600\tIN\tTXT\t\"v=DKIM1; k=rsa; p=key\"\n"+
+		"example.com.\t3600\tIN\tTXT\t\"v=spf1 include:mx.example.com ~all\"\n"+
+		"stats.example.com.\t3600\tIN\tCNAME\tmx.example.com.\n", out.String())
+}
+
+func TestExportBINDLongTXT(t *testing.T) {
+	zone := records.Zone{
+		Domain: "example.com",
+		Records: []corev1alpha1.RequiredRecord{
+			{Name: "selector._domainkey.example.com", Type: records.TypeTXT, Value: strings.Repeat("a", 300)},
+		},
+	}
+
+	out := &bytes.Buffer{}
+	err := records.Export(out, records.FormatBIND, []records.Zone{zone})
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "( \""+strings.Repeat("a", 255)+"\" \""+strings.Repeat("a", 45)+"\" )")
+}
+
+func TestExportOctoDNS(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := records.Export(out, records.FormatOctoDNS, []records.Zone{testZone()})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "---\n# example.com.yaml\n"+
+		"\"\":\n- ttl: 3600\n  type: TXT\n  value: v=spf1 include:mx.example.com ~all\n"+
+		"selector._domainkey:\n- ttl: 3600\n  type: TXT\n  value: v=DKIM1\\; k=rsa\\; p=key\n"+
+		"stats:\n- ttl: 3600\n  type: CNAME\n  value: mx.example.com.\n", out.String())
+}
+
+func TestExportTerraform(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := records.Export(out, records.FormatTerraform, []records.Zone{testZone()})
+	assert.Nil(t, err)
+
+	assert.Contains(t, out.String(), "resource \"dns_txt_record_set\" \"example_com\" {\n"+
+		"  zone = \"example.com.\"\n"+
+		"  txt  = [\n    \"v=spf1 include:mx.example.com ~all\",\n  ]\n"+
+		"  ttl  = 3600\n}\n")
+	assert.Contains(t, out.String(), "resource \"dns_cname_record\" \"stats_example_com\" {\n"+
+		"  zone  = \"example.com.\"\n  name  = \"stats\"\n  cname = \"mx.example.com.\"\n  ttl   = 3600\n}\n")
+}
+
+func TestExportTerraformLongTXT(t *testing.T) {
+	zone := records.Zone{
+		Domain: "example.com",
+		Records: []corev1alpha1.RequiredRecord{
+			{Name: "selector._domainkey.example.com", Type: records.TypeTXT, Value: strings.Repeat("a", 300)},
+		},
+	}
+
+	out := &bytes.Buffer{}
+	err := records.Export(out, records.FormatTerraform, []records.Zone{zone})
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "    \""+strings.Repeat("a", 255)+"\\\" \\\""+strings.Repeat("a", 45)+"\",\n")
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestExportWriteError(t *testing.T) {
+	for _, format := range records.Formats {
+		err := records.Export(failingWriter{}, format, []records.Zone{testZone()})
+		assert.EqualError(t, err, "disk full", format)
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	err := records.Export(&bytes.Buffer{}, "xml", []records.Zone{testZone()})
+	assert.NotNil(t, err)
+}
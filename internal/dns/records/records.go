@@ -0,0 +1,114 @@
+package records
+
+import (
+	"fmt"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+	"github.com/kannon-email/k8nnon/internal/dkim"
+)
+
+const (
+	TypeTXT   = "TXT"
+	TypeCNAME = "CNAME"
+
+	CheckDKIM  = "dkim"
+	CheckSPF   = "spf"
+	CheckDMARC = "dmarc"
+	CheckStats = "stats"
+)
+
+// Required computes the DNS records that must be published for the domain
+// to pass every check, along with their current verification state.
+func Required(domain *corev1alpha1.Domain) []corev1alpha1.RequiredRecord {
+	var records []corev1alpha1.RequiredRecord
+
+	for _, selector := range dkimSelectors(domain) {
+		if selector.PublicKey == "" {
+			continue
+		}
+
+		records = append(records, corev1alpha1.RequiredRecord{
+			Name:     dkim.RecordName(selector.Selector, domain.Spec.DomainName),
+			Type:     TypeTXT,
+			Value:    dkim.Record(selector.KeyType, selector.PublicKey),
+			Check:    CheckDKIM,
+			Verified: dkimSelectorVerified(domain, selector.Selector),
+		})
+	}
+
+	records = append(records,
+		corev1alpha1.RequiredRecord{
+			Name:     domain.Spec.DomainName,
+			Type:     TypeTXT,
+			Value:    SPFRecord(domain),
+			Check:    CheckSPF,
+			Verified: domain.Status.DNS.SFP.OK,
+		},
+		corev1alpha1.RequiredRecord{
+			Name:     fmt.Sprintf("_dmarc.%s", domain.Spec.DomainName),
+			Type:     TypeTXT,
+			Value:    DMARCRecord(domain),
+			Check:    CheckDMARC,
+			Verified: domain.Status.DNS.DMARC.OK,
+		},
+		corev1alpha1.RequiredRecord{
+			Name:     fmt.Sprintf("%s.%s", domain.Spec.StatsPrefix, domain.Spec.DomainName),
+			Type:     TypeCNAME,
+			Value:    domain.Spec.BaseDomain,
+			Check:    CheckStats,
+			Verified: domain.Status.DNS.Stats.OK,
+		},
+	)
+
+	return records
+}
+
+// SPFRecord returns the SPF record authorizing the base domain to send on
+// behalf of the domain. Domains already publishing an SPF record only need
+// to add the include mechanism to it.
+func SPFRecord(domain *corev1alpha1.Domain) string {
+	return fmt.Sprintf("v=spf1 include:%s ~all", domain.Spec.BaseDomain)
+}
+
+// DMARCRecord returns a DMARC record enforcing the configured policy.
+func DMARCRecord(domain *corev1alpha1.Domain) string {
+	policy := domain.Spec.DMARC.Policy
+	if policy == "" {
+		policy = "none"
+	}
+
+	return fmt.Sprintf("v=DMARC1; p=%s", policy)
+}
+
+// dkimSelectors returns the selectors to publish, including the one pending
+// propagation during a key rotation.
+func dkimSelectors(domain *corev1alpha1.Domain) []corev1alpha1.DKimSelector {
+	selectors := domain.DKimSelectors()
+
+	rotation := domain.Status.DKim.Rotation
+	if rotation == nil || rotation.PendingSelector == "" {
+		return selectors
+	}
+
+	for _, key := range domain.Status.DKim.ManagedKeys {
+		if key.Selector == rotation.PendingSelector {
+			selectors = append(selectors, corev1alpha1.DKimSelector{
+				Selector:  key.Selector,
+				KeyType:   key.KeyType,
+				PublicKey: key.PublicKey,
+			})
+		}
+	}
+
+	return selectors
+}
+
+func dkimSelectorVerified(domain *corev1alpha1.Domain, selector string) bool {
+	for _, s := range domain.Status.DNS.DKIMSelectors {
+		if s.Selector == selector {
+			return s.OK
+		}
+	}
+
+	return false
+}
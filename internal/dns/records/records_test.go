@@ -0,0 +1,83 @@
+package records_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+	"github.com/kannon-email/k8nnon/internal/dns/records"
+)
+
+func TestRequired(t *testing.T) {
+	domain := &corev1alpha1.Domain{
+		Spec: corev1alpha1.DomainSpec{
+			DomainName:  "example.com",
+			BaseDomain:  "mx.example.com",
+			StatsPrefix: "stats",
+			DKim: corev1alpha1.DKim{
+				Selector:  "selector",
+				PublicKey: "publicKey",
+				Selectors: []corev1alpha1.DKimSelector{
+					{Selector: "managed", KeyType: corev1alpha1.DKimKeyTypeEd25519},
+					{Selector: "missing"},
+				},
+			},
+			DMARC: corev1alpha1.DMARC{Policy: "reject"},
+		},
+		Status: corev1alpha1.DomainStatus{
+			DNS: corev1alpha1.DNSStatus{
+				Stats: corev1alpha1.DNSStatusStats{OK: true},
+				DKIMSelectors: []corev1alpha1.DNSStatusDKIMSelector{
+					{Selector: "selector", DNSStatusStats: corev1alpha1.DNSStatusStats{OK: true}},
+				},
+			},
+			DKim: corev1alpha1.DKimStatus{
+				ManagedKeys: []corev1alpha1.DKimManagedKey{
+					{Selector: "managed", KeyType: corev1alpha1.DKimKeyTypeEd25519, PublicKey: "edKey"},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, []corev1alpha1.RequiredRecord{
+		{Name: "selector._domainkey.example.com", Type: "TXT", Value: "v=DKIM1; k=rsa; p=publicKey", Check: "dkim", Verified: true},
+		{Name: "managed._domainkey.example.com", Type: "TXT", Value: "v=DKIM1; k=ed25519; p=edKey", Check: "dkim"},
+		{Name: "example.com", Type: "TXT", Value: "v=spf1 include:mx.example.com ~all", Check: "spf"},
+		{Name: "_dmarc.example.com", Type: "TXT", Value: "v=DMARC1; p=reject", Check: "dmarc"},
+		{Name: "stats.example.com", Type: "CNAME", Value: "mx.example.com", Check: "stats", Verified: true},
+	}, records.Required(domain))
+}
+
+func TestRequiredPendingRotation(t *testing.T) {
+	domain := &corev1alpha1.Domain{
+		Spec: corev1alpha1.DomainSpec{
+			DomainName: "example.com",
+			DKim: corev1alpha1.DKim{
+				Rotation: &corev1alpha1.DKimRotation{},
+			},
+		},
+		Status: corev1alpha1.DomainStatus{
+			DKim: corev1alpha1.DKimStatus{
+				ManagedKeys: []corev1alpha1.DKimManagedKey{
+					{Selector: "k8nnon-1", KeyType: "rsa", PublicKey: "old"},
+					{Selector: "k8nnon-2", KeyType: "rsa", PublicKey: "new"},
+				},
+				Rotation: &corev1alpha1.DKimRotationStatus{
+					Phase:           corev1alpha1.DKimRotationPublishing,
+					ActiveSelector:  "k8nnon-1",
+					PendingSelector: "k8nnon-2",
+				},
+			},
+		},
+	}
+
+	var names []string
+	for _, record := range records.Required(domain) {
+		if record.Check == records.CheckDKIM {
+			names = append(names, record.Name)
+		}
+	}
+
+	assert.Equal(t, []string{"k8nnon-1._domainkey.example.com", "k8nnon-2._domainkey.example.com"}, names)
+}
@@ -0,0 +1,183 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Address schemes selecting the transport of a resolver.
+const (
+	// SchemeUDP queries over UDP, retrying over TCP truncated responses.
+	// It is the default when an address has no scheme.
+	SchemeUDP = "udp"
+	// SchemeTCP queries over TCP.
+	SchemeTCP = "tcp"
+	// SchemeTLS queries over DNS over TLS (RFC 7858).
+	SchemeTLS = "tls"
+	// SchemeHTTPS queries over DNS over HTTPS (RFC 8484).
+	SchemeHTTPS = "https"
+)
+
+const (
+	// DefaultPort is the port used when an address does not specify one.
+	DefaultPort = "53"
+	// DefaultTLSPort is the default port of DNS over TLS servers.
+	DefaultTLSPort = "853"
+	// DefaultDoHPath is the path used when a DNS over HTTPS address does
+	// not specify one.
+	DefaultDoHPath = "/dns-query"
+)
+
+// ParseAddress validates a resolver address and returns it in canonical
+// form. Accepted addresses are IPv4 and IPv6 addresses and host names, with
+// an optional port: 10.0.0.53, 10.0.0.53:5353, fd00::53, [fd00::53]:5353,
+// dns.internal or dns.internal:53, which are queried over UDP with TCP
+// fallback. A scheme selects another transport: tcp://10.0.0.53,
+// tls://1.1.1.1 (port 853) or https://dns.example/dns-query.
+//
+// Addresses without scheme, or with the udp scheme, are returned as
+// host:port, the others as scheme://host:port, or as a URL for https.
+func ParseAddress(addr string) (string, error) {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		return "", fmt.Errorf("empty resolver address")
+	}
+
+	scheme, rest, ok := strings.Cut(addr, "://")
+	if !ok {
+		scheme, rest = SchemeUDP, addr
+	}
+
+	switch strings.ToLower(scheme) {
+	case SchemeUDP:
+		return parseHostPort(addr, rest, DefaultPort)
+	case SchemeTCP:
+		hostPort, err := parseHostPort(addr, rest, DefaultPort)
+		return SchemeTCP + "://" + hostPort, err
+	case SchemeTLS:
+		hostPort, err := parseHostPort(addr, rest, DefaultTLSPort)
+		return SchemeTLS + "://" + hostPort, err
+	case SchemeHTTPS:
+		return parseDoHURL(addr)
+	default:
+		return "", fmt.Errorf("invalid resolver address %q: unsupported scheme %q", addr, scheme)
+	}
+}
+
+// splitAddress returns the scheme and the target of a canonical address.
+func splitAddress(addr string) (string, string) {
+	scheme, target, ok := strings.Cut(addr, "://")
+	if !ok {
+		return SchemeUDP, addr
+	}
+
+	if scheme == SchemeHTTPS {
+		return scheme, addr
+	}
+
+	return scheme, target
+}
+
+// ParseAddresses validates a list of resolver addresses, see ParseAddress.
+func ParseAddresses(addresses []string) ([]string, error) {
+	parsed := make([]string, 0, len(addresses))
+	for _, addr := range addresses {
+		p, err := ParseAddress(addr)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, p)
+	}
+
+	return parsed, nil
+}
+
+func parseHostPort(addr, hostPort, defaultPort string) (string, error) {
+	host, port := hostPort, defaultPort
+
+	// A bare IPv6 address contains more than one colon and no brackets.
+	if strings.HasPrefix(hostPort, "[") && strings.HasSuffix(hostPort, "]") {
+		host = hostPort[1 : len(hostPort)-1]
+	} else if strings.HasPrefix(hostPort, "[") || strings.Count(hostPort, ":") == 1 {
+		var err error
+		host, port, err = net.SplitHostPort(hostPort)
+		if err != nil {
+			return "", fmt.Errorf("invalid resolver address %q: %w", addr, err)
+		}
+	}
+
+	if err := validatePort(port); err != nil {
+		return "", fmt.Errorf("invalid resolver address %q: %w", addr, err)
+	}
+
+	if strings.HasPrefix(hostPort, "[") && net.ParseIP(host) == nil {
+		return "", fmt.Errorf("invalid resolver address %q: %q is not an IPv6 address", addr, host)
+	}
+
+	if net.ParseIP(host) == nil && !isHostname(host) {
+		return "", fmt.Errorf("invalid resolver address %q: %q is not an IP address or host name", addr, host)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+func parseDoHURL(addr string) (string, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid resolver address %q: %w", addr, err)
+	}
+
+	if u.User != nil || u.Fragment != "" {
+		return "", fmt.Errorf("invalid resolver address %q: credentials and fragments are not supported", addr)
+	}
+
+	host := u.Hostname()
+	if net.ParseIP(host) == nil && !isHostname(host) {
+		return "", fmt.Errorf("invalid resolver address %q: %q is not an IP address or host name", addr, host)
+	}
+
+	if port := u.Port(); port != "" {
+		if err := validatePort(port); err != nil {
+			return "", fmt.Errorf("invalid resolver address %q: %w", addr, err)
+		}
+	}
+
+	u.Scheme = SchemeHTTPS
+	if u.Path == "" {
+		u.Path = DefaultDoHPath
+	}
+
+	return u.String(), nil
+}
+
+func validatePort(port string) error {
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+
+	return nil
+}
+
+func isHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
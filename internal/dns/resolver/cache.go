@@ -0,0 +1,240 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// maxCacheEntries bounds the number of answers held by a Cache.
+const maxCacheEntries = 10000
+
+// sharedLookupTimeout bounds a query shared by concurrent lookups, it does
+// not depend on the context of any of them.
+const sharedLookupTimeout = 30 * time.Second
+
+type bypassCacheKey struct{}
+
+// WithoutCache returns a context whose lookups are not answered from the
+// cache, forcing a fresh query. The fresh answers are cached anyway.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassCacheKey{}, true)
+}
+
+func cacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassCacheKey{}).(bool)
+	return bypass
+}
+
+// Cache is a Resolver caching the answers of another resolver for their
+// TTL, bounded by a maximum TTL. Negative answers are cached for the
+// negative caching TTL of the zone (RFC 2308 5), other errors are not
+// cached. Answers without TTL, like the ones of resolvers not reporting it
+// in the Trace, are not cached either.
+//
+// Concurrent identical lookups are merged into a single query, sent with a
+// context of its own so that a lookup giving up does not fail the others.
+// It is safe for concurrent use.
+type Cache struct {
+	resolver Resolver
+	name     string
+	maxTTL   time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	group   singleflight.Group
+}
+
+type cacheEntry struct {
+	value   interface{}
+	err     error
+	dnssec  DNSSECState
+	expires time.Time
+}
+
+type cacheResult struct {
+	value  interface{}
+	ttl    time.Duration
+	found  bool
+	dnssec DNSSECState
+}
+
+// NewCache returns a Cache in front of r, caching answers for at most
+// maxTTL.
+func NewCache(r Resolver, maxTTL time.Duration) *Cache {
+	return &Cache{
+		resolver: r,
+		name:     Name(r, 0),
+		maxTTL:   maxTTL,
+		now:      time.Now,
+		entries:  map[string]cacheEntry{},
+	}
+}
+
+func (c *Cache) String() string {
+	return c.name
+}
+
+func (c *Cache) LookupCNAME(ctx context.Context, name string) (string, error) {
+	v, err := c.lookup(ctx, "CNAME", name, func(ctx context.Context) (interface{}, error) {
+		return c.resolver.LookupCNAME(ctx, name)
+	})
+	cname, _ := v.(string)
+	return cname, err
+}
+
+func (c *Cache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	v, err := c.lookup(ctx, "HOST", host, func(ctx context.Context) (interface{}, error) {
+		return c.resolver.LookupHost(ctx, host)
+	})
+	addrs, _ := v.([]string)
+	return append([]string(nil), addrs...), err
+}
+
+func (c *Cache) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	v, err := c.lookup(ctx, "MX", name, func(ctx context.Context) (interface{}, error) {
+		return c.resolver.LookupMX(ctx, name)
+	})
+	mxs, _ := v.([]*net.MX)
+	return append([]*net.MX(nil), mxs...), err
+}
+
+func (c *Cache) LookupNS(ctx context.Context, name string) ([]*net.NS, error) {
+	v, err := c.lookup(ctx, "NS", name, func(ctx context.Context) (interface{}, error) {
+		return c.resolver.LookupNS(ctx, name)
+	})
+	nss, _ := v.([]*net.NS)
+	return append([]*net.NS(nil), nss...), err
+}
+
+func (c *Cache) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	v, err := c.lookup(ctx, "TXT", name, func(ctx context.Context) (interface{}, error) {
+		return c.resolver.LookupTXT(ctx, name)
+	})
+	txts, _ := v.([]string)
+	return append([]string(nil), txts...), err
+}
+
+// lookup answers the query identified by qtype and name from the cache, or
+// with fn on a miss.
+func (c *Cache) lookup(ctx context.Context, qtype, name string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	key := qtype + " " + strings.ToLower(strings.TrimSuffix(name, "."))
+	bypass := cacheBypassed(ctx)
+
+	if bypass {
+		cacheLookups.WithLabelValues(c.name, "bypass").Inc()
+	} else if entry, ok := c.get(key); ok {
+		cacheLookups.WithLabelValues(c.name, "hit").Inc()
+		ObserveTTL(ctx, uint32(entry.expires.Sub(c.now())/time.Second))
+		if entry.dnssec != "" {
+			ObserveDNSSEC(ctx, entry.dnssec)
+		}
+		return entry.value, entry.err
+	} else {
+		cacheLookups.WithLabelValues(c.name, "miss").Inc()
+	}
+
+	// The lookups bypassing the cache only share fresh queries.
+	flight := key
+	if bypass {
+		flight += " fresh"
+	}
+
+	ch := c.group.DoChan(flight, func() (interface{}, error) {
+		// Another lookup may have completed since the cache was checked.
+		if entry, ok := c.get(key); ok && !bypass {
+			return cacheResult{
+				value:  entry.value,
+				ttl:    entry.expires.Sub(c.now()),
+				found:  true,
+				dnssec: entry.dnssec,
+			}, entry.err
+		}
+
+		queryCtx, cancel := context.WithTimeout(context.Background(), sharedLookupTimeout)
+		defer cancel()
+
+		traceCtx, trace := WithTrace(queryCtx)
+		value, err := fn(traceCtx)
+
+		res := cacheResult{value: value, dnssec: trace.DNSSEC()}
+		res.ttl, res.found = trace.TTL()
+		if res.found && cacheable(err) {
+			c.set(key, cacheEntry{value: value, err: err, dnssec: res.dnssec}, res.ttl)
+		}
+
+		return res, err
+	})
+
+	var shared singleflight.Result
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case shared = <-ch:
+	}
+
+	res, err := shared.Val.(cacheResult), shared.Err
+	if res.found {
+		ObserveTTL(ctx, uint32(res.ttl/time.Second))
+	}
+	if res.dnssec != "" {
+		ObserveDNSSEC(ctx, res.dnssec)
+	}
+
+	return res.value, err
+}
+
+func (c *Cache) get(key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return entry, false
+	}
+
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		return entry, false
+	}
+
+	return entry, true
+}
+
+func (c *Cache) set(key string, entry cacheEntry, ttl time.Duration) {
+	if ttl > c.maxTTL {
+		ttl = c.maxTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if len(c.entries) >= maxCacheEntries {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+
+		if len(c.entries) >= maxCacheEntries {
+			return
+		}
+	}
+
+	entry.expires = now.Add(ttl)
+	c.entries[key] = entry
+}
+
+// cacheable reports whether a lookup failing with err can be cached.
+func cacheable(err error) bool {
+	return err == nil || isNotFound(err)
+}
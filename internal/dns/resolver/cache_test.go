@@ -0,0 +1,215 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingResolver answers TXT lookups with the given TTL, counting the
+// queries it receives.
+type countingResolver struct {
+	Resolver
+
+	ttl     uint32
+	err     error
+	queries int32
+	block   chan struct{}
+}
+
+func (r *countingResolver) String() string {
+	return "counting"
+}
+
+func (r *countingResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	atomic.AddInt32(&r.queries, 1)
+	if r.block != nil {
+		<-r.block
+	}
+
+	if r.ttl > 0 {
+		ObserveTTL(ctx, r.ttl)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return []string{"v=spf1 -all"}, nil
+}
+
+func newTestCache(r Resolver) (*Cache, *time.Time) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewCache(r, time.Hour)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestCacheHit(t *testing.T) {
+	r := &countingResolver{ttl: 300}
+	c, now := newTestCache(r)
+	ctx := context.Background()
+
+	_, err := c.LookupTXT(ctx, "example.com")
+	assert.Nil(t, err)
+
+	*now = now.Add(100 * time.Second)
+	traceCtx, trace := WithTrace(ctx)
+	txts, err := c.LookupTXT(traceCtx, "Example.com.")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v=spf1 -all"}, txts)
+	assert.Equal(t, int32(1), r.queries)
+
+	ttl, ok := trace.TTL()
+	assert.True(t, ok)
+	assert.Equal(t, 200*time.Second, ttl)
+
+	*now = now.Add(200 * time.Second)
+	_, err = c.LookupTXT(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), r.queries)
+}
+
+func TestCacheMaxTTL(t *testing.T) {
+	r := &countingResolver{ttl: 86400}
+	c, now := newTestCache(r)
+	ctx := context.Background()
+
+	_, _ = c.LookupTXT(ctx, "example.com")
+	*now = now.Add(time.Hour)
+	_, _ = c.LookupTXT(ctx, "example.com")
+	assert.Equal(t, int32(2), r.queries)
+}
+
+func TestCacheNegativeAnswer(t *testing.T) {
+	r := &countingResolver{ttl: 60, err: &net.DNSError{Err: "no such host", IsNotFound: true}}
+	c, _ := newTestCache(r)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := c.LookupTXT(ctx, "example.com")
+		var dnsErr *net.DNSError
+		assert.ErrorAs(t, err, &dnsErr)
+		assert.True(t, dnsErr.IsNotFound)
+	}
+	assert.Equal(t, int32(1), r.queries)
+}
+
+func TestCacheSkipsErrors(t *testing.T) {
+	r := &countingResolver{ttl: 60, err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}
+	c, _ := newTestCache(r)
+	ctx := context.Background()
+
+	_, _ = c.LookupTXT(ctx, "example.com")
+	_, _ = c.LookupTXT(ctx, "example.com")
+	assert.Equal(t, int32(2), r.queries)
+}
+
+func TestCacheWithoutTTL(t *testing.T) {
+	r := &countingResolver{}
+	c, _ := newTestCache(r)
+	ctx := context.Background()
+
+	_, _ = c.LookupTXT(ctx, "example.com")
+	_, _ = c.LookupTXT(ctx, "example.com")
+	assert.Equal(t, int32(2), r.queries)
+}
+
+func TestCacheBypass(t *testing.T) {
+	r := &countingResolver{ttl: 300}
+	c, _ := newTestCache(r)
+	ctx := context.Background()
+
+	hits := testutil.ToFloat64(cacheLookups.WithLabelValues("counting", "hit"))
+	bypasses := testutil.ToFloat64(cacheLookups.WithLabelValues("counting", "bypass"))
+
+	_, _ = c.LookupTXT(ctx, "example.com")
+	_, _ = c.LookupTXT(WithoutCache(ctx), "example.com")
+	assert.Equal(t, int32(2), r.queries)
+
+	_, _ = c.LookupTXT(ctx, "example.com")
+	assert.Equal(t, int32(2), r.queries)
+
+	assert.Equal(t, hits+1, testutil.ToFloat64(cacheLookups.WithLabelValues("counting", "hit")))
+	assert.Equal(t, bypasses+1, testutil.ToFloat64(cacheLookups.WithLabelValues("counting", "bypass")))
+}
+
+func TestCacheMergesConcurrentLookups(t *testing.T) {
+	r := &countingResolver{ttl: 300, block: make(chan struct{})}
+	c, _ := newTestCache(r)
+	ctx := context.Background()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			txts, err := c.LookupTXT(ctx, "example.com")
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"v=spf1 -all"}, txts)
+		}()
+	}
+
+	// Let the lookups reach the resolver before unblocking it.
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&r.queries) == 1 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	close(r.block)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), r.queries)
+}
+
+func TestCacheSharedLookupCancelled(t *testing.T) {
+	r := &countingResolver{ttl: 300, block: make(chan struct{})}
+	c, _ := newTestCache(r)
+
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, err := c.LookupTXT(first, "example.com")
+		firstErr <- err
+	}()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&r.queries) == 1 }, time.Second, time.Millisecond)
+
+	second := make(chan error)
+	go func() {
+		txts, err := c.LookupTXT(context.Background(), "example.com")
+		assert.Equal(t, []string{"v=spf1 -all"}, txts)
+		second <- err
+	}()
+
+	// The first lookup gives up without failing the one waiting for the
+	// same query.
+	cancel()
+	assert.ErrorIs(t, <-firstErr, context.Canceled)
+
+	close(r.block)
+	assert.Nil(t, <-second)
+	assert.Equal(t, int32(1), r.queries)
+}
+
+func TestCacheBypassNotMerged(t *testing.T) {
+	r := &countingResolver{ttl: 300, block: make(chan struct{})}
+	c, _ := newTestCache(r)
+	ctx := context.Background()
+
+	wg := sync.WaitGroup{}
+	for _, lookupCtx := range []context.Context{ctx, WithoutCache(ctx)} {
+		wg.Add(1)
+		go func(lookupCtx context.Context) {
+			defer wg.Done()
+			_, err := c.LookupTXT(lookupCtx, "example.com")
+			assert.Nil(t, err)
+		}(lookupCtx)
+	}
+
+	// The lookup bypassing the cache does not join the other query.
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&r.queries) == 2 }, time.Second, time.Millisecond)
+	close(r.block)
+	wg.Wait()
+}
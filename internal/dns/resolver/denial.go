@@ -0,0 +1,183 @@
+package resolver
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// provesDenial reports whether the NSEC or NSEC3 records of the authority
+// section of a negative answer deny the existence of qname, or of its
+// records of type qtype, see RFC 4035 5.4 and RFC 5155 8. The records must
+// have been validated already.
+func provesDenial(qname string, qtype uint16, nxdomain bool, records []dns.RR) bool {
+	var nsecs []*dns.NSEC
+	var nsec3s []*dns.NSEC3
+	for _, rr := range records {
+		switch rr := rr.(type) {
+		case *dns.NSEC:
+			nsecs = append(nsecs, rr)
+		case *dns.NSEC3:
+			nsec3s = append(nsec3s, rr)
+		}
+	}
+
+	qname = strings.ToLower(dns.Fqdn(qname))
+	switch {
+	case len(nsecs) > 0:
+		return nsecDenies(qname, qtype, nxdomain, nsecs)
+	case len(nsec3s) > 0:
+		return nsec3Denies(qname, qtype, nxdomain, nsec3s)
+	default:
+		return false
+	}
+}
+
+func nsecDenies(qname string, qtype uint16, nxdomain bool, nsecs []*dns.NSEC) bool {
+	if !nxdomain {
+		for _, nsec := range nsecs {
+			if strings.EqualFold(nsec.Hdr.Name, qname) {
+				return !hasType(nsec.TypeBitMap, qtype) && !hasType(nsec.TypeBitMap, dns.TypeCNAME)
+			}
+		}
+	}
+
+	for _, nsec := range nsecs {
+		if !nsecCovers(nsec, qname) {
+			continue
+		}
+
+		// An empty non-terminal has no records but names below it.
+		if !nxdomain {
+			return dns.IsSubDomain(qname, strings.ToLower(nsec.NextDomain))
+		}
+
+		// The name does not exist, nor does the wildcard of its closest
+		// encloser that could have synthesized it.
+		encloser := commonAncestor(qname, nsec.Hdr.Name)
+		if next := commonAncestor(qname, nsec.NextDomain); dns.CountLabel(next) > dns.CountLabel(encloser) {
+			encloser = next
+		}
+
+		wildcard := "*." + encloser
+		if encloser == "." {
+			wildcard = "*."
+		}
+		for _, other := range nsecs {
+			if nsecCovers(other, wildcard) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return false
+}
+
+func nsec3Denies(qname string, qtype uint16, nxdomain bool, nsec3s []*dns.NSEC3) bool {
+	if !nxdomain {
+		for _, nsec3 := range nsec3s {
+			if nsec3.Match(qname) {
+				return !hasType(nsec3.TypeBitMap, qtype) && !hasType(nsec3.TypeBitMap, dns.TypeCNAME)
+			}
+		}
+	}
+
+	encloser, nextCloser, ok := closestEncloser(qname, nsec3s)
+	if !ok {
+		return false
+	}
+
+	var covering *dns.NSEC3
+	for _, nsec3 := range nsec3s {
+		if nsec3.Cover(nextCloser) {
+			covering = nsec3
+		}
+	}
+	if covering == nil {
+		return false
+	}
+
+	if !nxdomain {
+		// A DS query for an unsigned delegation in an opt-out span.
+		return qtype == dns.TypeDS && covering.Flags&1 != 0
+	}
+
+	wildcard := "*." + encloser
+	if encloser == "." {
+		wildcard = "*."
+	}
+	for _, nsec3 := range nsec3s {
+		if nsec3.Cover(wildcard) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// closestEncloser returns the longest existing ancestor of qname matched by
+// an NSEC3 record, and the name one label longer towards qname.
+func closestEncloser(qname string, nsec3s []*dns.NSEC3) (string, string, bool) {
+	labels := dns.SplitDomainName(qname)
+	for i := 1; i <= len(labels); i++ {
+		encloser := "."
+		if i < len(labels) {
+			encloser = dns.Fqdn(strings.Join(labels[i:], "."))
+		}
+
+		for _, nsec3 := range nsec3s {
+			if nsec3.Match(encloser) {
+				return encloser, dns.Fqdn(strings.Join(labels[i-1:], ".")), true
+			}
+		}
+	}
+
+	return "", "", false
+}
+
+// nsecCovers reports whether name sorts strictly between the owner and the
+// next name of nsec, the last NSEC of a zone wrapping to its apex.
+func nsecCovers(nsec *dns.NSEC, name string) bool {
+	owner, next := nsec.Hdr.Name, nsec.NextDomain
+	if canonicalLess(owner, next) {
+		return canonicalLess(owner, name) && canonicalLess(name, next)
+	}
+
+	return canonicalLess(owner, name) || canonicalLess(name, next)
+}
+
+// canonicalLess compares names in the canonical DNS order of RFC 4034 6.1.
+func canonicalLess(a, b string) bool {
+	la := dns.SplitDomainName(strings.ToLower(a))
+	lb := dns.SplitDomainName(strings.ToLower(b))
+
+	for i := 1; i <= len(la) && i <= len(lb); i++ {
+		x, y := la[len(la)-i], lb[len(lb)-i]
+		if x != y {
+			return x < y
+		}
+	}
+
+	return len(la) < len(lb)
+}
+
+func commonAncestor(a, b string) string {
+	labels := dns.SplitDomainName(strings.ToLower(a))
+	n := dns.CompareDomainName(a, b)
+	if n == 0 {
+		return "."
+	}
+
+	return dns.Fqdn(strings.Join(labels[len(labels)-n:], "."))
+}
+
+func hasType(bitmap []uint16, qtype uint16) bool {
+	for _, t := range bitmap {
+		if t == qtype {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,108 @@
+package resolver
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func nsec(owner, next string, types ...uint16) dns.RR {
+	return &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: owner, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 300},
+		NextDomain: next,
+		TypeBitMap: types,
+	}
+}
+
+func TestNSECDenial(t *testing.T) {
+	// example.com has records at the apex, at mail and below the empty
+	// non-terminal ent.
+	chain := []dns.RR{
+		nsec("example.com.", "a.ent.example.com.", dns.TypeSOA, dns.TypeNS, dns.TypeTXT),
+		nsec("a.ent.example.com.", "mail.example.com.", dns.TypeTXT),
+		nsec("mail.example.com.", "example.com.", dns.TypeTXT, dns.TypeMX),
+	}
+
+	tests := []struct {
+		name     string
+		qname    string
+		qtype    uint16
+		nxdomain bool
+		records  []dns.RR
+		denied   bool
+	}{
+		{"nodata", "mail.example.com", dns.TypeA, false, chain[2:], true},
+		{"existing type", "mail.example.com", dns.TypeTXT, false, chain[2:], false},
+		{"empty non-terminal", "ent.example.com", dns.TypeTXT, false, chain[:1], true},
+		{"nxdomain", "b.example.com", dns.TypeTXT, true, chain[:1], true},
+		{"nxdomain after the last name", "zzz.example.com", dns.TypeTXT, true, chain, true},
+		{"nxdomain without wildcard denial", "zzz.example.com", dns.TypeTXT, true, chain[2:], false},
+		{"not covered", "zzz.example.com", dns.TypeTXT, true, chain[1:2], false},
+		{"nodata without matching record", "mail.example.com", dns.TypeA, false, chain[:1], false},
+		{"no records", "mail.example.com", dns.TypeA, false, nil, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.denied, provesDenial(tt.qname, tt.qtype, tt.nxdomain, tt.records), tt.name)
+	}
+}
+
+// nsec3Chain returns the NSEC3 records of the names of example.com, with
+// the types of each name.
+func nsec3Chain(names map[string][]uint16, optOut bool) []dns.RR {
+	hashes := map[string]string{}
+	var sorted []string
+	for name := range names {
+		h := dns.HashName(name, dns.SHA1, 0, "")
+		hashes[h] = name
+		sorted = append(sorted, h)
+	}
+	sort.Strings(sorted)
+
+	var flags uint8
+	if optOut {
+		flags = 1
+	}
+
+	var records []dns.RR
+	for i, h := range sorted {
+		records = append(records, &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: h + ".example.com.", Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 300},
+			Hash:       dns.SHA1,
+			Flags:      flags,
+			NextDomain: sorted[(i+1)%len(sorted)],
+			TypeBitMap: names[hashes[h]],
+		})
+	}
+
+	return records
+}
+
+func TestNSEC3Denial(t *testing.T) {
+	chain := nsec3Chain(map[string][]uint16{
+		"example.com.":      {dns.TypeSOA, dns.TypeNS, dns.TypeTXT},
+		"mail.example.com.": {dns.TypeTXT},
+	}, false)
+
+	assert.True(t, provesDenial("mail.example.com", dns.TypeA, false, chain), "nodata")
+	assert.False(t, provesDenial("mail.example.com", dns.TypeTXT, false, chain), "existing type")
+	assert.True(t, provesDenial("missing.example.com", dns.TypeTXT, true, chain), "nxdomain")
+	assert.False(t, provesDenial("missing.example.org", dns.TypeTXT, true, chain), "names outside the zone are not covered")
+
+	// An unsigned delegation in an opt-out span has no NSEC3 record.
+	optOut := nsec3Chain(map[string][]uint16{
+		"example.com.": {dns.TypeSOA, dns.TypeNS},
+	}, true)
+	assert.True(t, provesDenial("insecure.example.com", dns.TypeDS, false, optOut))
+	assert.False(t, provesDenial("insecure.example.com", dns.TypeDS, false, chain))
+}
+
+func TestCanonicalLess(t *testing.T) {
+	ordered := []string{"example.", "a.example.", "yljkjljk.a.example.", "Z.a.example.", "zABC.a.EXAMPLE.", "z.example.", "*.z.example."}
+	for i := 0; i < len(ordered)-1; i++ {
+		assert.True(t, canonicalLess(ordered[i], ordered[i+1]), "%s < %s", ordered[i], ordered[i+1])
+		assert.False(t, canonicalLess(ordered[i+1], ordered[i]), "%s > %s", ordered[i+1], ordered[i])
+	}
+}
@@ -0,0 +1,520 @@
+package resolver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNSSECState is the DNSSEC validation state of an answer (RFC 4035 4.3).
+type DNSSECState string
+
+const (
+	// DNSSECSecure answers are signed with a chain of trust from a trust
+	// anchor.
+	DNSSECSecure DNSSECState = "secure"
+	// DNSSECInsecure answers come from an unsigned zone, proven unsigned by
+	// its parent.
+	DNSSECInsecure DNSSECState = "insecure"
+	// DNSSECBogus answers should be signed but their signatures are
+	// missing, expired or invalid.
+	DNSSECBogus DNSSECState = "bogus"
+)
+
+// DNSSEC validation modes.
+const (
+	// DNSSECOff does not request DNSSEC records.
+	DNSSECOff = "off"
+	// DNSSECAD trusts the AD flag set by validating resolvers, detecting
+	// bogus answers by retrying the queries they fail with checking
+	// disabled.
+	DNSSECAD = "ad"
+	// DNSSECValidate validates the chain of trust of the answers from the
+	// trust anchors, with checking disabled on the resolvers.
+	DNSSECValidate = "validate"
+)
+
+// DNSSECModes lists the supported DNSSEC validation modes.
+var DNSSECModes = []string{DNSSECOff, DNSSECAD, DNSSECValidate}
+
+// RootTrustAnchor is the DS record of the root zone KSK-2017.
+const RootTrustAnchor = ". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D"
+
+// maxZoneKeysTTL bounds how long the validated keys of a zone are cached.
+const maxZoneKeysTTL = time.Hour
+
+// failedZoneKeysTTL is how long a zone whose keys could not be validated is
+// cached.
+const failedZoneKeysTTL = time.Minute
+
+// maxZoneKeys bounds the number of zones whose keys are cached.
+const maxZoneKeys = 1024
+
+// DNSSECOptions configures DNSSEC validation of the answers.
+type DNSSECOptions struct {
+	// Mode is one of DNSSECModes, empty meaning DNSSECOff.
+	Mode string
+	// TrustAnchors are DS records in presentation format used as trust
+	// anchors in DNSSECValidate mode. When empty RootTrustAnchor is used.
+	TrustAnchors []string
+}
+
+// Validate checks the mode and the trust anchors.
+func (o DNSSECOptions) Validate() error {
+	_, err := newDNSSEC(o)
+	return err
+}
+
+// LoadTrustAnchors reads DS records from a file, one per line. Empty lines
+// and comments starting with ; are ignored.
+func LoadTrustAnchors(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var anchors []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, ";") {
+			anchors = append(anchors, line)
+		}
+	}
+
+	return anchors, scanner.Err()
+}
+
+// ObserveDNSSEC records the DNSSEC state of an answer in the trace of ctx,
+// if any.
+func ObserveDNSSEC(ctx context.Context, state DNSSECState) {
+	if t, ok := ctx.Value(traceKey{}).(*Trace); ok {
+		t.observeDNSSEC(state)
+	}
+}
+
+// Weaker reports whether s is weaker than other: bogus is weaker than
+// insecure, which is weaker than secure, which is weaker than no state.
+func (s DNSSECState) Weaker(other DNSSECState) bool {
+	rank := map[DNSSECState]int{DNSSECSecure: 1, DNSSECInsecure: 2, DNSSECBogus: 3}
+	return rank[s] > rank[other]
+}
+
+// dnssec validates the answers of a resolver.
+type dnssec struct {
+	mode      string
+	validator *validator
+}
+
+// newDNSSEC returns nil when DNSSEC is off.
+func newDNSSEC(o DNSSECOptions) (*dnssec, error) {
+	switch o.Mode {
+	case "", DNSSECOff:
+		return nil, nil
+	case DNSSECAD:
+		return &dnssec{mode: DNSSECAD}, nil
+	case DNSSECValidate:
+	default:
+		return nil, fmt.Errorf("unknown DNSSEC mode %q, valid modes are %s", o.Mode, strings.Join(DNSSECModes, ", "))
+	}
+
+	anchors := o.TrustAnchors
+	if len(anchors) == 0 {
+		anchors = []string{RootTrustAnchor}
+	}
+
+	v := &validator{anchors: map[string][]*dns.DS{}, zones: map[string]zoneKeys{}, now: time.Now}
+	for _, anchor := range anchors {
+		rr, err := dns.NewRR(anchor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trust anchor %q: %w", anchor, err)
+		}
+
+		ds, ok := rr.(*dns.DS)
+		if !ok {
+			return nil, fmt.Errorf("invalid trust anchor %q: not a DS record", anchor)
+		}
+
+		zone := strings.ToLower(ds.Hdr.Name)
+		v.anchors[zone] = append(v.anchors[zone], ds)
+	}
+
+	return &dnssec{mode: DNSSECValidate, validator: v}, nil
+}
+
+// checkingDisabled reports whether the queries disable the validation of
+// the resolver.
+func (d *dnssec) checkingDisabled() bool {
+	return d.mode == DNSSECValidate
+}
+
+// check records the DNSSEC state of res, the answer of r to the query of
+// name and qtype, and returns the answer to use.
+func (d *dnssec) check(ctx context.Context, r *dnsResolver, name string, qtype uint16, res *dns.Msg) *dns.Msg {
+	if d.mode == DNSSECValidate {
+		if res.Rcode == dns.RcodeSuccess || res.Rcode == dns.RcodeNameError {
+			ObserveDNSSEC(ctx, d.validator.validate(ctx, r, res))
+		}
+		return res
+	}
+
+	switch res.Rcode {
+	case dns.RcodeSuccess, dns.RcodeNameError:
+		if res.AuthenticatedData {
+			ObserveDNSSEC(ctx, DNSSECSecure)
+		} else {
+			ObserveDNSSEC(ctx, DNSSECInsecure)
+		}
+	case dns.RcodeServerFailure:
+		// Validating resolvers answer SERVFAIL to bogus answers, which they
+		// return with checking disabled.
+		cdRes, err := r.followUp(ctx, name, qtype)
+		if err == nil && cdRes.Rcode != dns.RcodeServerFailure {
+			ObserveDNSSEC(ctx, DNSSECBogus)
+			return cdRes
+		}
+	}
+
+	return res
+}
+
+// validator validates the chain of trust of answers, following the signer
+// names of their signatures up to a trust anchor. It caches the validated
+// keys of the zones.
+//
+// Denials of existence are secure when their NSEC or NSEC3 records are
+// validly signed and cover the queried name, they are bogus otherwise.
+type validator struct {
+	anchors map[string][]*dns.DS
+	now     func() time.Time
+
+	mu    sync.Mutex
+	zones map[string]zoneKeys
+}
+
+type zoneKeys struct {
+	state   DNSSECState
+	keys    []*dns.DNSKEY
+	expires time.Time
+}
+
+type rrset struct {
+	rrs  []dns.RR
+	sigs []*dns.RRSIG
+}
+
+// rrsets groups records by owner name and type, with their signatures.
+func rrsets(records []dns.RR) []rrset {
+	var sets []rrset
+	index := map[string]int{}
+
+	key := func(name string, rrtype uint16) string {
+		return strings.ToLower(name) + "/" + dns.TypeToString[rrtype]
+	}
+
+	for _, rr := range records {
+		if _, ok := rr.(*dns.RRSIG); ok || rr.Header().Rrtype == dns.TypeOPT {
+			continue
+		}
+
+		k := key(rr.Header().Name, rr.Header().Rrtype)
+		i, ok := index[k]
+		if !ok {
+			i = len(sets)
+			index[k] = i
+			sets = append(sets, rrset{})
+		}
+		sets[i].rrs = append(sets[i].rrs, rr)
+	}
+
+	for _, rr := range records {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			if i, ok := index[key(sig.Hdr.Name, sig.TypeCovered)]; ok {
+				sets[i].sigs = append(sets[i].sigs, sig)
+			}
+		}
+	}
+
+	return sets
+}
+
+// validate returns the DNSSEC state of an answer: the weakest state of its
+// record sets, or of its authority section for negative answers.
+func (v *validator) validate(ctx context.Context, r *dnsResolver, res *dns.Msg) DNSSECState {
+	records := res.Answer
+	if len(records) == 0 {
+		records = res.Ns
+	}
+
+	sets := rrsets(records)
+	if len(sets) == 0 {
+		// An empty answer without SOA cannot be proven insecure.
+		return DNSSECBogus
+	}
+
+	state := DNSSECSecure
+	for _, set := range sets {
+		if s := v.validateRRset(ctx, r, set); s.Weaker(state) {
+			state = s
+		}
+	}
+
+	if state == DNSSECSecure && len(res.Answer) == 0 && len(res.Question) > 0 {
+		q := res.Question[0]
+		if !provesDenial(q.Name, q.Qtype, res.Rcode == dns.RcodeNameError, res.Ns) {
+			return DNSSECBogus
+		}
+	}
+
+	return state
+}
+
+func (v *validator) validateRRset(ctx context.Context, r *dnsResolver, set rrset) DNSSECState {
+	owner := set.rrs[0].Header().Name
+
+	if len(set.sigs) == 0 {
+		zone, err := v.zoneOf(ctx, r, owner)
+		if err != nil {
+			return DNSSECBogus
+		}
+
+		// Unsigned records are only expected in unsigned zones.
+		if state := v.keys(ctx, r, zone).state; state != DNSSECSecure {
+			return state
+		}
+		return DNSSECBogus
+	}
+
+	now := v.now()
+	for _, sig := range set.sigs {
+		if !dns.IsSubDomain(sig.SignerName, owner) {
+			continue
+		}
+
+		zone := v.keys(ctx, r, strings.ToLower(sig.SignerName))
+		if zone.state != DNSSECSecure {
+			return zone.state
+		}
+
+		if !sig.ValidityPeriod(now) {
+			continue
+		}
+
+		for _, key := range zone.keys {
+			if sig.Verify(key, set.rrs) == nil {
+				return DNSSECSecure
+			}
+		}
+	}
+
+	return DNSSECBogus
+}
+
+// zoneOf returns the zone holding name, from the owner of the SOA record
+// answering a SOA query.
+func (v *validator) zoneOf(ctx context.Context, r *dnsResolver, name string) (string, error) {
+	res, err := r.followUp(ctx, name, dns.TypeSOA)
+	if err != nil {
+		return "", err
+	}
+
+	for _, rr := range append(res.Answer, res.Ns...) {
+		if soa, ok := rr.(*dns.SOA); ok && dns.IsSubDomain(soa.Hdr.Name, name) {
+			return strings.ToLower(soa.Hdr.Name), nil
+		}
+	}
+
+	return "", fmt.Errorf("no SOA record found for %s", name)
+}
+
+// keys returns the validated keys of zone.
+func (v *validator) keys(ctx context.Context, r *dnsResolver, zone string) zoneKeys {
+	zone = dns.Fqdn(zone)
+
+	v.mu.Lock()
+	cached, ok := v.zones[zone]
+	v.mu.Unlock()
+	if ok && v.now().Before(cached.expires) {
+		return cached
+	}
+
+	keys, ttl := v.fetchKeys(ctx, r, zone)
+	if keys.state != DNSSECSecure || ttl > maxZoneKeysTTL {
+		ttl = maxZoneKeysTTL
+	}
+	if keys.state == DNSSECBogus {
+		ttl = failedZoneKeysTTL
+	}
+	keys.expires = v.now().Add(ttl)
+
+	v.mu.Lock()
+	v.storeKeys(zone, keys)
+	v.mu.Unlock()
+
+	return keys
+}
+
+// storeKeys caches the keys of zone, evicting the expired zones, or the
+// zone expiring first, when the cache is full. It must be called with the
+// lock held.
+func (v *validator) storeKeys(zone string, keys zoneKeys) {
+	if _, ok := v.zones[zone]; !ok && len(v.zones) >= maxZoneKeys {
+		now := v.now()
+		oldest := ""
+		for name, cached := range v.zones {
+			if !now.Before(cached.expires) {
+				delete(v.zones, name)
+			} else if oldest == "" || cached.expires.Before(v.zones[oldest].expires) {
+				oldest = name
+			}
+		}
+
+		if len(v.zones) >= maxZoneKeys {
+			delete(v.zones, oldest)
+		}
+	}
+
+	v.zones[zone] = keys
+}
+
+func (v *validator) fetchKeys(ctx context.Context, r *dnsResolver, zone string) (zoneKeys, time.Duration) {
+	bogus := zoneKeys{state: DNSSECBogus}
+
+	dsSet, ok := v.anchors[zone]
+	if !ok {
+		if zone == "." {
+			return zoneKeys{state: DNSSECInsecure}, 0
+		}
+
+		var state DNSSECState
+		dsSet, state = v.delegation(ctx, r, zone)
+		if state != DNSSECSecure {
+			return zoneKeys{state: state}, 0
+		}
+	}
+
+	res, err := r.followUp(ctx, zone, dns.TypeDNSKEY)
+	if err != nil || res.Rcode != dns.RcodeSuccess {
+		return bogus, 0
+	}
+
+	var keys []*dns.DNSKEY
+	var sigs []*dns.RRSIG
+	for _, rr := range res.Answer {
+		switch rr := rr.(type) {
+		case *dns.DNSKEY:
+			if rr.Flags&dns.ZONE != 0 && strings.EqualFold(rr.Hdr.Name, zone) {
+				keys = append(keys, rr)
+			}
+		case *dns.RRSIG:
+			if rr.TypeCovered == dns.TypeDNSKEY {
+				sigs = append(sigs, rr)
+			}
+		}
+	}
+
+	var rrs []dns.RR
+	for _, rr := range res.Answer {
+		if rr.Header().Rrtype == dns.TypeDNSKEY {
+			rrs = append(rrs, rr)
+		}
+	}
+
+	now := v.now()
+	for _, key := range keys {
+		if !matchesDS(key, dsSet) {
+			continue
+		}
+
+		for _, sig := range sigs {
+			if sig.ValidityPeriod(now) && sig.Verify(key, rrs) == nil {
+				return zoneKeys{state: DNSSECSecure, keys: keys}, time.Duration(rrs[0].Header().Ttl) * time.Second
+			}
+		}
+	}
+
+	return bogus, 0
+}
+
+// delegation returns the validated DS records of zone from its parent. A
+// zone without DS records in a signed parent is insecure.
+func (v *validator) delegation(ctx context.Context, r *dnsResolver, zone string) ([]*dns.DS, DNSSECState) {
+	res, err := r.followUp(ctx, zone, dns.TypeDS)
+	if err != nil || (res.Rcode != dns.RcodeSuccess && res.Rcode != dns.RcodeNameError) {
+		return nil, DNSSECBogus
+	}
+
+	var dsSet []*dns.DS
+	for _, rr := range res.Answer {
+		if ds, ok := rr.(*dns.DS); ok {
+			dsSet = append(dsSet, ds)
+		}
+	}
+
+	records := res.Answer
+	if len(dsSet) == 0 {
+		records = res.Ns
+	}
+
+	sets := rrsets(records)
+	if len(sets) == 0 {
+		return nil, DNSSECBogus
+	}
+
+	state := DNSSECSecure
+	for _, set := range sets {
+		// The DS records and denials are signed by an ancestor, never by the
+		// zone itself, which also bounds the recursion.
+		for _, sig := range set.sigs {
+			if !isStrictAncestor(sig.SignerName, zone) {
+				return nil, DNSSECBogus
+			}
+		}
+		if len(set.sigs) == 0 && !isStrictAncestor(set.rrs[0].Header().Name, zone) {
+			return nil, DNSSECBogus
+		}
+
+		if s := v.validateRRset(ctx, r, set); s.Weaker(state) {
+			state = s
+		}
+	}
+
+	if state != DNSSECSecure {
+		return nil, state
+	}
+
+	if len(dsSet) == 0 {
+		// The parent must prove that the delegation has no DS records.
+		if !provesDenial(zone, dns.TypeDS, res.Rcode == dns.RcodeNameError, res.Ns) {
+			return nil, DNSSECBogus
+		}
+		return nil, DNSSECInsecure
+	}
+
+	return dsSet, DNSSECSecure
+}
+
+func matchesDS(key *dns.DNSKEY, dsSet []*dns.DS) bool {
+	for _, ds := range dsSet {
+		if ds.KeyTag != key.KeyTag() || ds.Algorithm != key.Algorithm {
+			continue
+		}
+
+		if keyDS := key.ToDS(ds.DigestType); keyDS != nil && strings.EqualFold(keyDS.Digest, ds.Digest) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isStrictAncestor(ancestor, name string) bool {
+	return dns.IsSubDomain(ancestor, name) && dns.CountLabel(ancestor) < dns.CountLabel(name)
+}
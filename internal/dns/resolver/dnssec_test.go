@@ -0,0 +1,258 @@
+package resolver
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// signedZone serves example.com, signed with a single key, and the unsigned
+// insecure.example.com delegated from it.
+type signedZone struct {
+	t       *testing.T
+	key     *dns.DNSKEY
+	signer  crypto.Signer
+	records map[string][]dns.RR
+}
+
+func newSignedZone(t *testing.T) *signedZone {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	assert.Nil(t, err)
+
+	z := &signedZone{t: t, key: key, signer: priv.(crypto.Signer), records: map[string][]dns.RR{}}
+
+	z.add(true, key)
+	z.add(true, rr(t, "example.com. 3600 IN SOA ns.example.com. admin.example.com. 1 3600 600 86400 300"))
+	z.add(true, rr(t, "example.com. 300 IN TXT \"v=spf1 -all\""))
+	z.add(false, rr(t, "unsigned.example.com. 300 IN TXT \"v=spf1 -all\""))
+
+	// A signature over another value does not validate the record.
+	tampered := rr(t, "tampered.example.com. 300 IN TXT \"v=spf1 -all\"")
+	z.records[key2("tampered.example.com.", dns.TypeTXT)] = []dns.RR{tampered, z.sign(rr(t, "tampered.example.com. 300 IN TXT \"v=spf1 +all\""))}
+
+	// The names between the apex and insecure.example.com do not exist.
+	z.add(true, rr(t, "example.com. 300 IN NSEC insecure.example.com. SOA TXT RRSIG NSEC DNSKEY"))
+
+	// insecure.example.com is delegated without DS records.
+	z.add(true, rr(t, "insecure.example.com. 300 IN NSEC sub.example.com. NS RRSIG NSEC"))
+	z.records[key2("insecure.example.com.", dns.TypeDS)] = nil
+	z.records[key2("txt.insecure.example.com.", dns.TypeSOA)] = nil
+	z.add(false, rr(t, "txt.insecure.example.com. 300 IN TXT \"v=spf1 -all\""))
+
+	return z
+}
+
+func rr(t *testing.T, s string) dns.RR {
+	r, err := dns.NewRR(s)
+	assert.Nil(t, err)
+	return r
+}
+
+func key2(name string, qtype uint16) string {
+	return strings.ToLower(name) + "/" + dns.TypeToString[qtype]
+}
+
+func (z *signedZone) sign(r dns.RR) *dns.RRSIG {
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: r.Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: r.Header().Ttl},
+		KeyTag:     z.key.KeyTag(),
+		SignerName: z.key.Hdr.Name,
+		Algorithm:  z.key.Algorithm,
+		Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+	}
+	assert.Nil(z.t, sig.Sign(z.signer, []dns.RR{r}))
+	return sig
+}
+
+func (z *signedZone) add(signed bool, r dns.RR) {
+	k := key2(r.Header().Name, r.Header().Rrtype)
+	z.records[k] = append(z.records[k], r)
+	if signed {
+		z.records[k] = append(z.records[k], z.sign(r))
+	}
+}
+
+func (z *signedZone) trustAnchor() string {
+	return z.key.ToDS(dns.SHA256).String()
+}
+
+func (z *signedZone) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	q := m.Question[0]
+	res := &dns.Msg{}
+	res.SetReply(m)
+
+	records, ok := z.records[key2(q.Name, q.Qtype)]
+	switch {
+	case q.Name == "deleted.example.com." || q.Name == "nx.example.com.":
+		res.Rcode = dns.RcodeNameError
+		res.Ns = append(res.Ns, z.records[key2("example.com.", dns.TypeSOA)]...)
+		res.Ns = append(res.Ns, z.records[key2("example.com.", dns.TypeNSEC)]...)
+	case ok && len(records) > 0:
+		res.Answer = records
+	case q.Qtype == dns.TypeDS && q.Name == "insecure.example.com.":
+		res.Ns = z.records[key2("insecure.example.com.", dns.TypeNSEC)]
+	case q.Qtype == dns.TypeSOA && strings.HasSuffix(q.Name, "insecure.example.com."):
+		res.Ns = []dns.RR{rr(z.t, "insecure.example.com. 300 IN SOA ns.insecure.example.com. admin.example.com. 1 3600 600 86400 300")}
+	default:
+		res.Ns = z.records[key2("example.com.", dns.TypeSOA)]
+	}
+
+	return res, nil
+}
+
+func newValidatingResolver(t *testing.T, z *signedZone) *dnsResolver {
+	d, err := newDNSSEC(DNSSECOptions{Mode: DNSSECValidate, TrustAnchors: []string{z.trustAnchor()}})
+	assert.Nil(t, err)
+
+	return &dnsResolver{addr: "10.0.0.53:53", transport: z, options: QueryOptions{Timeout: time.Second}, dnssec: d}
+}
+
+func TestDNSSECValidate(t *testing.T) {
+	z := newSignedZone(t)
+	r := newValidatingResolver(t, z)
+
+	tests := []struct {
+		name  string
+		state DNSSECState
+	}{
+		{"example.com", DNSSECSecure},
+		{"tampered.example.com", DNSSECBogus},
+		{"unsigned.example.com", DNSSECBogus},
+		{"txt.insecure.example.com", DNSSECInsecure},
+	}
+
+	for _, tt := range tests {
+		ctx, trace := WithTrace(context.Background())
+		_, err := r.LookupTXT(ctx, tt.name)
+		assert.Nil(t, err, tt.name)
+		assert.Equal(t, tt.state, trace.DNSSEC(), tt.name)
+	}
+}
+
+func TestDNSSECValidateDenial(t *testing.T) {
+	z := newSignedZone(t)
+	r := newValidatingResolver(t, z)
+
+	tests := []struct {
+		name  string
+		state DNSSECState
+	}{
+		{"deleted.example.com", DNSSECSecure},
+		// The NSEC record does not cover the name, it could hide a record.
+		{"nx.example.com", DNSSECBogus},
+	}
+
+	for _, tt := range tests {
+		ctx, trace := WithTrace(context.Background())
+		_, err := r.LookupTXT(ctx, tt.name)
+		assert.True(t, isNotFound(err), tt.name)
+		assert.Equal(t, tt.state, trace.DNSSEC(), tt.name)
+	}
+}
+
+func TestDNSSECZoneKeysBound(t *testing.T) {
+	z := newSignedZone(t)
+	r := newValidatingResolver(t, z)
+	v := r.dnssec.validator
+
+	now := time.Now()
+	for i := 0; i < maxZoneKeys; i++ {
+		v.zones[fmt.Sprintf("zone%d.", i)] = zoneKeys{expires: now.Add(time.Duration(i+1) * time.Minute)}
+	}
+
+	_, err := r.LookupTXT(context.Background(), "example.com")
+	assert.Nil(t, err)
+	assert.Len(t, v.zones, maxZoneKeys)
+	assert.Contains(t, v.zones, "example.com.")
+	assert.NotContains(t, v.zones, "zone0.", "the zone expiring first should be evicted")
+}
+
+func TestDNSSECFollowUpLimited(t *testing.T) {
+	z := newSignedZone(t)
+	r := newValidatingResolver(t, z)
+	r.limiter = NewLimiter(1, 1, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// Proving the zone insecure needs more queries than the burst allows.
+	ctx, trace := WithTrace(ctx)
+	_, err := r.LookupTXT(ctx, "txt.insecure.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, DNSSECBogus, trace.DNSSEC())
+}
+
+func TestDNSSECValidateWithoutTrustAnchor(t *testing.T) {
+	z := newSignedZone(t)
+	r := newValidatingResolver(t, z)
+	r.dnssec.validator.anchors = map[string][]*dns.DS{}
+
+	// Without an anchor for the zone there is no chain of trust.
+	ctx, trace := WithTrace(context.Background())
+	_, err := r.LookupTXT(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.NotEqual(t, DNSSECSecure, trace.DNSSEC())
+}
+
+// adTransport answers like a validating resolver: bogus names fail with
+// SERVFAIL unless checking is disabled.
+type adTransport struct {
+	bogus bool
+}
+
+func (a *adTransport) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	res := &dns.Msg{}
+	res.SetReply(m)
+
+	if a.bogus && !m.CheckingDisabled {
+		res.Rcode = dns.RcodeServerFailure
+		return res, nil
+	}
+
+	res.AuthenticatedData = !a.bogus
+	res.Answer = append(res.Answer, &dns.TXT{
+		Hdr: dns.RR_Header{Name: m.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+		Txt: []string{"v=spf1 -all"},
+	})
+	return res, nil
+}
+
+func TestDNSSECAD(t *testing.T) {
+	d, err := newDNSSEC(DNSSECOptions{Mode: DNSSECAD})
+	assert.Nil(t, err)
+
+	for _, bogus := range []bool{false, true} {
+		r := &dnsResolver{addr: "10.0.0.53:53", transport: &adTransport{bogus: bogus}, dnssec: d}
+
+		ctx, trace := WithTrace(context.Background())
+		txts, err := r.LookupTXT(ctx, "example.com")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"v=spf1 -all"}, txts)
+
+		if bogus {
+			assert.Equal(t, DNSSECBogus, trace.DNSSEC())
+		} else {
+			assert.Equal(t, DNSSECSecure, trace.DNSSEC())
+		}
+	}
+}
+
+func TestDNSSECOptions(t *testing.T) {
+	assert.Nil(t, DNSSECOptions{}.Validate())
+	assert.Nil(t, DNSSECOptions{Mode: DNSSECValidate}.Validate())
+	assert.NotNil(t, DNSSECOptions{Mode: "strict"}.Validate())
+	assert.NotNil(t, DNSSECOptions{Mode: DNSSECValidate, TrustAnchors: []string{"example.com. IN TXT \"x\""}}.Validate())
+}
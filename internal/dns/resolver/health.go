@@ -0,0 +1,173 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrUnhealthy is matched by the errors of lookups refused because the
+// resolver failed repeatedly, see HealthOptions.
+var ErrUnhealthy = errors.New("resolver unhealthy")
+
+// UnhealthyError is returned by the lookups of a resolver whose circuit is
+// open.
+type UnhealthyError struct {
+	Server string
+	Until  time.Time
+}
+
+func (e *UnhealthyError) Error() string {
+	return fmt.Sprintf("resolver %s is unhealthy until %s", e.Server, e.Until.Format(time.RFC3339))
+}
+
+func (e *UnhealthyError) Is(target error) bool {
+	return target == ErrUnhealthy
+}
+
+// HealthOptions configures the circuit breaker of the resolvers.
+type HealthOptions struct {
+	// FailureThreshold is the number of consecutive failed queries after
+	// which a resolver is considered unhealthy. Zero disables the breaker.
+	FailureThreshold int
+	// Cooldown is the time an unhealthy resolver is not queried. After it,
+	// a single query probes the resolver, closing the circuit if it
+	// succeeds.
+	Cooldown time.Duration
+}
+
+// breaker is a Resolver refusing the lookups of a resolver that failed
+// repeatedly, until it recovers. Negative answers are not failures.
+type breaker struct {
+	resolver Resolver
+	name     string
+	options  HealthOptions
+	now      func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newBreaker(r Resolver, options HealthOptions) *breaker {
+	b := &breaker{resolver: r, name: Name(r, 0), options: options, now: time.Now}
+	resolverHealthy.WithLabelValues(b.name).Set(1)
+	return b
+}
+
+func (b *breaker) String() string {
+	return b.name
+}
+
+// Healthy reports whether the circuit of the resolver is closed.
+func (b *breaker) Healthy() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.failures < b.options.FailureThreshold
+}
+
+// allow reports whether a query can be sent, or the error to return.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.options.FailureThreshold {
+		return nil
+	}
+
+	if b.probing || b.now().Before(b.openUntil) {
+		return &UnhealthyError{Server: b.name, Until: b.openUntil}
+	}
+
+	b.probing = true
+	return nil
+}
+
+// record updates the health of the resolver with the outcome of a query.
+func (b *breaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	probe := b.probing
+	b.probing = false
+
+	// A query abandoned by the caller says nothing about the resolver.
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+
+	// A lame nameserver answered, the check reports it.
+	var lameErr *LameDelegationError
+	if err == nil || isNotFound(err) || errors.As(err, &lameErr) {
+		b.failures = 0
+		resolverHealthy.WithLabelValues(b.name).Set(1)
+		return
+	}
+
+	resolverFailures.WithLabelValues(b.name).Inc()
+	b.failures++
+	if probe || b.failures == b.options.FailureThreshold {
+		b.openUntil = b.now().Add(b.options.Cooldown)
+		resolverHealthy.WithLabelValues(b.name).Set(0)
+	}
+}
+
+func (b *breaker) LookupCNAME(ctx context.Context, name string) (string, error) {
+	if err := b.allow(); err != nil {
+		return "", err
+	}
+
+	cname, err := b.resolver.LookupCNAME(ctx, name)
+	b.record(ctx, err)
+	return cname, err
+}
+
+func (b *breaker) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+
+	addrs, err := b.resolver.LookupHost(ctx, host)
+	b.record(ctx, err)
+	return addrs, err
+}
+
+func (b *breaker) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+
+	mxs, err := b.resolver.LookupMX(ctx, name)
+	b.record(ctx, err)
+	return mxs, err
+}
+
+func (b *breaker) LookupNS(ctx context.Context, name string) ([]*net.NS, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+
+	nss, err := b.resolver.LookupNS(ctx, name)
+	b.record(ctx, err)
+	return nss, err
+}
+
+func (b *breaker) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+
+	txts, err := b.resolver.LookupTXT(ctx, name)
+	b.record(ctx, err)
+	return txts, err
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
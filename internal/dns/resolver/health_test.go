@@ -0,0 +1,116 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolDropIdle(t *testing.T) {
+	p, err := NewPool("10.0.0.53")
+	assert.Nil(t, err)
+	p.SetHealthOptions(HealthOptions{FailureThreshold: 2, Cooldown: time.Minute})
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+
+	_, err = p.Resolvers("10.0.0.54")
+	assert.Nil(t, err)
+	_, err = p.Resolvers()
+	assert.Nil(t, err)
+	assert.Len(t, p.breakers, 2)
+
+	now = now.Add(poolIdleTimeout)
+	_, err = p.Resolvers("10.0.0.55")
+	assert.Nil(t, err)
+	assert.Contains(t, p.resolvers, "10.0.0.53:53", "the defaults should be kept")
+	assert.NotContains(t, p.resolvers, "10.0.0.54:53")
+	assert.NotContains(t, p.breakers, "10.0.0.54:53")
+	assert.Len(t, p.lastUsed, 2)
+}
+
+func TestPoolBreakerInsideLimiter(t *testing.T) {
+	p, err := NewPool("10.0.0.53")
+	assert.Nil(t, err)
+	p.SetHealthOptions(HealthOptions{FailureThreshold: 1, Cooldown: time.Minute})
+	p.SetLimiter(NewLimiter(1, 1, 0))
+
+	resolvers, err := p.Resolvers()
+	assert.Nil(t, err)
+	limited, ok := resolvers[0].(*limitedResolver)
+	assert.True(t, ok)
+	assert.IsType(t, &breaker{}, limited.resolver)
+
+	// A throttled query is not a failure of the resolver.
+	b := newBreaker(&countingResolver{}, HealthOptions{FailureThreshold: 1, Cooldown: time.Minute})
+	r := NewLimiter(1, 1, 0).Wrap(b)
+	_, err = r.LookupTXT(context.Background(), "example.com")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = r.LookupTXT(ctx, "example.com")
+	assert.NotNil(t, err)
+	assert.True(t, b.Healthy())
+}
+
+func TestBreaker(t *testing.T) {
+	r := &countingResolver{err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}
+	b := newBreaker(r, HealthOptions{FailureThreshold: 2, Cooldown: time.Minute})
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := b.LookupTXT(ctx, "example.com")
+		assert.False(t, errors.Is(err, ErrUnhealthy))
+	}
+	assert.False(t, b.Healthy())
+
+	_, err := b.LookupTXT(ctx, "example.com")
+	assert.ErrorIs(t, err, ErrUnhealthy)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&r.queries))
+
+	// A failed probe opens the circuit again.
+	now = now.Add(time.Minute)
+	_, err = b.LookupTXT(ctx, "example.com")
+	assert.False(t, errors.Is(err, ErrUnhealthy))
+	_, err = b.LookupTXT(ctx, "example.com")
+	assert.ErrorIs(t, err, ErrUnhealthy)
+
+	// A successful probe closes it.
+	now = now.Add(time.Minute)
+	r.err = nil
+	_, err = b.LookupTXT(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.True(t, b.Healthy())
+}
+
+func TestBreakerNegativeAnswers(t *testing.T) {
+	r := &countingResolver{err: &net.DNSError{Err: "no such host", IsNotFound: true}}
+	b := newBreaker(r, HealthOptions{FailureThreshold: 1, Cooldown: time.Minute})
+
+	_, _ = b.LookupTXT(context.Background(), "example.com")
+	_, _ = b.LookupTXT(context.Background(), "example.com")
+	assert.True(t, b.Healthy())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&r.queries))
+}
+
+func TestPoolCheck(t *testing.T) {
+	p, err := NewPool("10.0.0.53")
+	assert.Nil(t, err)
+	p.SetHealthOptions(HealthOptions{FailureThreshold: 1, Cooldown: time.Minute})
+
+	assert.Nil(t, p.Check(nil))
+
+	_, err = p.Resolvers()
+	assert.Nil(t, err)
+	assert.Nil(t, p.Check(nil))
+
+	p.breakers["10.0.0.53:53"].record(context.Background(), errors.New("connection refused"))
+	assert.NotNil(t, p.Check(nil))
+}
@@ -0,0 +1,185 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// Limiter bounds the queries sent by the resolvers it wraps: each resolver
+// has its own token bucket, and the queries in flight across all of them are
+// capped. It is safe for concurrent use.
+type Limiter struct {
+	qps   rate.Limit
+	burst int
+
+	// inFlight is a semaphore holding a token per query in flight, nil when
+	// the queries are not capped.
+	inFlight chan struct{}
+
+	mu      sync.Mutex
+	buckets map[string]*rate.Limiter
+}
+
+// NewLimiter returns a Limiter allowing qps queries per second to each
+// resolver, with bursts of burst queries, and maxInFlight queries in flight
+// overall. A zero qps or maxInFlight disables the respective limit.
+func NewLimiter(qps float64, burst, maxInFlight int) *Limiter {
+	l := &Limiter{
+		qps:     rate.Limit(qps),
+		burst:   burst,
+		buckets: map[string]*rate.Limiter{},
+	}
+
+	if l.burst < 1 {
+		l.burst = 1
+	}
+
+	if maxInFlight > 0 {
+		l.inFlight = make(chan struct{}, maxInFlight)
+	}
+
+	return l
+}
+
+// Wrap returns a resolver sending the queries of r within the limits. The
+// resolvers wrapped for the same name share the same token bucket.
+func (l *Limiter) Wrap(r Resolver) Resolver {
+	name := Name(r, 0)
+	return &limitedResolver{resolver: r, name: name, limiter: l, bucket: l.bucket(name)}
+}
+
+func (l *Limiter) bucket(name string) *rate.Limiter {
+	if l.qps <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[name]
+	if !ok {
+		b = rate.NewLimiter(l.qps, l.burst)
+		l.buckets[name] = b
+	}
+
+	return b
+}
+
+// wait waits until the rate limit of the resolver name allows a query,
+// without taking a query in flight.
+func (l *Limiter) wait(ctx context.Context, name string) error {
+	bucket := l.bucket(name)
+	if bucket == nil || bucket.Allow() {
+		return nil
+	}
+
+	throttledQueries.WithLabelValues(name, throttledRate).Inc()
+	return bucket.Wait(ctx)
+}
+
+// acquire waits until a query to the resolver name can be sent, and returns
+// the function to call once it is done.
+func (l *Limiter) acquire(ctx context.Context, name string, bucket *rate.Limiter) (func(), error) {
+	if bucket != nil && !bucket.Allow() {
+		throttledQueries.WithLabelValues(name, throttledRate).Inc()
+		if err := bucket.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+		default:
+			throttledQueries.WithLabelValues(name, throttledInFlight).Inc()
+			select {
+			case l.inFlight <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	queriesInFlight.Inc()
+	return func() {
+		queriesInFlight.Dec()
+		if l.inFlight != nil {
+			<-l.inFlight
+		}
+	}, nil
+}
+
+type limitedResolver struct {
+	resolver Resolver
+	name     string
+	limiter  *Limiter
+	bucket   *rate.Limiter
+}
+
+func (r *limitedResolver) String() string {
+	return r.name
+}
+
+// throttleErr reports a query that could not be sent before ctx expired
+// like the lookup errors of the resolvers.
+func (r *limitedResolver) throttleErr(name string, err error) error {
+	return &net.DNSError{
+		Err:       "rate limited: " + err.Error(),
+		Name:      name,
+		Server:    r.name,
+		IsTimeout: true,
+	}
+}
+
+func (r *limitedResolver) LookupCNAME(ctx context.Context, name string) (string, error) {
+	release, err := r.limiter.acquire(ctx, r.name, r.bucket)
+	if err != nil {
+		return "", r.throttleErr(name, err)
+	}
+	defer release()
+
+	return r.resolver.LookupCNAME(ctx, name)
+}
+
+func (r *limitedResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	release, err := r.limiter.acquire(ctx, r.name, r.bucket)
+	if err != nil {
+		return nil, r.throttleErr(host, err)
+	}
+	defer release()
+
+	return r.resolver.LookupHost(ctx, host)
+}
+
+func (r *limitedResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	release, err := r.limiter.acquire(ctx, r.name, r.bucket)
+	if err != nil {
+		return nil, r.throttleErr(name, err)
+	}
+	defer release()
+
+	return r.resolver.LookupMX(ctx, name)
+}
+
+func (r *limitedResolver) LookupNS(ctx context.Context, name string) ([]*net.NS, error) {
+	release, err := r.limiter.acquire(ctx, r.name, r.bucket)
+	if err != nil {
+		return nil, r.throttleErr(name, err)
+	}
+	defer release()
+
+	return r.resolver.LookupNS(ctx, name)
+}
+
+func (r *limitedResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	release, err := r.limiter.acquire(ctx, r.name, r.bucket)
+	if err != nil {
+		return nil, r.throttleErr(name, err)
+	}
+	defer release()
+
+	return r.resolver.LookupTXT(ctx, name)
+}
@@ -0,0 +1,76 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterRate(t *testing.T) {
+	l := NewLimiter(1, 1, 0)
+	r := l.Wrap(&countingResolver{})
+
+	throttled := testutil.ToFloat64(throttledQueries.WithLabelValues("counting", throttledRate))
+
+	_, err := r.LookupTXT(context.Background(), "example.com")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = r.LookupTXT(ctx, "example.com")
+	var dnsErr *net.DNSError
+	assert.ErrorAs(t, err, &dnsErr)
+	assert.True(t, dnsErr.IsTimeout)
+	assert.Equal(t, throttled+1, testutil.ToFloat64(throttledQueries.WithLabelValues("counting", throttledRate)))
+}
+
+func TestLimiterSharedBucket(t *testing.T) {
+	l := NewLimiter(1, 1, 0)
+	first := l.Wrap(&countingResolver{})
+	second := l.Wrap(&countingResolver{})
+
+	_, err := first.LookupTXT(context.Background(), "example.com")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = second.LookupTXT(ctx, "example.com")
+	assert.NotNil(t, err, "resolvers with the same name should share the bucket")
+}
+
+func TestLimiterInFlight(t *testing.T) {
+	l := NewLimiter(0, 0, 1)
+	blocked := &countingResolver{block: make(chan struct{})}
+	r := l.Wrap(blocked)
+
+	throttled := testutil.ToFloat64(throttledQueries.WithLabelValues("counting", throttledInFlight))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := r.LookupTXT(context.Background(), "example.com")
+		assert.Nil(t, err)
+	}()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&blocked.queries) == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := r.LookupTXT(ctx, "example.com")
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&blocked.queries))
+	assert.Equal(t, throttled+1, testutil.ToFloat64(throttledQueries.WithLabelValues("counting", throttledInFlight)))
+
+	close(blocked.block)
+	<-done
+
+	_, err = r.LookupTXT(context.Background(), "example.com")
+	assert.Nil(t, err)
+}
@@ -0,0 +1,69 @@
+package resolver
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons a query was throttled, reported in the throttled queries metric.
+const (
+	throttledRate     = "rate"
+	throttledInFlight = "in_flight"
+)
+
+// Results of a query attempt, reported in the query duration metric.
+const (
+	queryOK       = "ok"
+	queryServFail = "servfail"
+	queryError    = "error"
+)
+
+var (
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8nnon_dns_cache_lookups_total",
+		Help: "Number of DNS lookups served by the resolver caches, by resolver and result (hit, miss or bypass).",
+	}, []string{"resolver", "result"})
+
+	throttledQueries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8nnon_dns_throttled_queries_total",
+		Help: "Number of DNS queries delayed by the rate limiter, by resolver and reason (rate or in_flight).",
+	}, []string{"resolver", "reason"})
+
+	queriesInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "k8nnon_dns_queries_in_flight",
+		Help: "Number of DNS queries being sent by the resolvers.",
+	})
+
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "k8nnon_dns_query_duration_seconds",
+		Help:    "Duration of each DNS query attempt sent to a resolver, by resolver and result (ok, servfail or error). Cached answers are not sent.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"resolver", "result"})
+
+	queryRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8nnon_dns_query_retries_total",
+		Help: "Number of DNS queries sent again after a transport error or a SERVFAIL answer, by resolver.",
+	}, []string{"resolver"})
+
+	resolverFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8nnon_dns_resolver_failures_total",
+		Help: "Number of failed DNS lookups counted by the resolver circuit breakers, by resolver.",
+	}, []string{"resolver"})
+
+	resolverHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "k8nnon_dns_resolver_healthy",
+		Help: "Whether the circuit breaker of a resolver is closed (1) or open (0).",
+	}, []string{"resolver"})
+)
+
+// RegisterMetrics registers the metrics of the package with reg.
+func RegisterMetrics(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		cacheLookups, throttledQueries, queriesInFlight, queryDuration, queryRetries, resolverFailures, resolverHealthy,
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
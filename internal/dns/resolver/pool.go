@@ -0,0 +1,388 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the resolver configuration loaded from a file or ConfigMap.
+type Config struct {
+	// Resolvers is the list of default resolver addresses.
+	Resolvers []string `json:"resolvers"`
+}
+
+// ParseConfig parses a YAML or JSON resolver configuration and validates
+// its addresses.
+func ParseConfig(data []byte) (Config, error) {
+	config := Config{}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return config, err
+	}
+
+	if len(config.Resolvers) == 0 {
+		return config, fmt.Errorf("no resolvers configured")
+	}
+
+	addresses, err := ParseAddresses(config.Resolvers)
+	if err != nil {
+		return config, err
+	}
+	config.Resolvers = addresses
+
+	return config, nil
+}
+
+// LoadConfig reads a resolver configuration file, see ParseConfig.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return ParseConfig(data)
+}
+
+// SplitAddresses splits a comma separated list of addresses.
+func SplitAddresses(s string) []string {
+	var addresses []string
+	for _, addr := range strings.Split(s, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addresses = append(addresses, addr)
+		}
+	}
+
+	return addresses
+}
+
+// poolIdleTimeout is how long the resolver of an address is kept once it is
+// no longer used, longer than the interval between two checks of a domain.
+const poolIdleTimeout = 3 * time.Hour
+
+// Pool builds resolvers by address, reusing the same resolver for an
+// address across calls, and holds the default resolver addresses, which can
+// be replaced at runtime. It is safe for concurrent use.
+type Pool struct {
+	mu        sync.RWMutex
+	resolvers map[string]Resolver
+	defaults  []string
+
+	// lastUsed is when the resolver of each address was last returned,
+	// the resolvers idle for poolIdleTimeout are dropped.
+	lastUsed map[string]time.Time
+	now      func() time.Time
+
+	// allowed is the set of addresses that can be requested besides the
+	// defaults, nil when any address can be.
+	allowed map[string]bool
+
+	// cacheTTL is the maximum TTL of the resolver caches, zero when the
+	// answers are not cached.
+	cacheTTL time.Duration
+
+	// limiter bounds the queries of the resolvers, if set.
+	limiter *Limiter
+
+	queryOptions  QueryOptions
+	healthOptions HealthOptions
+
+	// breakers holds the circuit breakers of the resolvers by address.
+	breakers map[string]*breaker
+}
+
+// NewPool returns a pool using addresses as the default resolvers.
+func NewPool(addresses ...string) (*Pool, error) {
+	p := &Pool{
+		resolvers:    map[string]Resolver{},
+		lastUsed:     map[string]time.Time{},
+		now:          time.Now,
+		queryOptions: DefaultQueryOptions,
+		breakers:     map[string]*breaker{},
+	}
+	if err := p.SetDefaults(addresses); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// EnableCache puts a Cache in front of the resolvers of the pool, caching
+// answers for at most maxTTL. The resolvers, and so their caches, are shared
+// by every user of the pool. It must be called before the pool is used.
+func (p *Pool) EnableCache(maxTTL time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.cacheTTL = maxTTL
+}
+
+// SetLimiter makes the resolvers of the pool send their queries within the
+// limits of l. Answers served from the cache are not limited. It must be
+// called before the pool is used.
+func (p *Pool) SetLimiter(l *Limiter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.limiter = l
+}
+
+// SetQueryOptions sets the options of the queries sent by the resolvers of
+// the pool. It must be called before the pool is used.
+func (p *Pool) SetQueryOptions(options QueryOptions) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.queryOptions = options
+}
+
+// SetHealthOptions puts a circuit breaker in front of the resolvers of the
+// pool: a resolver failing repeatedly is not queried for a while, and its
+// lookups fail with ErrUnhealthy. It must be called before the pool is used.
+func (p *Pool) SetHealthOptions(options HealthOptions) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.healthOptions = options
+}
+
+// RestrictResolvers only lets Resolvers return the default resolvers and
+// the ones of allowed, so that the users of the pool cannot make it query
+// any host. It must be called before the pool is used.
+func (p *Pool) RestrictResolvers(allowed []string) error {
+	parsed, err := ParseAddresses(allowed)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.allowed = map[string]bool{}
+	for _, addr := range parsed {
+		p.allowed[addr] = true
+	}
+
+	return nil
+}
+
+// Check reports an error when all the default resolvers are unhealthy. It
+// can be used as a readiness check.
+func (p *Pool) Check(_ *http.Request) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.breakers) == 0 {
+		return nil
+	}
+
+	for _, addr := range p.defaults {
+		b, ok := p.breakers[addr]
+		if !ok || b.Healthy() {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("all the default resolvers are unhealthy")
+}
+
+// SetDefaults validates and replaces the default resolver addresses.
+func (p *Pool) SetDefaults(addresses []string) error {
+	if len(addresses) == 0 {
+		return fmt.Errorf("no resolvers configured")
+	}
+
+	parsed, err := ParseAddresses(addresses)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.defaults = parsed
+
+	return nil
+}
+
+// Defaults returns the default resolver addresses.
+func (p *Pool) Defaults() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return append([]string(nil), p.defaults...)
+}
+
+// Resolvers returns the resolvers of addresses, or the default resolvers
+// when addresses is empty.
+func (p *Pool) Resolvers(addresses ...string) ([]Resolver, error) {
+	if len(addresses) == 0 {
+		addresses = p.Defaults()
+	}
+
+	parsed, err := ParseAddresses(addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.checkAllowed(parsed); err != nil {
+		return nil, err
+	}
+
+	now := p.now()
+	p.dropIdle(now)
+
+	resolvers := make([]Resolver, 0, len(parsed))
+	for _, addr := range parsed {
+		p.lastUsed[addr] = now
+
+		r, ok := p.resolvers[addr]
+		if !ok {
+			base, err := newResolver(addr, p.queryOptions)
+			if err != nil {
+				return nil, err
+			}
+			base.limiter = p.limiter
+			r = p.wrap(addr, base)
+		}
+		resolvers = append(resolvers, r)
+	}
+
+	return resolvers, nil
+}
+
+// Nameserver returns a resolver sending non-recursive queries to the
+// authoritative nameserver at addr, like NewAuthoritativeResolver, with the
+// query options, limits, breaker and cache of the pool. Nameservers are
+// found in the DNS, so they are not restricted by RestrictResolvers, but
+// they must have a public address: a zone could otherwise make the operator
+// query the services of its own network.
+func (p *Pool) Nameserver(addr string) (Resolver, error) {
+	parsed, err := ParseAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPublicAddress(parsed); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	p.dropIdle(now)
+
+	// Recursive and authoritative queries to the same address get
+	// different answers, they are not shared.
+	key := "authoritative:" + parsed
+	p.lastUsed[key] = now
+
+	if r, ok := p.resolvers[key]; ok {
+		return r, nil
+	}
+
+	base, err := newResolver(parsed, p.queryOptions)
+	if err != nil {
+		return nil, err
+	}
+	base.authoritative = true
+	base.limiter = p.limiter
+
+	return p.wrap(key, base), nil
+}
+
+// wrap puts the breaker, limiter and cache of the pool in front of r and
+// stores it under key. It must be called with the lock held.
+func (p *Pool) wrap(key string, r Resolver) Resolver {
+	// The breaker is inside the limiter so that queries throttled by the
+	// limiter do not count as failures of the resolver.
+	if p.healthOptions.FailureThreshold > 0 {
+		b := newBreaker(r, p.healthOptions)
+		p.breakers[key] = b
+		r = b
+	}
+	if p.limiter != nil {
+		r = p.limiter.Wrap(r)
+	}
+	if p.cacheTTL > 0 {
+		r = NewCache(r, p.cacheTTL)
+	}
+
+	p.resolvers[key] = r
+	return r
+}
+
+func (p *Pool) checkAllowed(addresses []string) error {
+	if p.allowed == nil {
+		return nil
+	}
+
+	for _, addr := range addresses {
+		if !p.allowed[addr] && !containsString(p.defaults, addr) {
+			return fmt.Errorf("resolver %s is not allowed", addr)
+		}
+	}
+
+	return nil
+}
+
+// dropIdle forgets the resolvers, and their breakers, that have not been
+// used for poolIdleTimeout, e.g. the ones of a deleted domain. The default
+// resolvers are kept for the readiness check.
+func (p *Pool) dropIdle(now time.Time) {
+	for addr, used := range p.lastUsed {
+		if now.Sub(used) < poolIdleTimeout || containsString(p.defaults, addr) {
+			continue
+		}
+
+		delete(p.lastUsed, addr)
+		delete(p.resolvers, addr)
+		delete(p.breakers, addr)
+	}
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, often used
+// by cluster networks.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// checkPublicAddress refuses the canonical addresses that are not a public
+// IP address queried over UDP.
+func checkPublicAddress(addr string) error {
+	scheme, target := splitAddress(addr)
+	if scheme != SchemeUDP {
+		return fmt.Errorf("invalid nameserver address %q: nameservers are queried over udp", addr)
+	}
+
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		return fmt.Errorf("invalid nameserver address %q: %w", addr, err)
+	}
+
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return fmt.Errorf("invalid nameserver address %q: not an IP address", addr)
+	case ip.IsUnspecified(), ip.IsLoopback(), ip.IsPrivate(), ip.IsLinkLocalUnicast(),
+		ip.IsMulticast(), sharedAddressSpace.Contains(ip):
+		return fmt.Errorf("refusing to query nameserver %s, its address is not public", host)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package resolver_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kannon-email/k8nnon/internal/dns/resolver"
+)
+
+func TestPool(t *testing.T) {
+	p, err := resolver.NewPool("8.8.8.8", "1.1.1.1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"8.8.8.8:53", "1.1.1.1:53"}, p.Defaults())
+
+	defaults, err := p.Resolvers()
+	assert.Nil(t, err)
+	assert.Len(t, defaults, 2)
+	assert.Equal(t, "8.8.8.8:53", resolver.Name(defaults[0], 0))
+
+	override, err := p.Resolvers("8.8.8.8:53")
+	assert.Nil(t, err)
+	assert.Len(t, override, 1)
+	assert.Same(t, defaults[0], override[0], "resolvers should be reused across calls")
+
+	_, err = p.Resolvers("not a resolver")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, p.SetDefaults([]string{"10.0.0.53"}))
+	assert.Equal(t, []string{"10.0.0.53:53"}, p.Defaults())
+
+	assert.NotNil(t, p.SetDefaults([]string{"10.0.0.53:0"}))
+	assert.NotNil(t, p.SetDefaults(nil))
+	assert.Equal(t, []string{"10.0.0.53:53"}, p.Defaults(), "invalid defaults should not be applied")
+}
+
+func TestPoolRestrictResolvers(t *testing.T) {
+	p, err := resolver.NewPool("8.8.8.8")
+	assert.Nil(t, err)
+	assert.Nil(t, p.RestrictResolvers([]string{"tls://1.1.1.1"}))
+
+	_, err = p.Resolvers("8.8.8.8", "tls://1.1.1.1")
+	assert.Nil(t, err, "the defaults and the allowed resolvers can be used")
+
+	_, err = p.Resolvers("10.0.0.53")
+	assert.NotNil(t, err)
+	_, err = p.Resolvers("https://dns.example/dns-query")
+	assert.NotNil(t, err)
+
+	assert.NotNil(t, p.RestrictResolvers([]string{"10.0.0.53:0"}))
+}
+
+func TestPoolNameserver(t *testing.T) {
+	p, err := resolver.NewPool("10.0.0.53")
+	assert.Nil(t, err)
+	assert.Nil(t, p.RestrictResolvers(nil))
+	p.EnableCache(time.Minute)
+
+	ns, err := p.Nameserver("192.0.2.53")
+	assert.Nil(t, err, "nameservers should not be restricted")
+	assert.IsType(t, &resolver.Cache{}, ns)
+	assert.Equal(t, "192.0.2.53:53", resolver.Name(ns, 0))
+
+	again, err := p.Nameserver("192.0.2.53:53")
+	assert.Nil(t, err)
+	assert.Same(t, ns, again)
+
+	p, err = resolver.NewPool("192.0.2.10")
+	assert.Nil(t, err)
+	recursive, err := p.Resolvers()
+	assert.Nil(t, err)
+	ns, err = p.Nameserver("192.0.2.10")
+	assert.Nil(t, err)
+	assert.NotSame(t, recursive[0], ns, "authoritative queries should not share the recursive resolver")
+}
+
+func TestPoolNameserverNotPublic(t *testing.T) {
+	p, err := resolver.NewPool("8.8.8.8")
+	assert.Nil(t, err)
+
+	for _, addr := range []string{
+		"127.0.0.1", "[::1]:53", "10.0.0.53", "172.16.0.10", "192.168.1.1", "169.254.169.254",
+		"[fe80::1]:53", "0.0.0.0", "100.64.0.10", "[fd00::53]:53", "tcp://192.0.2.53", "ns.example.com",
+	} {
+		_, err := p.Nameserver(addr)
+		assert.NotNil(t, err, addr)
+	}
+}
+
+func TestPoolCache(t *testing.T) {
+	p, err := resolver.NewPool("8.8.8.8")
+	assert.Nil(t, err)
+	p.EnableCache(time.Minute)
+
+	resolvers, err := p.Resolvers()
+	assert.Nil(t, err)
+	assert.IsType(t, &resolver.Cache{}, resolvers[0])
+	assert.Equal(t, "8.8.8.8:53", resolver.Name(resolvers[0], 0))
+}
+
+func TestParseConfig(t *testing.T) {
+	config, err := resolver.ParseConfig([]byte("resolvers:\n- 10.0.0.53\n- '[fd00::53]:5353'\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.53:53", "[fd00::53]:5353"}, config.Resolvers)
+
+	_, err = resolver.ParseConfig([]byte("resolvers: []\n"))
+	assert.NotNil(t, err)
+
+	_, err = resolver.ParseConfig([]byte("resolver:\n- 10.0.0.53\n"))
+	assert.NotNil(t, err, "unknown fields should be rejected")
+}
+
+func TestSplitAddresses(t *testing.T) {
+	assert.Equal(t, []string{"8.8.8.8", "1.1.1.1:53"}, resolver.SplitAddresses(" 8.8.8.8, ,1.1.1.1:53,"))
+	assert.Nil(t, resolver.SplitAddresses(""))
+}
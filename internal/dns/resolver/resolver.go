@@ -2,39 +2,335 @@ package resolver
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
-	"time"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
 )
 
 type Resolver interface {
 	// LookupAddr(addr string) (names []string, err error)
 	LookupCNAME(ctx context.Context, name string) (cname string, err error)
-	// LookupHost(host string) (addrs []string, err error)
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
 	// LookupIP(host string) (ips []net.IP, err error)
-	// LookupMX(name string) (mxs []*net.MX, err error)
-	// LookupNS(name string) (nss []*net.NS, err error)
+	LookupMX(ctx context.Context, name string) (mxs []*net.MX, err error)
+	LookupNS(ctx context.Context, name string) (nss []*net.NS, err error)
 	// LookupPort(network, service string) (port int, err error)
 	// LookupSRV(service, proto, name string) (cname string, addrs []*net.SRV, err error)
 	LookupTXT(ctx context.Context, name string) (txts []string, err error)
 }
 
-func NewResolvers(address ...string) []Resolver {
-	resolvers := make([]Resolver, 0, len(address))
-	for _, addr := range address {
-		resolvers = append(resolvers, newResolver(addr))
+// udpBufferSize is the EDNS0 UDP buffer size advertised in queries, as
+// recommended by the DNS flag day 2020.
+const udpBufferSize = 1232
+
+// NewResolvers returns a resolver for each address, see ParseAddress for the
+// accepted formats.
+func NewResolvers(address ...string) ([]Resolver, error) {
+	parsed, err := ParseAddresses(address)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]Resolver, 0, len(parsed))
+	for _, addr := range parsed {
+		r, err := newResolver(addr, DefaultQueryOptions)
+		if err != nil {
+			return nil, err
+		}
+		resolvers = append(resolvers, r)
+	}
+
+	return resolvers, nil
+}
+
+// Name returns a human readable name of r, falling back to index when r
+// does not implement fmt.Stringer.
+func Name(r Resolver, index int) string {
+	if s, ok := r.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	return fmt.Sprintf("resolver-%d", index)
+}
+
+// NewAuthoritativeResolver returns a resolver sending non-recursive queries
+// to the authoritative nameserver at addr, see ParseAddress. Answers without
+// the authoritative flag are reported as LameDelegationError.
+func NewAuthoritativeResolver(addr string) (Resolver, error) {
+	parsed, err := ParseAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := newResolver(parsed, DefaultQueryOptions)
+	if err != nil {
+		return nil, err
+	}
+	r.authoritative = true
+
+	return r, nil
+}
+
+// LameDelegationError is returned by authoritative resolvers when the
+// nameserver does not answer authoritatively for the queried name.
+type LameDelegationError struct {
+	Server string
+	Name   string
+}
+
+func (e *LameDelegationError) Error() string {
+	return fmt.Sprintf("lame delegation: %s is not authoritative for %s", e.Server, e.Name)
+}
+
+// dnsResolver implements Resolver on top of a Transport. Errors are
+// reported as *net.DNSError, like the ones of net.Resolver.
+type dnsResolver struct {
+	addr      string
+	transport Transport
+	options   QueryOptions
+
+	// dnssec validates the answers, nil when DNSSEC is off.
+	dnssec *dnssec
+
+	// authoritative disables recursion and requires authoritative answers.
+	authoritative bool
+
+	// limiter bounds the follow up queries, if set. The lookups themselves
+	// are bounded by the limitedResolver in front of the resolver.
+	limiter *Limiter
+}
+
+func newResolver(addr string, options QueryOptions) (*dnsResolver, error) {
+	transport, err := newTransport(addr, options.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := newDNSSEC(options.DNSSEC)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dnsResolver{addr: addr, transport: transport, options: options, dnssec: d}, nil
+}
+
+func (r *dnsResolver) String() string {
+	return r.addr
+}
+
+func (r *dnsResolver) LookupCNAME(ctx context.Context, name string) (string, error) {
+	answer, err := r.lookup(ctx, name, dns.TypeCNAME)
+	if err != nil {
+		return "", err
+	}
+
+	for _, rr := range answer {
+		if cname, ok := rr.(*dns.CNAME); ok {
+			return cname.Target, nil
+		}
 	}
 
-	return resolvers
+	return "", r.notFound(name)
 }
 
-func newResolver(addr string) Resolver {
-	return &net.Resolver{
-		PreferGo: true,
-		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-			d := net.Dialer{
-				Timeout: time.Millisecond * time.Duration(10000),
+func (r *dnsResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	var addrs []string
+	var lookupErr error
+
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		answer, err := r.lookup(ctx, host, qtype)
+		if err != nil {
+			lookupErr = err
+			continue
+		}
+
+		for _, rr := range answer {
+			switch rr := rr.(type) {
+			case *dns.A:
+				addrs = append(addrs, rr.A.String())
+			case *dns.AAAA:
+				addrs = append(addrs, rr.AAAA.String())
 			}
-			return d.DialContext(ctx, "udp", addr+":53")
-		},
+		}
+	}
+
+	if len(addrs) == 0 {
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		return nil, r.notFound(host)
+	}
+
+	return addrs, nil
+}
+
+func (r *dnsResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	answer, err := r.lookup(ctx, name, dns.TypeMX)
+	if err != nil {
+		return nil, err
+	}
+
+	var mxs []*net.MX
+	for _, rr := range answer {
+		if mx, ok := rr.(*dns.MX); ok {
+			mxs = append(mxs, &net.MX{Host: mx.Mx, Pref: mx.Preference})
+		}
+	}
+
+	if len(mxs) == 0 {
+		return nil, r.notFound(name)
+	}
+
+	sort.SliceStable(mxs, func(i, j int) bool {
+		return mxs[i].Pref < mxs[j].Pref
+	})
+
+	return mxs, nil
+}
+
+func (r *dnsResolver) LookupNS(ctx context.Context, name string) ([]*net.NS, error) {
+	answer, err := r.lookup(ctx, name, dns.TypeNS)
+	if err != nil {
+		return nil, err
+	}
+
+	var nss []*net.NS
+	for _, rr := range answer {
+		if ns, ok := rr.(*dns.NS); ok {
+			nss = append(nss, &net.NS{Host: ns.Ns})
+		}
+	}
+
+	if len(nss) == 0 {
+		return nil, r.notFound(name)
+	}
+
+	return nss, nil
+}
+
+func (r *dnsResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	answer, err := r.lookup(ctx, name, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+
+	var txts []string
+	for _, rr := range answer {
+		if txt, ok := rr.(*dns.TXT); ok {
+			// Like net.Resolver, the character strings of a record are
+			// joined (RFC 7208 3.3).
+			txts = append(txts, strings.Join(txt.Txt, ""))
+		}
+	}
+
+	if len(txts) == 0 {
+		return nil, r.notFound(name)
+	}
+
+	return txts, nil
+}
+
+// query sends a query for name and qtype, requesting DNSSEC records when
+// DNSSEC is on.
+func (r *dnsResolver) query(ctx context.Context, name string, qtype uint16, checkingDisabled bool) (*dns.Msg, error) {
+	m := &dns.Msg{}
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.RecursionDesired = !r.authoritative
+	m.SetEdns0(udpBufferSize, r.dnssec != nil)
+	if r.dnssec != nil {
+		m.AuthenticatedData = true
+		m.CheckingDisabled = checkingDisabled
+	}
+
+	return r.exchange(ctx, m)
+}
+
+// followUp sends a query made on behalf of a lookup, like the queries of
+// the DNSSEC chain of trust, with checking disabled. It waits for the rate
+// limit of the resolver, the lookup already holds a query in flight.
+func (r *dnsResolver) followUp(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	if r.limiter != nil {
+		if err := r.limiter.wait(ctx, r.addr); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.query(ctx, name, qtype, true)
+}
+
+// lookup queries name and returns the records of the answer section.
+func (r *dnsResolver) lookup(ctx context.Context, name string, qtype uint16) ([]dns.RR, error) {
+	res, err := r.query(ctx, name, qtype, r.dnssec != nil && r.dnssec.checkingDisabled())
+	if err != nil {
+		var netErr net.Error
+		return nil, &net.DNSError{
+			Err:       err.Error(),
+			Name:      name,
+			Server:    r.addr,
+			IsTimeout: errors.As(err, &netErr) && netErr.Timeout() || errors.Is(err, context.DeadlineExceeded),
+		}
+	}
+
+	if r.authoritative && !res.Authoritative {
+		return nil, &LameDelegationError{Server: r.addr, Name: name}
+	}
+
+	if r.dnssec != nil {
+		res = r.dnssec.check(ctx, r, name, qtype, res)
+	}
+
+	switch res.Rcode {
+	case dns.RcodeSuccess:
+		observeTTL(ctx, res, qtype)
+		return res.Answer, nil
+	case dns.RcodeNameError:
+		observeTTL(ctx, res, qtype)
+		return nil, r.notFound(name)
+	default:
+		return nil, &net.DNSError{
+			Err:         fmt.Sprintf("server misbehaving: %s", dns.RcodeToString[res.Rcode]),
+			Name:        name,
+			Server:      r.addr,
+			IsTemporary: res.Rcode == dns.RcodeServerFailure,
+		}
+	}
+}
+
+// observeTTL records in the trace of ctx the TTL of the records answering
+// the query, or the negative caching TTL when there are none.
+func observeTTL(ctx context.Context, res *dns.Msg, qtype uint16) {
+	found := false
+	for _, rr := range res.Answer {
+		if rr.Header().Rrtype == qtype {
+			ObserveTTL(ctx, rr.Header().Ttl)
+			found = true
+		}
+	}
+
+	if found {
+		return
+	}
+
+	for _, rr := range res.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			ttl := soa.Hdr.Ttl
+			if soa.Minttl < ttl {
+				ttl = soa.Minttl
+			}
+			ObserveTTL(ctx, ttl)
+		}
+	}
+}
+
+func (r *dnsResolver) notFound(name string) error {
+	return &net.DNSError{
+		Err:        "no such host",
+		Name:       name,
+		Server:     r.addr,
+		IsNotFound: true,
 	}
 }
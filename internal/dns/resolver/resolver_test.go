@@ -0,0 +1,130 @@
+package resolver_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	mockdns "github.com/foxcpp/go-mockdns"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kannon-email/k8nnon/internal/dns/resolver"
+)
+
+func createContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestResolverLookups(t *testing.T) {
+	ctx := createContext(t)
+
+	srv, err := mockdns.NewServerWithLogger(map[string]mockdns.Zone{
+		"example.com.": {
+			A:    []string{"192.0.2.1"},
+			AAAA: []string{"2001:db8::1"},
+			TXT:  []string{"v=spf1 -all"},
+			MX: []net.MX{
+				{Host: "mx2.example.com.", Pref: 20},
+				{Host: "mx1.example.com.", Pref: 10},
+			},
+		},
+		"stats.example.com.": {
+			CNAME: "mx.example.com.",
+		},
+		"mx.example.com.": {
+			A: []string{"192.0.2.2"},
+		},
+	}, log.New(io.Discard, "", 0), false)
+	assert.Nil(t, err)
+	defer srv.Close()
+
+	resolvers, err := resolver.NewResolvers(srv.LocalAddr().String())
+	assert.Nil(t, err)
+	r := resolvers[0]
+
+	traceCtx, trace := resolver.WithTrace(ctx)
+	txts, err := r.LookupTXT(traceCtx, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v=spf1 -all"}, txts)
+
+	ttl, ok := trace.TTL()
+	assert.True(t, ok)
+	assert.Equal(t, 9999*time.Second, ttl)
+
+	cname, err := r.LookupCNAME(ctx, "stats.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "mx.example.com.", cname)
+
+	mxs, err := r.LookupMX(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "mx1.example.com.", mxs[0].Host)
+	assert.Equal(t, "mx2.example.com.", mxs[1].Host)
+
+	addrs, err := r.LookupHost(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"192.0.2.1", "2001:db8::1"}, addrs)
+
+	_, err = r.LookupTXT(ctx, "missing.example.com")
+	var dnsErr *net.DNSError
+	assert.True(t, errors.As(err, &dnsErr) && dnsErr.IsNotFound, "missing names should be reported as not found")
+
+	_, err = r.LookupCNAME(ctx, "example.com")
+	assert.True(t, errors.As(err, &dnsErr) && dnsErr.IsNotFound, "names without CNAME should be reported as not found")
+}
+
+func TestResolverTCPFallback(t *testing.T) {
+	ctx := createContext(t)
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, m *dns.Msg) {
+		reply := &dns.Msg{}
+		reply.SetReply(m)
+
+		if _, udp := w.RemoteAddr().(*net.UDPAddr); udp {
+			reply.Truncated = true
+		} else {
+			reply.Answer = append(reply.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: m.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+				Txt: []string{"v=DKIM1; k=rsa; ", "p=key"},
+			})
+		}
+
+		_ = w.WriteMsg(reply)
+	})
+
+	addr := startServer(t, handler)
+
+	resolvers, err := resolver.NewResolvers(addr)
+	assert.Nil(t, err)
+
+	txts, err := resolvers[0].LookupTXT(ctx, "selector._domainkey.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v=DKIM1; k=rsa; p=key"}, txts)
+}
+
+func startServer(t *testing.T, handler dns.Handler) string {
+	tcpL, err := net.Listen("tcp4", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	udpL, err := net.ListenPacket("udp4", tcpL.Addr().String())
+	assert.Nil(t, err)
+
+	tcpServ := &dns.Server{Listener: tcpL, Handler: handler}
+	udpServ := &dns.Server{PacketConn: udpL, Handler: handler}
+
+	go func() { _ = tcpServ.ActivateAndServe() }()
+	go func() { _ = udpServ.ActivateAndServe() }()
+
+	t.Cleanup(func() {
+		_ = tcpServ.Shutdown()
+		_ = udpServ.Shutdown()
+	})
+
+	return tcpL.Addr().String()
+}
@@ -0,0 +1,88 @@
+package resolver
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// QueryOptions configures how the resolvers send a query.
+type QueryOptions struct {
+	// Timeout bounds each attempt of a query.
+	Timeout time.Duration
+	// Retries is the number of times a query is sent again after a
+	// transport error or a SERVFAIL answer.
+	Retries int
+	// RetryBackoff is the delay before the first retry, doubled at each
+	// following one. Delays are jittered by up to 50% either way.
+	RetryBackoff time.Duration
+
+	// DNSSEC configures the validation of the answers.
+	DNSSEC DNSSECOptions
+}
+
+// DefaultQueryOptions are the query options of the resolvers built without
+// explicit ones.
+var DefaultQueryOptions = QueryOptions{
+	Timeout:      DefaultTimeout,
+	Retries:      2,
+	RetryBackoff: 250 * time.Millisecond,
+}
+
+// exchange sends m with retries, giving each attempt its own timeout.
+func (r *dnsResolver) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	var res *dns.Msg
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		res, err = r.exchangeOnce(ctx, m)
+		if err == nil && res.Rcode != dns.RcodeServerFailure {
+			return res, nil
+		}
+
+		if attempt >= r.options.Retries || ctx.Err() != nil {
+			return res, err
+		}
+
+		queryRetries.WithLabelValues(r.addr).Inc()
+
+		select {
+		case <-time.After(backoff(r.options.RetryBackoff, attempt)):
+		case <-ctx.Done():
+			return res, err
+		}
+	}
+}
+
+func (r *dnsResolver) exchangeOnce(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	if r.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.options.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	res, err := r.transport.Exchange(ctx, m)
+
+	result := queryOK
+	if err != nil {
+		result = queryError
+	} else if res.Rcode == dns.RcodeServerFailure {
+		result = queryServFail
+	}
+	queryDuration.WithLabelValues(r.addr, result).Observe(time.Since(start).Seconds())
+
+	return res, err
+}
+
+// backoff returns the jittered delay before retry attempt+1.
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base << attempt
+	if d <= 0 {
+		return 0
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d)))
+}
@@ -0,0 +1,75 @@
+package resolver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyTransport answers SERVFAIL to the first failures queries.
+type flakyTransport struct {
+	failures int
+	queries  int
+}
+
+func (t *flakyTransport) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	t.queries++
+
+	res := &dns.Msg{}
+	res.SetReply(m)
+	if t.queries <= t.failures {
+		res.Rcode = dns.RcodeServerFailure
+		return res, nil
+	}
+
+	res.Answer = append(res.Answer, &dns.TXT{
+		Hdr: dns.RR_Header{Name: m.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+		Txt: []string{"v=spf1 -all"},
+	})
+	return res, nil
+}
+
+func TestRetry(t *testing.T) {
+	transport := &flakyTransport{failures: 2}
+	r := &dnsResolver{
+		addr:      "10.0.0.54:53",
+		transport: transport,
+		options:   QueryOptions{Timeout: time.Second, Retries: 2, RetryBackoff: time.Millisecond},
+	}
+
+	series := testutil.CollectAndCount(queryDuration)
+
+	txts, err := r.LookupTXT(context.Background(), "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v=spf1 -all"}, txts)
+	assert.Equal(t, 3, transport.queries)
+
+	// The failed and the successful attempts are timed apart.
+	assert.Equal(t, series+2, testutil.CollectAndCount(queryDuration))
+}
+
+func TestRetryExhausted(t *testing.T) {
+	transport := &flakyTransport{failures: 3}
+	r := &dnsResolver{
+		addr:      "10.0.0.53:53",
+		transport: transport,
+		options:   QueryOptions{Timeout: time.Second, Retries: 1, RetryBackoff: time.Millisecond},
+	}
+
+	_, err := r.LookupTXT(context.Background(), "example.com")
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, transport.queries)
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 0; attempt < 3; attempt++ {
+		d := backoff(100*time.Millisecond, attempt)
+		base := 100 * time.Millisecond << attempt
+		assert.GreaterOrEqual(t, d, base/2)
+		assert.Less(t, d, base*3/2)
+	}
+}
@@ -0,0 +1,70 @@
+package resolver
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type traceKey struct{}
+
+// Trace collects details of the lookups made with a context, for the
+// resolvers supporting it.
+type Trace struct {
+	mu     sync.Mutex
+	ttl    uint32
+	set    bool
+	dnssec DNSSECState
+}
+
+// WithTrace returns a context recording the lookups made with it in the
+// returned Trace.
+func WithTrace(ctx context.Context) (context.Context, *Trace) {
+	t := &Trace{}
+	return context.WithValue(ctx, traceKey{}, t), t
+}
+
+// TTL returns the lowest TTL of the answers observed by the lookups, which
+// bounds how long the result may be cached. Negative answers report the
+// negative caching TTL of the zone (RFC 2308 5).
+func (t *Trace) TTL() (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return time.Duration(t.ttl) * time.Second, t.set
+}
+
+func (t *Trace) observeTTL(ttl uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.set || ttl < t.ttl {
+		t.ttl = ttl
+		t.set = true
+	}
+}
+
+// DNSSEC returns the weakest DNSSEC state of the answers observed by the
+// lookups, empty when DNSSEC is not validated.
+func (t *Trace) DNSSEC() DNSSECState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.dnssec
+}
+
+func (t *Trace) observeDNSSEC(state DNSSECState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.dnssec == "" || state.Weaker(t.dnssec) {
+		t.dnssec = state
+	}
+}
+
+// ObserveTTL records ttl in the trace of ctx, if any.
+func ObserveTTL(ctx context.Context, ttl uint32) {
+	if t, ok := ctx.Value(traceKey{}).(*Trace); ok {
+		t.observeTTL(ttl)
+	}
+}
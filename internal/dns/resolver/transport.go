@@ -0,0 +1,154 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultTimeout is the default timeout of a single DNS exchange.
+const DefaultTimeout = 5 * time.Second
+
+// dohMediaType is the media type of DNS over HTTPS messages (RFC 8484 6).
+const dohMediaType = "application/dns-message"
+
+// maxDoHResponseSize is the maximum size of a DNS message.
+const maxDoHResponseSize = 65535
+
+// Transport sends a DNS query to a server and returns its response.
+type Transport interface {
+	Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error)
+}
+
+// newTransport returns the transport of a canonical address, see
+// ParseAddress, with exchanges bounded by timeout.
+func newTransport(addr string, timeout time.Duration) (Transport, error) {
+	scheme, target := splitAddress(addr)
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	switch scheme {
+	case SchemeUDP:
+		return &udpTransport{
+			addr: target,
+			udp:  &dns.Client{Net: "udp", Timeout: timeout},
+			tcp:  &dns.Client{Net: "tcp", Timeout: timeout},
+		}, nil
+	case SchemeTCP:
+		return &clientTransport{addr: target, client: &dns.Client{Net: "tcp", Timeout: timeout}}, nil
+	case SchemeTLS:
+		host, _, err := net.SplitHostPort(target)
+		if err != nil {
+			return nil, err
+		}
+
+		return &clientTransport{addr: target, client: &dns.Client{
+			Net:       "tcp-tls",
+			Timeout:   timeout,
+			TLSConfig: &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12},
+		}}, nil
+	case SchemeHTTPS:
+		return &httpsTransport{url: target, client: newDoHClient(timeout)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported resolver scheme %q", scheme)
+	}
+}
+
+// udpTransport queries over UDP and retries over TCP when the response is
+// truncated.
+type udpTransport struct {
+	addr string
+	udp  *dns.Client
+	tcp  *dns.Client
+}
+
+func (t *udpTransport) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	res, _, err := t.udp.ExchangeContext(ctx, m, t.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !res.Truncated {
+		return res, nil
+	}
+
+	res, _, err = t.tcp.ExchangeContext(ctx, m, t.addr)
+	return res, err
+}
+
+// clientTransport queries over a single stream transport, TCP or TLS.
+type clientTransport struct {
+	addr   string
+	client *dns.Client
+}
+
+func (t *clientTransport) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	res, _, err := t.client.ExchangeContext(ctx, m, t.addr)
+	return res, err
+}
+
+// newDoHClient returns the HTTP client of a DNS over HTTPS server. It does
+// not follow redirects, so the queries only reach the configured server.
+func newDoHClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// httpsTransport queries over DNS over HTTPS using POST requests.
+type httpsTransport struct {
+	url    string
+	client *http.Client
+}
+
+func (t *httpsTransport) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	// RFC 8484 4.1: the ID should be 0 to maximize cache friendliness.
+	query := m.Copy()
+	query.Id = 0
+
+	body, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dohMediaType)
+	req.Header.Set("Accept", dohMediaType)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS over HTTPS server returned %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDoHResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &dns.Msg{}
+	if err := res.Unpack(data); err != nil {
+		return nil, err
+	}
+	res.Id = m.Id
+
+	return res, nil
+}
@@ -0,0 +1,109 @@
+package resolver
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPSTransport(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, http.MethodPost, req.Method)
+		assert.Equal(t, dohMediaType, req.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(req.Body)
+		assert.Nil(t, err)
+
+		m := &dns.Msg{}
+		assert.Nil(t, m.Unpack(body))
+		assert.Equal(t, uint16(0), m.Id)
+
+		reply := &dns.Msg{}
+		reply.SetReply(m)
+		reply.Answer = append(reply.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: m.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{"v=DMARC1; p=reject"},
+		})
+
+		data, err := reply.Pack()
+		assert.Nil(t, err)
+
+		w.Header().Set("Content-Type", dohMediaType)
+		_, _ = w.Write(data)
+	}))
+	defer srv.Close()
+
+	addr, err := ParseAddress(srv.URL)
+	assert.Nil(t, err)
+
+	r := &dnsResolver{addr: addr, transport: &httpsTransport{url: addr, client: srv.Client()}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	txts, err := r.LookupTXT(ctx, "_dmarc.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v=DMARC1; p=reject"}, txts)
+}
+
+func TestHTTPSTransportStatus(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	transport := &httpsTransport{url: srv.URL + DefaultDoHPath, client: srv.Client()}
+
+	m := &dns.Msg{}
+	m.SetQuestion("example.com.", dns.TypeTXT)
+
+	_, err := transport.Exchange(context.Background(), m)
+	assert.NotNil(t, err)
+}
+
+func TestHTTPSTransportRedirect(t *testing.T) {
+	redirected := false
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		redirected = true
+	}))
+	defer target.Close()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	client := newDoHClient(time.Second)
+	client.Transport = srv.Client().Transport
+	transport := &httpsTransport{url: srv.URL + DefaultDoHPath, client: client}
+
+	m := &dns.Msg{}
+	m.SetQuestion("example.com.", dns.TypeTXT)
+
+	_, err := transport.Exchange(context.Background(), m)
+	assert.NotNil(t, err)
+	assert.False(t, redirected, "redirects should not be followed")
+}
+
+func TestNewTransport(t *testing.T) {
+	for addr, expected := range map[string]interface{}{
+		"8.8.8.8:53":                    &udpTransport{},
+		"tcp://8.8.8.8:53":              &clientTransport{},
+		"tls://1.1.1.1:853":             &clientTransport{},
+		"https://dns.example/dns-query": &httpsTransport{},
+	} {
+		transport, err := newTransport(addr, DefaultTimeout)
+		assert.Nil(t, err)
+		assert.IsType(t, expected, transport, addr)
+	}
+
+	transport, err := newTransport("tls://one.one.one.one:853", DefaultTimeout)
+	assert.Nil(t, err)
+	assert.Equal(t, "one.one.one.one", transport.(*clientTransport).client.TLSConfig.ServerName)
+}
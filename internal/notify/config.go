@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"text/template"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Payload formats of an endpoint.
+const (
+	// FormatGeneric posts the Event as JSON.
+	FormatGeneric = "generic"
+	// FormatSlack posts a Slack incoming webhook message.
+	FormatSlack = "slack"
+)
+
+// Config is the notification configuration loaded from a file.
+type Config struct {
+	// Endpoints are the HTTP endpoints notified of the transitions.
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+// Endpoint is an HTTP endpoint receiving the notifications.
+type Endpoint struct {
+	// Name identifies the endpoint in the logs, defaults to its host.
+	Name string `json:"name,omitempty"`
+
+	URL string `json:"url"`
+
+	// Format is the payload format, generic or slack. Defaults to generic.
+	Format string `json:"format,omitempty"`
+
+	// Template is a text/template rendering the JSON payload from the
+	// Event, overriding the format.
+	Template string `json:"template,omitempty"`
+
+	// Secret is the key of the HMAC signature of the payloads, see Sign.
+	// Payloads are not signed when it is empty.
+	Secret string `json:"secret,omitempty"`
+
+	// Checks filters the conditions notified, e.g. Ready or DKIMVerified.
+	// All the transitions are notified when it is empty.
+	Checks []string `json:"checks,omitempty"`
+}
+
+// ParseConfig parses a YAML or JSON notification configuration and
+// validates its endpoints.
+func ParseConfig(data []byte) (Config, error) {
+	config := Config{}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return config, err
+	}
+
+	for i := range config.Endpoints {
+		if err := config.Endpoints[i].validate(); err != nil {
+			return config, fmt.Errorf("endpoint %d: %w", i, err)
+		}
+	}
+
+	return config, nil
+}
+
+// LoadConfig reads a notification configuration file, see ParseConfig.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return ParseConfig(data)
+}
+
+func (e *Endpoint) validate() error {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q, expected an http or https url", e.URL)
+	}
+
+	if e.Name == "" {
+		e.Name = u.Host
+	}
+
+	switch e.Format {
+	case "":
+		e.Format = FormatGeneric
+	case FormatGeneric, FormatSlack:
+	default:
+		return fmt.Errorf("unknown format %q, expected %s or %s", e.Format, FormatGeneric, FormatSlack)
+	}
+
+	if e.Template != "" {
+		if _, err := template.New(e.Name).Funcs(templateFuncs).Parse(e.Template); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,275 @@
+// Package notify posts the state transitions of the Domains to HTTP
+// endpoints.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Options tune the deliveries of a Notifier.
+type Options struct {
+	// Timeout bounds a single delivery attempt.
+	Timeout time.Duration
+
+	// Retries is the number of retries of a failed delivery.
+	Retries int
+
+	// RetryBackoff is the base delay between retries, doubled at each
+	// retry with jitter.
+	RetryBackoff time.Duration
+
+	// QueueSize is the number of pending events of each endpoint, events
+	// notified while the queue is full are dropped.
+	QueueSize int
+}
+
+// DefaultOptions are the default delivery options.
+var DefaultOptions = Options{
+	Timeout:      10 * time.Second,
+	Retries:      5,
+	RetryBackoff: time.Second,
+	QueueSize:    100,
+}
+
+// Notifier delivers the events to the configured endpoints. Each endpoint
+// has its own queue and worker, so a slow endpoint does not delay the
+// others, and receives the events in order.
+//
+// The queues are kept in memory: the caller persists what was delivered
+// when an event is done, and notifies the events again when that is not
+// recorded, e.g. after a restart.
+type Notifier struct {
+	endpoints []*endpoint
+	options   Options
+	client    *http.Client
+	log       logr.Logger
+
+	mu      sync.Mutex
+	pending map[string]*delivery
+}
+
+type endpoint struct {
+	Endpoint
+	tmpl   *template.Template
+	checks map[string]bool
+	queue  chan *delivery
+}
+
+// delivery is an event being delivered to the endpoints interested in it.
+type delivery struct {
+	key       string
+	event     Event
+	remaining int
+	dropped   bool
+	done      func()
+}
+
+// New returns a Notifier of the endpoints of the configuration, it does not
+// deliver anything until it is started.
+func New(config Config, options Options, log logr.Logger) (*Notifier, error) {
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultOptions.Timeout
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = DefaultOptions.QueueSize
+	}
+
+	n := &Notifier{
+		options: options,
+		client:  &http.Client{Timeout: options.Timeout},
+		log:     log,
+		pending: map[string]*delivery{},
+	}
+
+	for _, e := range config.Endpoints {
+		if err := e.validate(); err != nil {
+			return nil, err
+		}
+
+		ep := &endpoint{Endpoint: e, queue: make(chan *delivery, options.QueueSize)}
+		if e.Template != "" {
+			ep.tmpl = template.Must(template.New(e.Name).Funcs(templateFuncs).Parse(e.Template))
+		}
+		if len(e.Checks) > 0 {
+			ep.checks = map[string]bool{}
+			for _, check := range e.Checks {
+				ep.checks[check] = true
+			}
+		}
+
+		n.endpoints = append(n.endpoints, ep)
+	}
+
+	return n, nil
+}
+
+// Notify queues the event for the endpoints interested in its check, it
+// never blocks. done is called once every endpoint has been sent the event,
+// or gave up after the retries. It is not called when the event is dropped
+// because a queue is full or the Notifier stops, so that the caller notifies
+// it again. The same transition is not queued twice while it is pending.
+func (n *Notifier) Notify(event Event, done func()) {
+	if n == nil {
+		return
+	}
+
+	var targets []*endpoint
+	for _, ep := range n.endpoints {
+		if ep.checks == nil || ep.checks[event.Check] {
+			targets = append(targets, ep)
+		}
+	}
+
+	if len(targets) == 0 {
+		done()
+		return
+	}
+
+	key := strings.Join([]string{event.Namespace, event.Name, event.Check, event.NewState}, "/")
+
+	n.mu.Lock()
+	if _, ok := n.pending[key]; ok {
+		n.mu.Unlock()
+		return
+	}
+	d := &delivery{key: key, event: event, remaining: len(targets), done: done}
+	n.pending[key] = d
+	n.mu.Unlock()
+
+	for _, ep := range targets {
+		select {
+		case ep.queue <- d:
+		default:
+			n.log.Info("notification queue full, dropping event", "endpoint", ep.Name, "domain", event.Domain, "check", event.Check)
+			n.finish(d, false)
+		}
+	}
+}
+
+// finish records that an endpoint is done with a delivery.
+func (n *Notifier) finish(d *delivery, sent bool) {
+	n.mu.Lock()
+	d.remaining--
+	d.dropped = d.dropped || !sent
+	last := d.remaining == 0
+	if last {
+		delete(n.pending, d.key)
+	}
+	n.mu.Unlock()
+
+	if last && !d.dropped {
+		d.done()
+	}
+}
+
+// Start delivers the queued events until the context is done, it
+// implements the manager Runnable interface.
+func (n *Notifier) Start(ctx context.Context) error {
+	wg := sync.WaitGroup{}
+	for _, ep := range n.endpoints {
+		wg.Add(1)
+		go func(ep *endpoint) {
+			defer wg.Done()
+			n.run(ctx, ep)
+		}(ep)
+	}
+
+	wg.Wait()
+	return nil
+}
+
+// NeedLeaderElection makes only the leader deliver the notifications, as
+// only the leader reconciles the domains.
+func (n *Notifier) NeedLeaderElection() bool {
+	return true
+}
+
+func (n *Notifier) run(ctx context.Context, ep *endpoint) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-ep.queue:
+			err := n.deliver(ctx, ep, d.event)
+			if err != nil && ctx.Err() == nil {
+				// The delivery is not acknowledged, the next reconcile of
+				// the domain notifies the transition again.
+				n.log.Error(err, "failed to deliver notification", "endpoint", ep.Name, "domain", d.event.Domain, "check", d.event.Check)
+			}
+			n.finish(d, err == nil)
+		}
+	}
+}
+
+// deliver posts the event, retrying server errors and transport failures.
+func (n *Notifier) deliver(ctx context.Context, ep *endpoint, event Event) error {
+	body, err := render(ep.Endpoint, ep.tmpl, event)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(ctx, ep, body)
+		if err == nil || !retry || attempt >= n.options.Retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff(n.options.RetryBackoff, attempt)):
+		}
+	}
+}
+
+// post sends a payload once, it reports whether a failure can be retried.
+func (n *Notifier) post(ctx context.Context, ep *endpoint, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "k8nnon")
+
+	if ep.Secret != "" {
+		timestamp := time.Now().Unix()
+		req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(HeaderSignature, Sign(ep.Secret, timestamp, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("endpoint returned %s", resp.Status)
+}
+
+// backoff returns the jittered delay before a retry.
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base << attempt
+	if d <= 0 {
+		return 0
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d)))
+}
@@ -0,0 +1,237 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+	"github.com/kannon-email/k8nnon/internal/notify"
+)
+
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver records the requests it receives, failing the first ones with
+// the given statuses.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []request
+	received chan struct{}
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, string) {
+	r := &receiver{statuses: statuses, received: make(chan struct{}, 10)}
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return r, srv.URL
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	r.requests = append(r.requests, request{header: req.Header, body: body})
+	status := http.StatusNoContent
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	r.mu.Unlock()
+
+	w.WriteHeader(status)
+	r.received <- struct{}{}
+}
+
+func (r *receiver) wait(t *testing.T, n int) []request {
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d of %d requests", i, n)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests
+}
+
+func startNotifier(t *testing.T, config notify.Config) *notify.Notifier {
+	n, err := notify.New(config, notify.Options{Retries: 2, RetryBackoff: time.Millisecond}, logr.Discard())
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_ = n.Start(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return n
+}
+
+func testEvent() notify.Event {
+	return notify.Event{
+		Namespace: "default",
+		Name:      "example",
+		Domain:    "example.com",
+		Check:     "DKIMVerified",
+		OldState:  notify.StateOK,
+		NewState:  notify.StateFailing,
+		Reason:    "RecordNotVerified",
+		Message:   "no DKIM record found",
+		RequiredRecords: []corev1alpha1.RequiredRecord{
+			{Name: "selector._domainkey.example.com", Type: "TXT", Value: "v=DKIM1; k=rsa; p=key", Check: "dkim"},
+		},
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	config, err := notify.ParseConfig([]byte(`
+endpoints:
+- url: https://hooks.example.com/k8nnon
+- name: support
+  url: https://hooks.slack.com/services/T0/B0/X
+  format: slack
+  checks: [Ready]
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, "hooks.example.com", config.Endpoints[0].Name)
+	assert.Equal(t, notify.FormatGeneric, config.Endpoints[0].Format)
+	assert.Equal(t, "support", config.Endpoints[1].Name)
+
+	for _, invalid := range []string{
+		"endpoints: [{url: ftp://example.com}]",
+		"endpoints: [{url: https://example.com, format: teams}]",
+		"endpoints: [{url: https://example.com, template: '{{.Domain'}]",
+		"endpoints: [{url: https://example.com, unknown: true}]",
+	} {
+		_, err := notify.ParseConfig([]byte(invalid))
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestNotifySigned(t *testing.T) {
+	recv, url := newReceiver(t, http.StatusServiceUnavailable)
+	n := startNotifier(t, notify.Config{Endpoints: []notify.Endpoint{{URL: url, Secret: "s3cr3t"}}})
+
+	n.Notify(testEvent(), func() {})
+
+	// The first attempt fails and is retried.
+	requests := recv.wait(t, 2)
+	req := requests[1]
+
+	event := notify.Event{}
+	assert.Nil(t, json.Unmarshal(req.body, &event))
+	assert.Equal(t, testEvent(), event)
+
+	timestamp, err := strconv.ParseInt(req.header.Get(notify.HeaderTimestamp), 10, 64)
+	assert.Nil(t, err)
+	assert.Equal(t, notify.Sign("s3cr3t", timestamp, req.body), req.header.Get(notify.HeaderSignature))
+}
+
+func TestNotifyNoRetryOnClientError(t *testing.T) {
+	recv, url := newReceiver(t, http.StatusBadRequest)
+	n := startNotifier(t, notify.Config{Endpoints: []notify.Endpoint{{URL: url}}})
+
+	recovered := testEvent()
+	recovered.OldState, recovered.NewState = notify.StateFailing, notify.StateOK
+
+	n.Notify(testEvent(), func() {})
+	n.Notify(recovered, func() {})
+
+	// The rejected event is dropped and the next one delivered.
+	requests := recv.wait(t, 2)
+	assert.Len(t, requests, 2)
+	assert.Empty(t, requests[0].header.Get(notify.HeaderSignature))
+}
+
+func TestNotifyFormats(t *testing.T) {
+	slack, slackURL := newReceiver(t)
+	custom, customURL := newReceiver(t)
+	ready, readyURL := newReceiver(t)
+
+	n := startNotifier(t, notify.Config{Endpoints: []notify.Endpoint{
+		{URL: slackURL, Format: notify.FormatSlack},
+		{URL: customURL, Template: `{"summary": {{printf "%s %s" .Domain .NewState | json}}}`},
+		{URL: readyURL, Checks: []string{"Ready"}},
+	}})
+
+	n.Notify(testEvent(), func() {})
+
+	message := map[string]string{}
+	assert.Nil(t, json.Unmarshal(slack.wait(t, 1)[0].body, &message))
+	assert.Equal(t, ":x: *example.com* (default/example): DKIMVerified changed from ok to failing\n"+
+		"> no DKIM record found\n"+
+		"• missing TXT `selector._domainkey.example.com`: `v=DKIM1; k=rsa; p=key`", message["text"])
+
+	assert.JSONEq(t, `{"summary": "example.com failing"}`, string(custom.wait(t, 1)[0].body))
+
+	event := testEvent()
+	event.Check = "Ready"
+	n.Notify(event, func() {})
+
+	requests := ready.wait(t, 1)
+	assert.Len(t, requests, 1, "only the Ready transitions should be notified")
+}
+
+func TestNotifyDone(t *testing.T) {
+	recv, url := newReceiver(t, http.StatusBadGateway)
+	n := startNotifier(t, notify.Config{Endpoints: []notify.Endpoint{{URL: url}}})
+
+	done := make(chan struct{}, 2)
+	n.Notify(testEvent(), func() { done <- struct{}{} })
+	// A pending transition is not queued again.
+	n.Notify(testEvent(), func() { done <- struct{}{} })
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the delivery was not reported as done")
+	}
+	assert.Len(t, recv.wait(t, 2), 2, "the event should have been sent once, with a retry")
+
+	// The filtered out events are done right away.
+	filtered := startNotifier(t, notify.Config{Endpoints: []notify.Endpoint{{URL: url, Checks: []string{"Ready"}}}})
+	called := false
+	filtered.Notify(testEvent(), func() { called = true })
+	assert.True(t, called)
+}
+
+func TestNotifyFailedNotDone(t *testing.T) {
+	recv, url := newReceiver(t, http.StatusBadRequest)
+	n := startNotifier(t, notify.Config{Endpoints: []notify.Endpoint{{URL: url}}})
+
+	done := make(chan struct{}, 2)
+	n.Notify(testEvent(), func() { done <- struct{}{} })
+	recv.wait(t, 1)
+	assert.Never(t, func() bool { return len(done) > 0 }, 200*time.Millisecond, 10*time.Millisecond, "the failed delivery should not be done")
+
+	// The transition is sent again.
+	assert.Eventually(t, func() bool {
+		n.Notify(testEvent(), func() { done <- struct{}{} })
+		select {
+		case <-done:
+			return true
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.GreaterOrEqual(t, len(recv.wait(t, 1)), 2)
+}
@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
+)
+
+// States of a check in the notifications.
+const (
+	StateOK      = "ok"
+	StateFailing = "failing"
+	StateUnknown = "unknown"
+)
+
+// Event is a state transition of a check of a Domain.
+type Event struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Domain    string `json:"domain"`
+
+	// Check is the condition that changed, e.g. DKIMVerified or Ready.
+	Check    string `json:"check"`
+	OldState string `json:"oldState"`
+	NewState string `json:"newState"`
+	Reason   string `json:"reason"`
+	Message  string `json:"message"`
+
+	// RequiredRecords are the records the domain must publish.
+	RequiredRecords []corev1alpha1.RequiredRecord `json:"requiredRecords,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+// Signature headers of the signed payloads.
+const (
+	HeaderSignature = "X-K8nnon-Signature"
+	HeaderTimestamp = "X-K8nnon-Timestamp"
+)
+
+// Sign returns the signature of a payload sent at timestamp, the hex HMAC
+// SHA-256 of "<timestamp>.<body>" prefixed by "sha256=". Receivers should
+// compare it with the HeaderSignature header and reject old timestamps.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+}
+
+// slackTemplate renders the text of the Slack messages.
+var slackTemplate = template.Must(template.New("slack").Funcs(templateFuncs).Parse(
+	`{{if eq .NewState "ok"}}:white_check_mark:{{else}}:x:{{end}} *{{.Domain}}* ({{.Namespace}}/{{.Name}}): ` +
+		`{{.Check}} changed from {{.OldState}} to {{.NewState}}` +
+		`{{with .Message}}
+> {{.}}{{end}}` +
+		`{{if ne .NewState "ok"}}{{range .RequiredRecords}}{{if not .Verified}}
+• missing {{.Type}} ` + "`{{.Name}}`" + `: ` + "`{{.Value}}`" + `{{end}}{{end}}{{end}}`))
+
+// render returns the payload of the event for the endpoint.
+func render(e Endpoint, tmpl *template.Template, event Event) ([]byte, error) {
+	if tmpl != nil {
+		buf := &bytes.Buffer{}
+		err := tmpl.Execute(buf, event)
+		return buf.Bytes(), err
+	}
+
+	if e.Format == FormatSlack {
+		buf := &strings.Builder{}
+		if err := slackTemplate.Execute(buf, event); err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]string{"text": buf.String()})
+	}
+
+	return json.Marshal(event)
+}
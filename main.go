@@ -19,22 +19,32 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	corev1alpha1 "github.com/kannon-email/k8nnon/api/v1alpha1"
 	"github.com/kannon-email/k8nnon/controllers"
 	"github.com/kannon-email/k8nnon/internal/dns/checker"
 	"github.com/kannon-email/k8nnon/internal/dns/resolver"
+	"github.com/kannon-email/k8nnon/internal/notify"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -54,11 +64,69 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var dnsResolvers string
+	var dnsAllowedResolvers string
+	var dnsConfigFile string
+	var dnsConfigMap string
+	var dnsMode string
+	var dnsPolicy checker.Policy
+	var dnsCacheMaxTTL time.Duration
+	var dnsQPS float64
+	var dnsBurst int
+	var dnsMaxInFlight int
+	var dnsQueryOptions resolver.QueryOptions
+	var dnsHealthOptions resolver.HealthOptions
+	var dnsTrustAnchors string
+	var notifyConfigFile string
+	notifyOptions := notify.DefaultOptions
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&dnsResolvers, "dns-resolvers", strings.Join(checker.ServerAddresses, ","),
+		"Comma separated list of the resolvers used to verify DNS records, as IP or host with optional port, "+
+			"or tcp://, tls:// and https:// URLs for DNS over TCP, TLS and HTTPS.")
+	flag.StringVar(&dnsAllowedResolvers, "dns-allowed-resolvers", "",
+		"Comma separated list of the resolvers, besides the default ones, that Domains can set in spec.dns.resolvers.")
+	flag.StringVar(&dnsConfigFile, "dns-config", "",
+		"Path of a resolver configuration file, overriding --dns-resolvers.")
+	flag.StringVar(&dnsConfigMap, "dns-configmap", "",
+		"Namespace and name (namespace/name) of a ConfigMap holding the resolver configuration in its "+
+			controllers.ResolverConfigKey+" key. Changes are applied without restarting the manager.")
+	flag.StringVar(&dnsMode, "dns-mode", checker.ModeRecursive,
+		"Default DNS check mode, recursive to query the resolvers or authoritative to query "+
+			"the nameservers of each domain directly.")
+	flag.DurationVar(&dnsCacheMaxTTL, "dns-cache-max-ttl", 5*time.Minute,
+		"Maximum time DNS answers are cached, within their TTL. Zero disables the cache.")
+	flag.Float64Var(&dnsQPS, "dns-qps", 10,
+		"Maximum DNS queries per second sent to each resolver. Zero disables the limit.")
+	flag.IntVar(&dnsBurst, "dns-burst", 20,
+		"Maximum burst of DNS queries sent to each resolver above --dns-qps.")
+	flag.IntVar(&dnsMaxInFlight, "dns-max-in-flight", 32,
+		"Maximum DNS queries in flight across all the resolvers. Zero disables the limit.")
+	flag.DurationVar(&dnsQueryOptions.Timeout, "dns-timeout", resolver.DefaultQueryOptions.Timeout,
+		"Timeout of each attempt of a DNS query.")
+	flag.IntVar(&dnsQueryOptions.Retries, "dns-retries", resolver.DefaultQueryOptions.Retries,
+		"Number of times a DNS query is retried after a transport error or a SERVFAIL answer.")
+	flag.DurationVar(&dnsQueryOptions.RetryBackoff, "dns-retry-backoff", resolver.DefaultQueryOptions.RetryBackoff,
+		"Delay before the first retry of a DNS query, doubled at each following one and jittered.")
+	flag.IntVar(&dnsHealthOptions.FailureThreshold, "dns-failure-threshold", 5,
+		"Consecutive failed lookups after which a resolver is left out of the checks. Zero disables it.")
+	flag.DurationVar(&dnsHealthOptions.Cooldown, "dns-failure-cooldown", time.Minute,
+		"Time an unhealthy resolver is left out of the checks before being probed again.")
+	flag.StringVar(&dnsQueryOptions.DNSSEC.Mode, "dns-dnssec", resolver.DNSSECOff,
+		"DNSSEC validation of the checked records: off, ad to trust the AD flag of the resolvers, "+
+			"or validate to validate the chain of trust from the trust anchors.")
+	flag.StringVar(&dnsTrustAnchors, "dns-trust-anchors", "",
+		"Path of a file of DS records used as DNSSEC trust anchors, one per line. Defaults to the root KSK.")
+	dnsPolicy.BindFlags(flag.CommandLine, "dns-")
+	flag.StringVar(&notifyConfigFile, "notify-config", "",
+		"Path of a YAML file configuring the endpoints notified of the domain state changes.")
+	flag.IntVar(&notifyOptions.Retries, "notify-retries", notifyOptions.Retries,
+		"The number of retries of a failed notification.")
+	flag.DurationVar(&notifyOptions.RetryBackoff, "notify-retry-backoff", notifyOptions.RetryBackoff,
+		"The base delay between the retries of a notification, doubled at each retry.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -67,7 +135,90 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	defaultResolvers := resolver.SplitAddresses(dnsResolvers)
+	if dnsConfigFile != "" {
+		config, err := resolver.LoadConfig(dnsConfigFile)
+		if err != nil {
+			setupLog.Error(err, "unable to load resolver configuration", "path", dnsConfigFile)
+			os.Exit(1)
+		}
+		defaultResolvers = config.Resolvers
+	}
+
+	if dnsMode != checker.ModeRecursive && dnsMode != checker.ModeAuthoritative {
+		setupLog.Info("invalid --dns-mode, expected recursive or authoritative", "value", dnsMode)
+		os.Exit(1)
+	}
+
+	if dnsTrustAnchors != "" {
+		anchors, err := resolver.LoadTrustAnchors(dnsTrustAnchors)
+		if err != nil {
+			setupLog.Error(err, "unable to load DNSSEC trust anchors", "path", dnsTrustAnchors)
+			os.Exit(1)
+		}
+		dnsQueryOptions.DNSSEC.TrustAnchors = anchors
+	}
+	if err := dnsQueryOptions.DNSSEC.Validate(); err != nil {
+		setupLog.Error(err, "invalid DNSSEC configuration")
+		os.Exit(1)
+	}
+
+	if err := dnsPolicy.Validate(); err != nil {
+		setupLog.Error(err, "invalid DNS quorum policy")
+		os.Exit(1)
+	}
+
+	resolvers, err := resolver.NewPool(defaultResolvers...)
+	if err != nil {
+		setupLog.Error(err, "invalid resolvers")
+		os.Exit(1)
+	}
+	if err := resolvers.RestrictResolvers(resolver.SplitAddresses(dnsAllowedResolvers)); err != nil {
+		setupLog.Error(err, "invalid allowed resolvers")
+		os.Exit(1)
+	}
+	resolvers.SetQueryOptions(dnsQueryOptions)
+	resolvers.SetHealthOptions(dnsHealthOptions)
+	resolvers.SetLimiter(resolver.NewLimiter(dnsQPS, dnsBurst, dnsMaxInFlight))
+	resolvers.EnableCache(dnsCacheMaxTTL)
+
+	if err := resolver.RegisterMetrics(metrics.Registry); err != nil {
+		setupLog.Error(err, "unable to register resolver metrics")
+		os.Exit(1)
+	}
+
+	// Only the DKIM Secrets created by the operator are read, so there is
+	// no need to cache every Secret of the cluster.
+	domainSecrets, err := labels.NewRequirement(controllers.DomainLabel, selection.Exists, nil)
+	if err != nil {
+		setupLog.Error(err, "unable to build the secret selector")
+		os.Exit(1)
+	}
+	selectors := cache.SelectorsByObject{
+		&corev1.Secret{}: {Label: labels.NewSelector().Add(*domainSecrets)},
+	}
+
+	var resolverConfigMap types.NamespacedName
+	if dnsConfigMap != "" {
+		namespace, name, ok := strings.Cut(dnsConfigMap, "/")
+		if !ok || namespace == "" || name == "" {
+			setupLog.Info("invalid --dns-configmap, expected namespace/name", "value", dnsConfigMap)
+			os.Exit(1)
+		}
+		resolverConfigMap = types.NamespacedName{Namespace: namespace, Name: name}
+
+		// Only the resolver ConfigMap is read, so there is no need to
+		// cache every ConfigMap of the cluster.
+		selectors[&corev1.ConfigMap{}] = cache.ObjectSelector{
+			Field: fields.SelectorFromSet(fields.Set{
+				"metadata.namespace": namespace,
+				"metadata.name":      name,
+			}),
+		}
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+		NewCache:               cache.BuilderWithOptions(cache.Options{SelectorsByObject: selectors}),
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
@@ -91,16 +242,49 @@ func main() {
 		os.Exit(1)
 	}
 
-	resolvers := resolver.NewResolvers(checker.ServerAddresses...)
+	var notifier *notify.Notifier
+	if notifyConfigFile != "" {
+		config, err := notify.LoadConfig(notifyConfigFile)
+		if err != nil {
+			setupLog.Error(err, "unable to load notification configuration", "path", notifyConfigFile)
+			os.Exit(1)
+		}
+
+		notifier, err = notify.New(config, notifyOptions, ctrl.Log.WithName("notify"))
+		if err != nil {
+			setupLog.Error(err, "invalid notification configuration")
+			os.Exit(1)
+		}
+
+		if err := mgr.Add(notifier); err != nil {
+			setupLog.Error(err, "unable to set up notifications")
+			os.Exit(1)
+		}
+	}
 
 	if err = (&controllers.DomainReconciler{
-		Client:     mgr.GetClient(),
-		Scheme:     mgr.GetScheme(),
-		DNSChecker: *checker.NewDNSChecker(resolvers...),
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Resolvers: resolvers,
+		DNSMode:   dnsMode,
+		DNSPolicy: dnsPolicy,
+		Recorder:  mgr.GetEventRecorderFor("domain-controller"),
+		Notifier:  notifier,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Domain")
 		os.Exit(1)
 	}
+	if dnsConfigMap != "" {
+		if err = (&controllers.ResolverConfigReconciler{
+			Client:    mgr.GetClient(),
+			Resolvers: resolvers,
+			ConfigMap: resolverConfigMap,
+			Defaults:  defaultResolvers,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ResolverConfig")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -111,6 +295,10 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if err := mgr.AddReadyzCheck("dns-resolvers", resolvers.Check); err != nil {
+		setupLog.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {